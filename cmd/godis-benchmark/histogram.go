@@ -0,0 +1,119 @@
+package main
+
+import (
+	"math/bits"
+	"time"
+)
+
+// histogram 按微秒记录延迟, 小于 128us 精确记录, 更大的值保留 6 位有效二进制位 (误差约 1.5%)
+
+const (
+	linearBuckets = 128
+	mantissaBits  = 6
+	bucketCount   = linearBuckets + 64*(1<<mantissaBits)
+)
+
+type histogram struct {
+	counts []int64
+	total  int64
+	sum    time.Duration
+	min    time.Duration
+	max    time.Duration
+}
+
+func newHistogram() *histogram {
+	return &histogram{
+		counts: make([]int64, bucketCount),
+	}
+}
+
+func bucketOf(us uint64) int {
+	if us < linearBuckets {
+		return int(us)
+	}
+	shift := bits.Len64(us) - mantissaBits - 1
+	return linearBuckets + (shift-1)*(1<<mantissaBits) + int(us>>shift) - (1 << mantissaBits)
+}
+
+// upperBound returns the max value of bucket in microseconds
+func upperBound(bucket int) uint64 {
+	if bucket < linearBuckets {
+		return uint64(bucket)
+	}
+	bucket -= linearBuckets
+	shift := bucket/(1<<mantissaBits) + 1
+	mantissa := uint64(bucket%(1<<mantissaBits) + (1 << mantissaBits))
+	return (mantissa+1)<<shift - 1
+}
+
+func (h *histogram) record(d time.Duration) {
+	if h.total == 0 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+	h.total++
+	h.sum += d
+	h.counts[bucketOf(uint64(d.Microseconds()))]++
+}
+
+func (h *histogram) merge(other *histogram) {
+	if other.total == 0 {
+		return
+	}
+	if h.total == 0 || other.min < h.min {
+		h.min = other.min
+	}
+	if other.max > h.max {
+		h.max = other.max
+	}
+	h.total += other.total
+	h.sum += other.sum
+	for i, c := range other.counts {
+		h.counts[i] += c
+	}
+}
+
+// percentile returns the latency which p (0 ~ 100) percent of requests are below
+func (h *histogram) percentile(p float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	target := int64(p / 100 * float64(h.total))
+	if target < 1 {
+		target = 1
+	}
+	var seen int64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= target {
+			d := time.Duration(upperBound(i)) * time.Microsecond
+			if d > h.max {
+				return h.max
+			}
+			return d
+		}
+	}
+	return h.max
+}
+
+// cumulative returns the percent of requests finished within d
+func (h *histogram) cumulative(d time.Duration) float64 {
+	if h.total == 0 {
+		return 0
+	}
+	limit := bucketOf(uint64(d.Microseconds()))
+	var seen int64
+	for i := 0; i <= limit && i < len(h.counts); i++ {
+		seen += h.counts[i]
+	}
+	return float64(seen) * 100 / float64(h.total)
+}
+
+func (h *histogram) mean() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.total)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucket(t *testing.T) {
+	for us := uint64(0); us < 1<<24; us += 1 + us/100 {
+		b := bucketOf(us)
+		if b >= bucketCount {
+			t.Fatalf("bucket of %d out of range", us)
+		}
+		if upper := upperBound(b); upper < us || float64(upper-us) > float64(us)*0.02+1 {
+			t.Fatalf("upper bound of %d is %d", us, upper)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	h := newHistogram()
+	for i := 1; i <= 1000; i++ {
+		h.record(time.Duration(i) * time.Millisecond)
+	}
+	cases := map[float64]time.Duration{
+		50:   500 * time.Millisecond,
+		99:   990 * time.Millisecond,
+		99.9: 999 * time.Millisecond,
+	}
+	for p, expected := range cases {
+		actual := h.percentile(p)
+		if actual < expected || actual > expected+expected/50 {
+			t.Errorf("p%v: expect %v, actual %v", p, expected, actual)
+		}
+	}
+	if h.min != time.Millisecond || h.max != time.Second {
+		t.Errorf("wrong min %v or max %v", h.min, h.max)
+	}
+}
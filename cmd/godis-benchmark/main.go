@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/atomwqh/MyGodis/redis/parser"
+	"github.com/atomwqh/MyGodis/redis/protocol"
+)
+
+/*
+godis-benchmark measures throughput and latency of MyGodis like redis-benchmark
+
+	godis-benchmark [-h host] [-p port] [-c clients] [-n requests] [-P pipeline] [-r keyspace] [-d size] [-t tests]
+*/
+
+var (
+	host      = flag.String("h", "127.0.0.1", "server hostname")
+	port      = flag.Int("p", 6379, "server port")
+	clients   = flag.Int("c", 50, "number of parallel connections")
+	requests  = flag.Int("n", 100000, "total number of requests of each test")
+	pipeline  = flag.Int("P", 1, "pipeline <numreq> requests")
+	keySpace  = flag.Int("r", 0, "use random keys in range [0, keyspace), 0 means always using the same key")
+	dataSize  = flag.Int("d", 3, "data size of SET/GET/LPUSH value in bytes")
+	tests     = flag.String("t", "set,get,lpush,zadd,mset", "comma separated list of tests")
+	quiet     = flag.Bool("q", false, "quiet, just show throughput and latency percentiles")
+	keyPrefix = "key:"
+)
+
+// generator makes the command line of a request
+type generator func(rnd *rand.Rand, value []byte) [][]byte
+
+func randKey(rnd *rand.Rand, prefix string) []byte {
+	if *keySpace <= 0 {
+		return []byte(prefix + "__rand_int__")
+	}
+	return []byte(fmt.Sprintf("%s%012d", prefix, rnd.Intn(*keySpace)))
+}
+
+var generators = map[string]generator{
+	"set": func(rnd *rand.Rand, value []byte) [][]byte {
+		return [][]byte{[]byte("SET"), randKey(rnd, keyPrefix), value}
+	},
+	"get": func(rnd *rand.Rand, value []byte) [][]byte {
+		return [][]byte{[]byte("GET"), randKey(rnd, keyPrefix)}
+	},
+	"lpush": func(rnd *rand.Rand, value []byte) [][]byte {
+		return [][]byte{[]byte("LPUSH"), randKey(rnd, "mylist:"), value}
+	},
+	"zadd": func(rnd *rand.Rand, value []byte) [][]byte {
+		score := strconv.Itoa(rnd.Intn(1000000))
+		return [][]byte{[]byte("ZADD"), randKey(rnd, "myzset:"), []byte(score), randKey(rnd, "element:")}
+	},
+	"mset": func(rnd *rand.Rand, value []byte) [][]byte {
+		// 10 keys like redis-benchmark
+		args := [][]byte{[]byte("MSET")}
+		for i := 0; i < 10; i++ {
+			args = append(args, randKey(rnd, keyPrefix), value)
+		}
+		return args
+	},
+}
+
+type result struct {
+	name     string
+	hist     *histogram
+	errors   int64
+	elapsed  time.Duration
+	firstErr string
+}
+
+// runTest sends requests through clients connections and records latency of every request
+func runTest(addr string, name string, gen generator) (*result, error) {
+	value := []byte(strings.Repeat("x", *dataSize))
+	var remaining int64 = int64(*requests)
+	var errCount int64
+	var firstErr atomic.Value
+	hists := make([]*histogram, *clients)
+	conns := make([]net.Conn, *clients)
+	for i := range conns {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			for _, c := range conns[:i] {
+				_ = c.Close()
+			}
+			return nil, err
+		}
+		conns[i] = conn
+	}
+
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i, conn := range conns {
+		wg.Add(1)
+		hist := newHistogram()
+		hists[i] = hist
+		go func(conn net.Conn, seed int64) {
+			defer wg.Done()
+			defer conn.Close()
+			rnd := rand.New(rand.NewSource(seed))
+			writer := bufio.NewWriter(conn)
+			reader := parser.NewReader(conn)
+			for {
+				// take a batch of requests
+				n := int64(*pipeline)
+				left := atomic.AddInt64(&remaining, -n)
+				if left+n <= 0 {
+					return
+				}
+				if left < 0 {
+					n += left
+				}
+				for j := int64(0); j < n; j++ {
+					_, _ = writer.Write(protocol.MakeMultiBulkReply(gen(rnd, value)).ToBytes())
+				}
+				sent := time.Now()
+				if err := writer.Flush(); err != nil {
+					firstErr.CompareAndSwap(nil, err.Error())
+					atomic.AddInt64(&errCount, n)
+					return
+				}
+				for j := int64(0); j < n; j++ {
+					reply, err := reader.Next()
+					if err != nil {
+						firstErr.CompareAndSwap(nil, err.Error())
+						atomic.AddInt64(&errCount, n-j)
+						return
+					}
+					hist.record(time.Since(sent))
+					if errReply, ok := reply.(protocol.ErrorReply); ok {
+						firstErr.CompareAndSwap(nil, errReply.Error())
+						atomic.AddInt64(&errCount, 1)
+					}
+				}
+			}
+		}(conn, time.Now().UnixNano()+int64(i))
+	}
+	wg.Wait()
+
+	res := &result{
+		name:    name,
+		hist:    newHistogram(),
+		errors:  errCount,
+		elapsed: time.Since(start),
+	}
+	for _, hist := range hists {
+		res.hist.merge(hist)
+	}
+	if msg, ok := firstErr.Load().(string); ok {
+		res.firstErr = msg
+	}
+	return res, nil
+}
+
+func msec(d time.Duration) string {
+	return strconv.FormatFloat(float64(d.Microseconds())/1000, 'f', 3, 64)
+}
+
+func report(res *result) {
+	hist := res.hist
+	throughput := float64(hist.total) / res.elapsed.Seconds()
+	if *quiet {
+		fmt.Printf("%s: %.2f requests per second, p50=%s msec, p99=%s msec, p999=%s msec\n",
+			strings.ToUpper(res.name), throughput, msec(hist.percentile(50)), msec(hist.percentile(99)), msec(hist.percentile(99.9)))
+		return
+	}
+	fmt.Printf("====== %s ======\n", strings.ToUpper(res.name))
+	fmt.Printf("  %d requests completed in %.2f seconds\n", hist.total, res.elapsed.Seconds())
+	fmt.Printf("  %d parallel clients\n", *clients)
+	fmt.Printf("  %d bytes payload\n", *dataSize)
+	fmt.Printf("  pipeline: %d\n", *pipeline)
+	if res.errors > 0 {
+		fmt.Printf("  %d errors, first error: %s\n", res.errors, res.firstErr)
+	}
+	fmt.Println()
+	fmt.Println("Latency by percentile distribution:")
+	for _, p := range []float64{0, 50, 75, 90, 99, 99.9, 99.99, 100} {
+		d := hist.percentile(p)
+		if p == 0 {
+			d = hist.min
+		} else if p == 100 {
+			d = hist.max
+		}
+		fmt.Printf("%7.3f%% <= %s milliseconds\n", p, msec(d))
+	}
+	fmt.Println()
+	fmt.Println("Cumulative distribution of latencies:")
+	for limit := 100 * time.Microsecond; ; limit *= 2 {
+		percent := hist.cumulative(limit)
+		fmt.Printf("%7.3f%% <= %s milliseconds\n", percent, msec(limit))
+		if percent >= 100 || limit > hist.max {
+			break
+		}
+	}
+	fmt.Println()
+	fmt.Println("Summary:")
+	fmt.Printf("  throughput summary: %.2f requests per second\n", throughput)
+	fmt.Println("  latency summary (msec):")
+	fmt.Printf("  %9s %9s %9s %9s %9s %9s\n", "avg", "min", "p50", "p99", "p999", "max")
+	fmt.Printf("  %9s %9s %9s %9s %9s %9s\n\n", msec(hist.mean()), msec(hist.min),
+		msec(hist.percentile(50)), msec(hist.percentile(99)), msec(hist.percentile(99.9)), msec(hist.max))
+}
+
+func main() {
+	flag.Parse()
+	if *clients <= 0 || *requests <= 0 || *pipeline <= 0 {
+		fmt.Fprintln(os.Stderr, "clients, requests and pipeline must be positive")
+		os.Exit(1)
+	}
+	addr := net.JoinHostPort(*host, strconv.Itoa(*port))
+	for _, name := range strings.Split(*tests, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		gen, ok := generators[name]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unknown test: %s\n", name)
+			os.Exit(1)
+		}
+		res, err := runTest(addr, name, gen)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not connect to %s: %v\n", addr, err)
+			os.Exit(1)
+		}
+		report(res)
+	}
+}
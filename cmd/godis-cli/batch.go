@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/atomwqh/MyGodis/interface/redis"
+	"github.com/atomwqh/MyGodis/lib/utils"
+	"github.com/atomwqh/MyGodis/redis/client"
+	"github.com/atomwqh/MyGodis/redis/parser"
+	"github.com/atomwqh/MyGodis/redis/protocol"
+)
+
+// 非交互模式: 单条命令, 逐行执行, --pipe 批量导入, --scan 遍历 key
+
+func render(reply redis.Reply, rawOutput bool) string {
+	if rawOutput {
+		return formatRaw(reply)
+	}
+	return formatReply(reply, 0)
+}
+
+func openInput(path string) (io.ReadCloser, error) {
+	if path == "" {
+		return os.Stdin, nil
+	}
+	return os.Open(path)
+}
+
+// execOnce executes the command given by command line arguments
+func execOnce(cfg *client.Config, args []string, rawOutput bool) error {
+	cmdLine := utils.ToCmdLine(args...)
+	if isStreamCommand(cmdLine) {
+		return streamMode(cfg, cmdLine, rawOutput)
+	}
+	c, err := client.Dial(cfg)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	reply, err := c.Do(cmdLine)
+	if err != nil {
+		return err
+	}
+	fmt.Print(render(reply, rawOutput))
+	return nil
+}
+
+// execLines executes commands line by line, lines are split with inline quoting rules
+func execLines(cfg *client.Config, path string, rawOutput bool) error {
+	input, err := openInput(path)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+	c, err := client.Dial(cfg)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return scanCommands(input, func(args [][]byte) error {
+		reply, err := c.Do(args)
+		if err != nil {
+			return err
+		}
+		fmt.Print(render(reply, rawOutput))
+		return nil
+	})
+}
+
+// scanCommands calls fn for each non blank line split with inline quoting rules, it stops at the first error
+func scanCommands(input io.Reader, fn func(args [][]byte) error) error {
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), 512*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		args, err := parser.SplitArgs(line)
+		if err != nil {
+			return fmt.Errorf("invalid argument(s): %s", line)
+		}
+		if err = fn(args); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// pipeMode sends all commands without waiting for replies, then counts errors like redis-cli --pipe
+func pipeMode(cfg *client.Config, path string) error {
+	input, err := openInput(path)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+	c, err := client.Dial(cfg)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	// bounded queue, so that sending doesn't run too far ahead of receiving
+	requests := make(chan *client.Request, 1024)
+	done := make(chan struct{})
+	var errCount, replyCount int
+	go func() {
+		defer close(done)
+		for req := range requests {
+			reply, err := c.Receive(req)
+			replyCount++
+			if err != nil {
+				errCount++
+				continue
+			}
+			if errReply, ok := reply.(protocol.ErrorReply); ok {
+				errCount++
+				if errCount <= 10 {
+					fmt.Fprintln(os.Stderr, errReply.Error())
+				}
+			}
+		}
+	}()
+
+	readErr := readPipe(input, func(args [][]byte) {
+		requests <- c.Send(args)
+	})
+	close(requests)
+	fmt.Println("All data transferred. Waiting for the last reply...")
+	<-done
+	fmt.Println("Last reply received from server.")
+	fmt.Printf("errors: %d, replies: %d\n", errCount, replyCount)
+	if readErr != nil {
+		return readErr
+	}
+	if errCount > 0 {
+		return fmt.Errorf("%d commands failed", errCount)
+	}
+	return nil
+}
+
+// readPipe calls fn for each command of RESP or inline format in input
+func readPipe(input io.Reader, fn func(args [][]byte)) error {
+	reader := parser.NewReaderWithLimits(input, parser.Limits{
+		MaxBulkLen:      parser.DefaultLimits().MaxBulkLen,
+		MaxMultiBulkLen: parser.DefaultLimits().MaxMultiBulkLen,
+		MaxInlineSize:   512 * 1024 * 1024,
+	})
+	for {
+		reply, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		cmd, ok := reply.(*protocol.MultiBulkReply)
+		if !ok {
+			return fmt.Errorf("unexpected input: %q", reply.ToBytes())
+		}
+		fn(cmd.Args)
+	}
+}
+
+// scanMode prints all keys matching pattern by SCAN
+func scanMode(cfg *client.Config, pattern string, count int) error {
+	c, err := client.Dial(cfg)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	cursor := "0"
+	for {
+		values, err := client.Values(c.Do([][]byte{
+			[]byte("SCAN"), []byte(cursor),
+			[]byte("MATCH"), []byte(pattern),
+			[]byte("COUNT"), []byte(strconv.Itoa(count)),
+		}))
+		if err != nil {
+			return err
+		}
+		if len(values) != 2 {
+			return fmt.Errorf("unexpected SCAN reply")
+		}
+		if cursor, err = client.String(values[0], nil); err != nil {
+			return err
+		}
+		keys, err := client.Strings(values[1], nil)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			fmt.Println(key)
+		}
+		if cursor == "0" {
+			return nil
+		}
+	}
+}
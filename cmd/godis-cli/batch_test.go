@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestScanCommands(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected [][]string
+		err      bool
+	}{
+		{"blank lines", "set a 1\n\n  \nget a\n", [][]string{{"set", "a", "1"}, {"get", "a"}}, false},
+		{"quotes", `set "a b" 'c d'` + "\r\n", [][]string{{"set", "a b", "c d"}}, false},
+		{"escapes", `set k "\x41\n"`, [][]string{{"set", "k", "A\n"}}, false},
+		{"unbalanced", "get a\nset \"a 1\nget b\n", [][]string{{"get", "a"}}, true},
+	}
+	for _, tt := range tests {
+		var actual [][]string
+		err := scanCommands(strings.NewReader(tt.input), func(args [][]byte) error {
+			actual = append(actual, toStrings(args))
+			return nil
+		})
+		if (err != nil) != tt.err {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("%s: expect %q, actual %q", tt.name, tt.expected, actual)
+		}
+	}
+
+	stop := errors.New("stop")
+	err := scanCommands(strings.NewReader("a\nb\n"), func(args [][]byte) error {
+		return stop
+	})
+	if err != stop {
+		t.Errorf("error of callback should be returned, actual %v", err)
+	}
+}
+
+func TestReadPipe(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected [][]string
+		err      bool
+	}{
+		{"resp", "*2\r\n$3\r\nget\r\n$1\r\na\r\n*1\r\n$4\r\nping\r\n", [][]string{{"get", "a"}, {"ping"}}, false},
+		{"inline", "set a 1\nget a\n", [][]string{{"set", "a", "1"}, {"get", "a"}}, false},
+		{"mixed", "ping\r\n*1\r\n$4\r\nping\r\n", [][]string{{"ping"}, {"ping"}}, false},
+		{"binary", "*2\r\n$3\r\nget\r\n$3\r\na\r\n\r\n", [][]string{{"get", "a\r\n"}}, false},
+		{"not command", "ping\r\n+OK\r\n", [][]string{{"ping"}}, true},
+		{"truncated", "*2\r\n$3\r\nget\r\n", nil, true},
+	}
+	for _, tt := range tests {
+		var actual [][]string
+		err := readPipe(strings.NewReader(tt.input), func(args [][]byte) {
+			actual = append(actual, toStrings(args))
+		})
+		if (err != nil) != tt.err {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("%s: expect %q, actual %q", tt.name, tt.expected, actual)
+		}
+	}
+}
+
+func TestIsStreamCommand(t *testing.T) {
+	for line, expected := range map[string]bool{
+		"SUBSCRIBE ch": true, "psubscribe p*": true, "monitor": true, "publish ch msg": false, "": false,
+	} {
+		if actual := isStreamCommand(toArgs(line)); actual != expected {
+			t.Errorf("%q: expect %v, actual %v", line, expected, actual)
+		}
+	}
+}
+
+func toStrings(args [][]byte) []string {
+	result := make([]string, len(args))
+	for i, arg := range args {
+		result[i] = string(arg)
+	}
+	return result
+}
+
+func toArgs(line string) [][]byte {
+	var args [][]byte
+	for _, field := range strings.Fields(line) {
+		args = append(args, []byte(field))
+	}
+	return args
+}
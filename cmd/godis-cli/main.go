@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/atomwqh/MyGodis/redis/client"
+	"github.com/atomwqh/MyGodis/redis/protocol"
+)
+
+/*
+godis-cli is the command line client of MyGodis
+
+	godis-cli [-h host] [-p port] [-s socket] [-3] [cmd [arg ...]]
+
+without cmd it starts an interactive shell if stdin is a terminal,
+otherwise it executes commands read from stdin (or --file) line by line.
+*/
+
+var (
+	host     = flag.String("h", "127.0.0.1", "server hostname")
+	port     = flag.Int("p", 6379, "server port")
+	socket   = flag.String("s", "", "server socket (overrides hostname and port)")
+	resp3    = flag.Bool("3", false, "start session in RESP3 protocol mode")
+	password = flag.String("a", "", "password to use when connecting to the server")
+	user     = flag.String("user", "", "used to send ACL style 'AUTH username pass', needs -a")
+	timeout  = flag.Duration("t", 0, "timeout of each request, 0 means no limit")
+	raw      = flag.Bool("raw", false, "use raw formatting for replies (default when stdout is not a tty)")
+	noRaw    = flag.Bool("no-raw", false, "force formatted output even when stdout is not a tty")
+	file     = flag.String("file", "", "read commands from file instead of stdin")
+	pipe     = flag.Bool("pipe", false, "transfer raw protocol or inline commands from stdin (or --file) to server")
+	scan     = flag.Bool("scan", false, "list all keys using the SCAN command")
+	pattern  = flag.String("pattern", "*", "keys pattern when using --scan")
+	count    = flag.Int("count", 100, "COUNT option when using --scan")
+	dialTime = 5 * time.Second
+)
+
+func main() {
+	flag.Parse()
+	cfg := &client.Config{
+		Address:     net.JoinHostPort(*host, strconv.Itoa(*port)),
+		DialTimeout: dialTime,
+		Timeout:     *timeout,
+		Protocol:    protocol.RESP2,
+		Username:    *user,
+		Password:    *password,
+	}
+	if *socket != "" {
+		cfg.Network = "unix"
+		cfg.Address = *socket
+	}
+	if *resp3 {
+		cfg.Protocol = protocol.RESP3
+	}
+	rawOutput := *raw || (!*noRaw && !isTerminal(int(os.Stdout.Fd())))
+
+	var err error
+	switch {
+	case *pipe:
+		err = pipeMode(cfg, *file)
+	case *scan:
+		err = scanMode(cfg, *pattern, *count)
+	case flag.NArg() > 0:
+		err = execOnce(cfg, flag.Args(), rawOutput)
+	case *file != "" || !isTerminal(int(os.Stdin.Fd())):
+		err = execLines(cfg, *file, rawOutput)
+	default:
+		repl(cfg)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
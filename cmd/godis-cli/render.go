@@ -0,0 +1,183 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/atomwqh/MyGodis/interface/redis"
+	"github.com/atomwqh/MyGodis/redis/protocol"
+)
+
+// 按 redis-cli 的格式打印 reply, 嵌套的数组会按前缀的宽度缩进
+
+// quote escapes binary data like redis-cli does
+func quote(b []byte) string {
+	var buf strings.Builder
+	buf.WriteByte('"')
+	for _, c := range b {
+		switch c {
+		case '\\', '"':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\a':
+			buf.WriteString(`\a`)
+		case '\b':
+			buf.WriteString(`\b`)
+		default:
+			if c >= 0x20 && c < 0x7f {
+				buf.WriteByte(c)
+			} else {
+				buf.WriteString(`\x`)
+				buf.WriteString(strconv.FormatInt(int64(c)>>4, 16))
+				buf.WriteString(strconv.FormatInt(int64(c)&0xf, 16))
+			}
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// formatReply formats reply for terminal, indent is the column where nested lines start
+func formatReply(reply redis.Reply, indent int) string {
+	switch r := reply.(type) {
+	case *protocol.StatusReply:
+		return r.Status + "\n"
+	case protocol.ErrorReply:
+		return "(error) " + r.Error() + "\n"
+	case *protocol.IntReply:
+		return "(integer) " + strconv.FormatInt(r.Code, 10) + "\n"
+	case *protocol.BulkReply:
+		if r.Arg == nil {
+			return "(nil)\n"
+		}
+		return quote(r.Arg) + "\n"
+	case *protocol.NullBulkReply, *protocol.NullReply:
+		return "(nil)\n"
+	case *protocol.DoubleReply:
+		return "(double) " + r.String() + "\n"
+	case *protocol.BooleanReply:
+		if r.Value {
+			return "(true)\n"
+		}
+		return "(false)\n"
+	case *protocol.BigNumberReply:
+		return "(big number) " + r.Value + "\n"
+	case *protocol.VerbatimReply:
+		return string(r.Text) + "\n"
+	case *protocol.AttributeReply:
+		return formatReply(r.Reply, indent)
+	case *protocol.MapReply:
+		if len(r.Keys) == 0 {
+			return "(empty hash)\n"
+		}
+		width := len(strconv.Itoa(len(r.Keys)))
+		var buf strings.Builder
+		for i, key := range r.Keys {
+			if i > 0 {
+				buf.WriteString(strings.Repeat(" ", indent))
+			}
+			prefix := padLeft(strconv.Itoa(i+1), width) + "# "
+			k := strings.TrimSuffix(formatReply(key, indent+len(prefix)), "\n") + " => "
+			buf.WriteString(prefix)
+			buf.WriteString(k)
+			buf.WriteString(formatReply(r.Values[i], indent+len(prefix)+len(k)))
+		}
+		return buf.String()
+	case *protocol.SetReply:
+		if len(r.Members) == 0 {
+			return "(empty set)\n"
+		}
+		return formatElements(r.Members, '~', indent)
+	case *protocol.PushReply:
+		return formatElements(r.Replies, ')', indent)
+	case *protocol.EmptyMultiBulkReply:
+		return "(empty array)\n"
+	case *protocol.MultiBulkReply:
+		if len(r.Args) == 0 {
+			return "(empty array)\n"
+		}
+		elements := make([]redis.Reply, len(r.Args))
+		for i, arg := range r.Args {
+			elements[i] = protocol.MakeBulkReply(arg)
+		}
+		return formatElements(elements, ')', indent)
+	case *protocol.MultiRawReply:
+		if len(r.Replies) == 0 {
+			return "(empty array)\n"
+		}
+		return formatElements(r.Replies, ')', indent)
+	}
+	return string(reply.ToBytes())
+}
+
+func formatElements(elements []redis.Reply, sep byte, indent int) string {
+	width := len(strconv.Itoa(len(elements)))
+	var buf strings.Builder
+	for i, element := range elements {
+		if i > 0 {
+			buf.WriteString(strings.Repeat(" ", indent))
+		}
+		prefix := padLeft(strconv.Itoa(i+1), width) + string(sep) + " "
+		buf.WriteString(prefix)
+		buf.WriteString(formatReply(element, indent+len(prefix)))
+	}
+	return buf.String()
+}
+
+func padLeft(s string, width int) string {
+	if len(s) >= width {
+		return s
+	}
+	return strings.Repeat(" ", width-len(s)) + s
+}
+
+// formatRaw formats reply without type hints, used when output is not a terminal
+func formatRaw(reply redis.Reply) string {
+	switch r := reply.(type) {
+	case *protocol.StatusReply:
+		return r.Status + "\n"
+	case protocol.ErrorReply:
+		return r.Error() + "\n"
+	case *protocol.IntReply:
+		return strconv.FormatInt(r.Code, 10) + "\n"
+	case *protocol.BulkReply:
+		return string(r.Arg) + "\n"
+	case *protocol.NullBulkReply, *protocol.NullReply, *protocol.EmptyMultiBulkReply:
+		return "\n"
+	case *protocol.DoubleReply:
+		return r.String() + "\n"
+	case *protocol.BooleanReply:
+		if r.Value {
+			return "1\n"
+		}
+		return "0\n"
+	case *protocol.BigNumberReply:
+		return r.Value + "\n"
+	case *protocol.VerbatimReply:
+		return string(r.Text) + "\n"
+	case *protocol.AttributeReply:
+		return formatRaw(r.Reply)
+	}
+	reply = protocol.ToResp2(reply)
+	var buf strings.Builder
+	switch r := reply.(type) {
+	case *protocol.MultiBulkReply:
+		for _, arg := range r.Args {
+			buf.Write(arg)
+			buf.WriteByte('\n')
+		}
+	case *protocol.MultiRawReply:
+		for _, element := range r.Replies {
+			buf.WriteString(formatRaw(element))
+		}
+	default:
+		buf.Write(reply.ToBytes())
+	}
+	return buf.String()
+}
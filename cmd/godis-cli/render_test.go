@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/atomwqh/MyGodis/interface/redis"
+	"github.com/atomwqh/MyGodis/redis/protocol"
+)
+
+func TestRender(t *testing.T) {
+	nested := protocol.MakeMultiRawReply([]redis.Reply{
+		protocol.MakeIntReply(1),
+		protocol.MakeMultiBulkReply([][]byte{[]byte("a"), []byte("b")}),
+	})
+	tests := []struct {
+		name  string
+		reply redis.Reply
+		tty   string
+		raw   string
+	}{
+		{"status", protocol.MakeStatusReply("OK"), "OK\n", "OK\n"},
+		{"error", protocol.MakeErrReply("ERR bad"), "(error) ERR bad\n", "ERR bad\n"},
+		{"integer", protocol.MakeIntReply(42), "(integer) 42\n", "42\n"},
+		{"bulk", protocol.MakeBulkReply([]byte("a\"b\n\x01")), `"a\"b\n\x01"` + "\n", "a\"b\n\x01\n"},
+		{"nil", protocol.MakeNullBulkReply(), "(nil)\n", "\n"},
+		{"empty array", protocol.MakeEmptyMultiBulkReply(), "(empty array)\n", "\n"},
+		{"nested array", nested, "1) (integer) 1\n2) 1) \"a\"\n   2) \"b\"\n", "1\na\nb\n"},
+		{"map", protocol.MakeMapReply(
+			[]redis.Reply{protocol.MakeBulkReply([]byte("k"))},
+			[]redis.Reply{protocol.MakeDoubleReply(1.5)},
+		), "1# \"k\" => (double) 1.5\n", "k\n1.5\n"},
+		{"empty set", protocol.MakeSetReply(nil), "(empty set)\n", ""},
+		{"boolean", protocol.MakeBooleanReply(true), "(true)\n", "1\n"},
+		{"attribute", protocol.MakeAttributeReply(protocol.MakeMapReply(nil, nil), protocol.MakeIntReply(1)),
+			"(integer) 1\n", "1\n"},
+	}
+	for _, tt := range tests {
+		if actual := render(tt.reply, false); actual != tt.tty {
+			t.Errorf("%s: expect %q, actual %q", tt.name, tt.tty, actual)
+		}
+		if actual := render(tt.reply, true); actual != tt.raw {
+			t.Errorf("%s raw: expect %q, actual %q", tt.name, tt.raw, actual)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/atomwqh/MyGodis/redis/client"
+	"github.com/atomwqh/MyGodis/redis/parser"
+)
+
+const (
+	historyFile = ".godiscli_history"
+	maxHistory  = 1000
+)
+
+var errInterrupted = errors.New("interrupted")
+
+// lineEditor reads lines from terminal with history, it falls back to plain reading if raw mode is unavailable
+type lineEditor struct {
+	in      *bufio.Reader
+	out     io.Writer
+	fd      int
+	history []string
+	file    *os.File
+}
+
+func newLineEditor() *lineEditor {
+	e := &lineEditor{
+		in:  bufio.NewReader(os.Stdin),
+		out: os.Stdout,
+		fd:  int(os.Stdin.Fd()),
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return e
+	}
+	path := filepath.Join(home, historyFile)
+	if data, err := os.ReadFile(path); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if line != "" {
+				e.history = append(e.history, line)
+			}
+		}
+		if len(e.history) > maxHistory {
+			e.history = e.history[len(e.history)-maxHistory:]
+		}
+	}
+	e.file, _ = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	return e
+}
+
+func (e *lineEditor) addHistory(line string) {
+	if len(e.history) > 0 && e.history[len(e.history)-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+	if e.file != nil {
+		_, _ = e.file.WriteString(line + "\n")
+	}
+}
+
+func (e *lineEditor) close() {
+	if e.file != nil {
+		_ = e.file.Close()
+	}
+}
+
+// readLine shows prompt and reads a line, returns errInterrupted on Ctrl-C and io.EOF on Ctrl-D
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	restore, err := makeRaw(e.fd)
+	if err != nil {
+		_, _ = fmt.Fprint(e.out, prompt)
+		line, err := e.in.ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	defer restore()
+
+	var buf []rune
+	pos := 0
+	histIndex := len(e.history)
+	refresh := func() {
+		col := utf8.RuneCountInString(prompt) + pos
+		_, _ = fmt.Fprintf(e.out, "\r%s%s\x1b[K\r", prompt, string(buf))
+		if col > 0 {
+			_, _ = fmt.Fprintf(e.out, "\x1b[%dC", col)
+		}
+	}
+	setLine := func(line string) {
+		buf = []rune(line)
+		pos = len(buf)
+		refresh()
+	}
+	refresh()
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch r {
+		case '\r', '\n':
+			_, _ = fmt.Fprint(e.out, "\r\n")
+			return string(buf), nil
+		case 3: // Ctrl-C
+			_, _ = fmt.Fprint(e.out, "^C\r\n")
+			return "", errInterrupted
+		case 4: // Ctrl-D
+			if len(buf) == 0 {
+				_, _ = fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+		case 1: // Ctrl-A
+			pos = 0
+			refresh()
+		case 5: // Ctrl-E
+			pos = len(buf)
+			refresh()
+		case 21: // Ctrl-U
+			buf = buf[pos:]
+			pos = 0
+			refresh()
+		case 127, 8: // backspace
+			if pos > 0 {
+				buf = append(buf[:pos-1], buf[pos:]...)
+				pos--
+				refresh()
+			}
+		case 27: // escape sequence
+			if b, _ := e.in.ReadByte(); b != '[' {
+				continue
+			}
+			b, _ := e.in.ReadByte()
+			switch b {
+			case 'A': // up
+				if histIndex > 0 {
+					histIndex--
+					setLine(e.history[histIndex])
+				}
+			case 'B': // down
+				if histIndex < len(e.history)-1 {
+					histIndex++
+					setLine(e.history[histIndex])
+				} else if histIndex == len(e.history)-1 {
+					histIndex++
+					setLine("")
+				}
+			case 'C': // right
+				if pos < len(buf) {
+					pos++
+					refresh()
+				}
+			case 'D': // left
+				if pos > 0 {
+					pos--
+					refresh()
+				}
+			case 'H':
+				pos = 0
+				refresh()
+			case 'F':
+				pos = len(buf)
+				refresh()
+			case '3': // delete
+				if t, _ := e.in.ReadByte(); t == '~' && pos < len(buf) {
+					buf = append(buf[:pos], buf[pos+1:]...)
+					refresh()
+				}
+			}
+		default:
+			if r >= 0x20 {
+				buf = append(buf[:pos], append([]rune{r}, buf[pos:]...)...)
+				pos++
+				refresh()
+			}
+		}
+	}
+}
+
+// repl runs interactive mode until user quits
+func repl(cfg *client.Config) {
+	editor := newLineEditor()
+	defer editor.close()
+
+	prompt := cfg.Address + "> "
+	c, err := client.Dial(cfg)
+	if err != nil {
+		fmt.Printf("Could not connect to MyGodis at %s: %v\n", cfg.Address, err)
+		prompt = "not connected> "
+	}
+	for {
+		line, err := editor.readLine(prompt)
+		if err == errInterrupted {
+			continue
+		} else if err != nil {
+			break
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		editor.addHistory(line)
+		if lower := strings.ToLower(line); lower == "quit" || lower == "exit" {
+			break
+		}
+		args, err := parser.SplitArgs(line)
+		if err != nil {
+			fmt.Println("Invalid argument(s)")
+			continue
+		}
+		// repeat command like redis-cli: 3 ping
+		repeat := 1
+		if n, err := strconv.Atoi(string(args[0])); err == nil && len(args) > 1 && n > 0 {
+			repeat = n
+			args = args[1:]
+		}
+		if isStreamCommand(args) {
+			if err := streamMode(cfg, args, false); err != nil {
+				fmt.Printf("(error) %v\n", err)
+			}
+			continue
+		}
+		if c == nil || c.Err() != nil {
+			if c, err = client.Dial(cfg); err != nil {
+				c = nil
+				fmt.Printf("Could not connect to MyGodis at %s: %v\n", cfg.Address, err)
+				prompt = "not connected> "
+				continue
+			}
+			prompt = cfg.Address + "> "
+		}
+		for i := 0; i < repeat; i++ {
+			reply, err := c.Do(args)
+			if err != nil {
+				fmt.Printf("(error) %v\n", err)
+				break
+			}
+			fmt.Print(formatReply(reply, 0))
+		}
+	}
+	if c != nil {
+		c.Close()
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"github.com/atomwqh/MyGodis/lib/utils"
+	"github.com/atomwqh/MyGodis/redis/client"
+	"github.com/atomwqh/MyGodis/redis/parser"
+	"github.com/atomwqh/MyGodis/redis/protocol"
+)
+
+// SUBSCRIBE 和 MONITOR 之后服务端不断推送消息, 一个请求对应多个 reply, 不能用 pipeline 的 client.Client 处理.
+// 这些命令使用单独的连接, 打印收到的每个 reply, 直到 Ctrl-C 或连接断开
+
+// streamCommands are commands after which server keeps sending replies
+var streamCommands = map[string]struct{}{
+	"subscribe": {}, "psubscribe": {}, "ssubscribe": {}, "monitor": {},
+}
+
+func isStreamCommand(args [][]byte) bool {
+	if len(args) == 0 {
+		return false
+	}
+	_, ok := streamCommands[strings.ToLower(string(args[0]))]
+	return ok
+}
+
+// handshake returns HELLO and AUTH commands sent before args, like client.Dial does
+func handshake(cfg *client.Config) [][][]byte {
+	if cfg.Protocol == protocol.RESP3 {
+		hello := []string{"HELLO", strconv.Itoa(cfg.Protocol)}
+		if cfg.Password != "" {
+			username := cfg.Username
+			if username == "" {
+				username = "default"
+			}
+			hello = append(hello, "AUTH", username, cfg.Password)
+		}
+		return [][][]byte{utils.ToCmdLine(hello...)}
+	}
+	if cfg.Password == "" {
+		return nil
+	}
+	if cfg.Username != "" {
+		return [][][]byte{utils.ToCmdLine("AUTH", cfg.Username, cfg.Password)}
+	}
+	return [][][]byte{utils.ToCmdLine("AUTH", cfg.Password)}
+}
+
+// streamMode sends args on a new connection and prints replies until interrupted or disconnected
+func streamMode(cfg *client.Config, args [][]byte, rawOutput bool) error {
+	network := cfg.Network
+	if network == "" {
+		network = "tcp"
+	}
+	conn, err := net.DialTimeout(network, cfg.Address, cfg.DialTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	reader := parser.NewReader(conn)
+	for _, cmdLine := range handshake(cfg) {
+		if _, err = conn.Write(protocol.MakeMultiBulkReply(cmdLine).ToBytes()); err != nil {
+			return err
+		}
+		reply, err := reader.Next()
+		if err != nil {
+			return err
+		}
+		if errReply, ok := reply.(protocol.ErrorReply); ok {
+			return errors.New(errReply.Error())
+		}
+	}
+	if _, err = conn.Write(protocol.MakeMultiBulkReply(args).ToBytes()); err != nil {
+		return err
+	}
+
+	// Ctrl-C stops reading and returns to prompt instead of killing the cli
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		select {
+		case <-interrupt:
+			_ = conn.Close()
+		case <-stopped:
+		}
+	}()
+
+	if !rawOutput {
+		fmt.Println("Reading messages... (press Ctrl-C to quit)")
+	}
+	for {
+		reply, err := reader.Next()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				// closed by Ctrl-C
+				return nil
+			}
+			return err
+		}
+		fmt.Print(render(reply, rawOutput))
+		if _, ok := reply.(protocol.ErrorReply); ok {
+			return nil
+		}
+	}
+}
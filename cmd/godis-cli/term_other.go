@@ -0,0 +1,19 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// isTerminal returns whether fd is a terminal
+func isTerminal(fd int) bool {
+	info, err := os.NewFile(uintptr(fd), "").Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// makeRaw is not supported on this platform, lines are read without editing
+func makeRaw(fd int) (func(), error) {
+	return nil, errors.New("raw mode is not supported")
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atomwqh/MyGodis/config"
+	"github.com/atomwqh/MyGodis/interface/database"
+	"github.com/atomwqh/MyGodis/lib/logger"
+	"github.com/atomwqh/MyGodis/redis/acl"
+	"github.com/atomwqh/MyGodis/redis/server"
+	"github.com/atomwqh/MyGodis/tcp"
+)
+
+/*
+godis-server starts MyGodis like redis-server
+
+	godis-server [/path/to/redis.conf] [--name value ...]
+
+options on command line override the config file, e.g. godis-server redis.conf --port 7000 --bind 127.0.0.1 ::1
+SIGTERM and SIGINT shut the server down gracefully, SIGHUP reopens the log file and reloads tls certificates.
+*/
+
+const banner = `
+   ______          ___
+  / ____/___  ____/ (_)____
+ / / __/ __ \/ __  / / ___/
+/ /_/ / /_/ / /_/ / (__  )
+\____/\____/\__,_/_/____/
+`
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: godis-server [/path/to/redis.conf] [options]
+       godis-server -v or --version
+       godis-server -h or --help
+
+Examples:
+       godis-server (run the server with default config)
+       godis-server /etc/godis/6379.conf
+       godis-server --port 7777
+       godis-server /etc/mygodis.conf --timeout 300 --maxclients 100
+`)
+}
+
+// loggerSettings maps logfile path onto logger.Settings, a date is inserted into file name by logger
+func loggerSettings(logFile string) *logger.Settings {
+	ext := filepath.Ext(logFile)
+	name := strings.TrimSuffix(filepath.Base(logFile), ext)
+	return &logger.Settings{
+		Path:       filepath.Dir(logFile),
+		Name:       name,
+		Ext:        strings.TrimPrefix(ext, "."),
+		TimeFormat: "2006-01-02",
+	}
+}
+
+func tlsSettings(props *config.ServerProperties) *tcp.TLSConfig {
+	return &tcp.TLSConfig{
+		Address:     props.TLSAddress(),
+		CertFile:    props.TLSCertFile,
+		KeyFile:     props.TLSKeyFile,
+		CAFile:      props.TLSCACertFile,
+		AuthClients: props.TLSAuthClients,
+	}
+}
+
+func writePidFile(filename string) error {
+	return os.WriteFile(filename, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644)
+}
+
+func main() {
+	os.Exit(run())
+}
+
+// openDB returns the storage engine served by handler. There is no storage engine in this tree yet,
+// so the handler serves connection level commands and replies unknown command to the rest.
+// The DB is closed by handler.Close on shutdown, which is where an engine flushes its persistence
+func openDB(props *config.ServerProperties) (database.DB, error) {
+	return nil, nil
+}
+
+// run starts the server and returns the exit code, deferred cleanups such as removing pid file run before exit
+func run() int {
+	args := os.Args[1:]
+	if len(args) > 0 {
+		switch args[0] {
+		case "-v", "--version":
+			fmt.Printf("MyGodis server v=%s\n", server.Version)
+			return 0
+		case "-h", "--help":
+			usage()
+			return 0
+		}
+	}
+	configFile := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "--") {
+		configFile = args[0]
+		args = args[1:]
+	}
+	if err := config.Setup(configFile, config.ArgsToOptions(args)); err != nil {
+		fmt.Fprintf(os.Stderr, "*** FATAL CONFIG FILE ERROR ***\n%v\n", err)
+		return 1
+	}
+	props := config.Get()
+	// relative paths in config, such as pidfile and logfile, are relative to dir like redis
+	if err := os.Chdir(props.Dir); err != nil {
+		fmt.Fprintf(os.Stderr, "Can't chdir to '%s': %v\n", props.Dir, err)
+		return 1
+	}
+	if props.LogFile != "" {
+		logger.Setup(loggerSettings(props.LogFile))
+	}
+	fmt.Print(banner)
+	if configFile == "" {
+		logger.Warn("no config file specified, using the default config")
+	}
+	if props.PidFile != "" {
+		if err := writePidFile(props.PidFile); err != nil {
+			logger.Warnf("failed to write pid file %s: %v", props.PidFile, err)
+		} else {
+			defer os.Remove(props.PidFile)
+		}
+	}
+
+	// requirepass sets the password of default user, users in aclfile are loaded after it
+	acl.SetRequirePass(props.RequirePass)
+	if props.ACLFile != "" {
+		if err := acl.LoadFile(props.ACLFile); err != nil {
+			logger.Error("failed to load acl file: " + err.Error())
+			time.Sleep(100 * time.Millisecond)
+			return 1
+		}
+	}
+	requirePass := props.RequirePass
+
+	db, err := openDB(props)
+	if err != nil {
+		logger.Error("failed to open db: " + err.Error())
+		time.Sleep(100 * time.Millisecond)
+		return 1
+	}
+	handler := server.MakeHandler(db)
+	tcpConfig := &tcp.Config{
+		Timeout:    time.Duration(props.Timeout) * time.Second,
+		MaxConn:    props.MaxClients,
+		ExtraHosts: props.ExtraBinds(),
+		OnHangup:   logger.Reopen,
+
+		Netpoll:        props.Netpoll,
+		NetpollWorkers: props.NetpollWorkers,
+	}
+	// port 0 disables the plain tcp listener like redis
+	if props.Port != 0 {
+		tcpConfig.Address = props.Address()
+	}
+	if props.UnixSocket != "" {
+		tcpConfig.UnixSocket = props.UnixSocket
+		tcpConfig.UnixSocketPerm = os.FileMode(props.UnixSocketPerm)
+	}
+	if props.TLSPort != 0 {
+		tcpConfig.TLS = tlsSettings(props)
+	}
+	config.Watch(func(props *config.ServerProperties) error {
+		tcpConfig.SetLimits(props.MaxClients, time.Duration(props.Timeout)*time.Second)
+		if props.RequirePass != requirePass {
+			requirePass = props.RequirePass
+			acl.SetRequirePass(requirePass)
+		}
+		current := tcpConfig.TLSSettings()
+		if current == nil {
+			return nil
+		}
+		if settings := tlsSettings(props); *settings != *current {
+			return tcpConfig.ReloadTLS(settings)
+		}
+		return nil
+	})
+	if props.MetricsPort != 0 {
+		go serveMetrics(props.MetricsAddress(), handler)
+	}
+	// SIGTERM and SIGINT close handler, which closes db, before ListenAndServeWithSignal returns
+	if err = tcp.ListenAndServeWithSignal(tcpConfig, handler); err != nil {
+		logger.Error(err)
+		_ = handler.Close()
+		// wait for logger to print the error
+		time.Sleep(100 * time.Millisecond)
+		return 1
+	}
+	logger.Info("MyGodis is now ready to exit, bye bye...")
+	time.Sleep(100 * time.Millisecond)
+	return 0
+}
+
+// serveMetrics exports metrics for Prometheus, server keeps running if it fails
+func serveMetrics(addr string, handler *server.Handler) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", handler.ServeMetrics)
+	logger.Info("serving metrics on http://" + addr + "/metrics")
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		logger.Error("metrics server stopped: " + err.Error())
+	}
+}
@@ -0,0 +1,537 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/atomwqh/MyGodis/lib/wildcard"
+	"github.com/atomwqh/MyGodis/redis/parser"
+)
+
+/*
+ * 配置文件使用 redis.conf 的格式: 每行一条指令, 指令名后跟参数, # 开头的行是注释, include 引入其它文件
+ * 字段的 cfg tag 是指令名, tag 中的 mutable 表示允许通过 CONFIG SET 修改, memory 表示可以使用 1gb 这样的单位,
+ * octal 表示八进制的整数 (例如文件权限), signed 表示允许负数. 有特殊语法的参数实现 Value 接口
+ */
+
+// ServerProperties defines global config properties
+type ServerProperties struct {
+	Bind []string `cfg:"bind"`
+	Port int      `cfg:"port"`
+	// UnixSocket is the path of unix socket to listen on, empty means disabled
+	UnixSocket     string `cfg:"unixsocket"`
+	UnixSocketPerm int    `cfg:"unixsocketperm,octal"`
+	MaxClients     int    `cfg:"maxclients,mutable"`
+	// Timeout closes idle connections after seconds, 0 means never
+	Timeout   int `cfg:"timeout,mutable"`
+	Databases int `cfg:"databases"`
+	// Netpoll serves tcp connections by epoll event loop on linux
+	Netpoll        bool   `cfg:"netpoll"`
+	NetpollWorkers int    `cfg:"netpoll-workers"`
+	Dir            string `cfg:"dir"`
+	// LogFile is the path of log file, empty means stdout
+	LogFile string `cfg:"logfile"`
+	PidFile string `cfg:"pidfile"`
+
+	AppendOnly     bool   `cfg:"appendonly"`
+	AppendFilename string `cfg:"appendfilename"`
+	AppendFsync    string `cfg:"appendfsync,mutable"`
+	DBFilename     string `cfg:"dbfilename,mutable"`
+
+	// RequirePass is the password of default ACL user, empty means nopass
+	RequirePass string `cfg:"requirepass,mutable"`
+	// ACLFile stores ACL users, it is loaded at startup and by ACL LOAD, written by ACL SAVE
+	ACLFile      string `cfg:"aclfile"`
+	ACLLogMaxLen int    `cfg:"acllog-max-len,mutable"`
+
+	ClientOutputBufferLimit OutputBufferLimits `cfg:"client-output-buffer-limit,mutable"`
+
+	// LazyfreeLazyExpire frees values of expired keys in background
+	LazyfreeLazyExpire bool `cfg:"lazyfree-lazy-expire,mutable"`
+
+	// MaxMemory limits memory of keys, 0 means no limit
+	MaxMemory        int64          `cfg:"maxmemory,mutable,memory"`
+	MaxMemoryPolicy  EvictionPolicy `cfg:"maxmemory-policy,mutable"`
+	MaxMemorySamples int            `cfg:"maxmemory-samples,mutable"`
+	LFULogFactor     int            `cfg:"lfu-log-factor,mutable"`
+	// LFUDecayTime is in minutes, 0 means LFU counters never decay
+	LFUDecayTime int `cfg:"lfu-decay-time,mutable"`
+
+	// TLSPort enables TLS listener if it is not 0, certificates are reloaded after they are changed
+	TLSPort        int    `cfg:"tls-port"`
+	TLSCertFile    string `cfg:"tls-cert-file,mutable"`
+	TLSKeyFile     string `cfg:"tls-key-file,mutable"`
+	TLSCACertFile  string `cfg:"tls-ca-cert-file,mutable"`
+	TLSAuthClients string `cfg:"tls-auth-clients,mutable"`
+
+	// SlowlogLogSlowerThan is in microseconds, negative disables slow log and 0 logs every command
+	SlowlogLogSlowerThan int64 `cfg:"slowlog-log-slower-than,mutable,signed"`
+	SlowlogMaxLen        int   `cfg:"slowlog-max-len,mutable"`
+	// LatencyMonitorThreshold is in milliseconds, 0 disables latency monitor
+	LatencyMonitorThreshold int64 `cfg:"latency-monitor-threshold,mutable"`
+
+	// HotkeysTopK is the number of most accessed keys reported by HOTKEYS, 0 disables counting accesses.
+	// The sketch takes about 1KB per key, so it is limited
+	HotkeysTopK int `cfg:"hotkeys-top-k,mutable,max=10000"`
+
+	// MetricsPort serves Prometheus metrics on http://metrics-bind:metrics-port/metrics, 0 means disabled
+	MetricsBind string `cfg:"metrics-bind"`
+	MetricsPort int    `cfg:"metrics-port"`
+
+	ProtoMaxBulkLen      int64 `cfg:"proto-max-bulk-len,mutable,memory"`
+	ProtoMaxMultiBulkLen int64 `cfg:"proto-max-multibulk-len,mutable"`
+	ProtoInlineMaxSize   int   `cfg:"proto-inline-max-size,mutable,memory"`
+}
+
+func defaultProperties() *ServerProperties {
+	return &ServerProperties{
+		Bind:           []string{"127.0.0.1"},
+		Port:           6379,
+		MaxClients:     10000,
+		Databases:      16,
+		Dir:            ".",
+		AppendFilename: "appendonly.aof",
+		AppendFsync:    "everysec",
+		DBFilename:     "dump.rdb",
+		TLSAuthClients: "yes",
+		ACLLogMaxLen:   128,
+		MetricsBind:    "127.0.0.1",
+
+		SlowlogLogSlowerThan: 10000,
+		SlowlogMaxLen:        128,
+		HotkeysTopK:          16,
+
+		ClientOutputBufferLimit: defaultOutputBufferLimits(),
+		MaxMemorySamples:        5,
+		LFULogFactor:            10,
+		LFUDecayTime:            1,
+		ProtoMaxBulkLen:         512 * 1024 * 1024,
+		ProtoMaxMultiBulkLen:    1024 * 1024,
+		ProtoInlineMaxSize:      64 * 1024,
+	}
+}
+
+// ProtoLimits returns limits of requests
+func (p *ServerProperties) ProtoLimits() parser.Limits {
+	return parser.Limits{
+		MaxBulkLen:      p.ProtoMaxBulkLen,
+		MaxMultiBulkLen: p.ProtoMaxMultiBulkLen,
+		MaxInlineSize:   p.ProtoInlineMaxSize,
+	}
+}
+
+// Address returns the address of the first bind address, ExtraBinds returns the others
+func (p *ServerProperties) Address() string {
+	return p.address(p.Port)
+}
+
+// ExtraBinds returns bind addresses except the first one, they listen on the same ports
+func (p *ServerProperties) ExtraBinds() []string {
+	if len(p.Bind) <= 1 {
+		return nil
+	}
+	return p.Bind[1:]
+}
+
+// TLSAddress returns the address of TLS listener
+func (p *ServerProperties) TLSAddress() string {
+	return p.address(p.TLSPort)
+}
+
+// MetricsAddress returns the address of http server exporting metrics
+func (p *ServerProperties) MetricsAddress() string {
+	return net.JoinHostPort(p.MetricsBind, strconv.Itoa(p.MetricsPort))
+}
+
+func (p *ServerProperties) address(port int) string {
+	host := ""
+	if len(p.Bind) > 0 {
+		host = p.Bind[0]
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// param describes a field of ServerProperties
+type param struct {
+	name    string
+	index   int
+	mutable bool
+	memory  bool
+	octal   bool
+	signed  bool
+	max     int64 // upper bound of integer params, 0 means unlimited
+}
+
+var (
+	params     []*param
+	paramTable = make(map[string]*param)
+)
+
+func init() {
+	t := reflect.TypeOf(ServerProperties{})
+	for i := 0; i < t.NumField(); i++ {
+		tag, ok := t.Field(i).Tag.Lookup("cfg")
+		if !ok {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		p := &param{name: parts[0], index: i}
+		for _, opt := range parts[1:] {
+			switch opt {
+			case "mutable":
+				p.mutable = true
+			case "memory":
+				p.memory = true
+			case "octal":
+				p.octal = true
+			case "signed":
+				p.signed = true
+			default:
+				if strings.HasPrefix(opt, "max=") {
+					max, err := strconv.ParseInt(opt[len("max="):], 10, 64)
+					if err != nil {
+						panic("invalid max of config " + p.name)
+					}
+					p.max = max
+				}
+			}
+		}
+		params = append(params, p)
+		paramTable[p.name] = p
+	}
+	properties.Store(defaultProperties())
+}
+
+var (
+	properties atomic.Value // *ServerProperties
+	// configFile is the file loaded by Setup, used by Rewrite
+	configFile string
+	// mu serializes writers of properties, readers never block
+	mu sync.Mutex
+	// watchers are notified after CONFIG SET
+	watchers []func(props *ServerProperties) error
+)
+
+// Watch registers fn which is called with new properties after they are changed by Set,
+// modules that cache params use it to apply changes at runtime.
+// If fn returns error, CONFIG SET fails and the old properties are given to watchers again.
+func Watch(fn func(props *ServerProperties) error) {
+	mu.Lock()
+	defer mu.Unlock()
+	watchers = append(watchers, fn)
+}
+
+// Get returns current properties, the result must not be modified
+func Get() *ServerProperties {
+	return properties.Load().(*ServerProperties)
+}
+
+// File returns the absolute path of config file, it is empty if server runs without config file
+func File() string {
+	mu.Lock()
+	defer mu.Unlock()
+	return configFile
+}
+
+// Setup loads config file and makes it the global properties.
+// options are config lines applied after the file, like the command line options of redis-server.
+// filename may be empty if server runs without config file.
+func Setup(filename string, options string) error {
+	props := defaultProperties()
+	if filename != "" {
+		abs, err := filepath.Abs(filename)
+		if err != nil {
+			return err
+		}
+		// CONFIG REWRITE still works after changing working directory
+		filename = abs
+		if err = load(props, filename, 0); err != nil {
+			return err
+		}
+	}
+	if err := parse(props, options, "command line", 0); err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	configFile = filename
+	properties.Store(props)
+	return nil
+}
+
+// Update changes properties by fn, fn receives a copy of current properties.
+// It is used to apply command line options over config file
+func Update(fn func(props *ServerProperties)) {
+	mu.Lock()
+	defer mu.Unlock()
+	props := *Get()
+	fn(&props)
+	properties.Store(&props)
+}
+
+// parseMemory parses size like redis memtoll: 1k = 1000, 1kb = 1024, units are case insensitive
+func parseMemory(s string) (int64, error) {
+	lower := strings.ToLower(s)
+	units := []struct {
+		suffix string
+		mul    int64
+	}{
+		{"kb", 1024}, {"mb", 1024 * 1024}, {"gb", 1024 * 1024 * 1024},
+		{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000},
+		{"b", 1},
+	}
+	mul := int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(lower, unit.suffix) {
+			lower = strings.TrimSuffix(lower, unit.suffix)
+			mul = unit.mul
+			break
+		}
+	}
+	n, err := strconv.ParseInt(lower, 10, 64)
+	if err != nil {
+		return 0, errors.New("argument must be a memory value")
+	}
+	return n * mul, nil
+}
+
+// Value is implemented by params which have their own syntax
+type Value interface {
+	Set(args []string) error
+	String() string
+}
+
+// setValue parses args and stores them into field of props
+func (p *param) setValue(props *ServerProperties, args []string) error {
+	field := reflect.ValueOf(props).Elem().Field(p.index)
+	if v, ok := field.Addr().Interface().(Value); ok {
+		return v.Set(args)
+	}
+	if field.Kind() == reflect.Slice {
+		field.Set(reflect.ValueOf(append([]string{}, args...)))
+		return nil
+	}
+	if len(args) != 1 {
+		return errors.New("wrong number of arguments")
+	}
+	value := args[0]
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int, reflect.Int64:
+		var n int64
+		var err error
+		if p.memory {
+			n, err = parseMemory(value)
+		} else if p.octal {
+			if n, err = strconv.ParseInt(value, 8, 64); err != nil {
+				err = errors.New("argument couldn't be parsed into an octal integer")
+			}
+		} else if n, err = strconv.ParseInt(value, 10, 64); err != nil {
+			err = errors.New("argument couldn't be parsed into an integer")
+		}
+		if err != nil {
+			return err
+		}
+		if n < 0 && !p.signed {
+			return errors.New("argument must be greater than or equal to 0")
+		}
+		if p.max > 0 && n > p.max {
+			return errors.New("argument must be less than or equal to " + strconv.FormatInt(p.max, 10))
+		}
+		field.SetInt(n)
+	case reflect.Bool:
+		switch strings.ToLower(value) {
+		case "yes":
+			field.SetBool(true)
+		case "no":
+			field.SetBool(false)
+		default:
+			return errors.New("argument must be 'yes' or 'no'")
+		}
+	}
+	return nil
+}
+
+// getValue formats the field of props like CONFIG GET
+func (p *param) getValue(props *ServerProperties) string {
+	field := reflect.ValueOf(props).Elem().Field(p.index)
+	if v, ok := field.Addr().Interface().(Value); ok {
+		return v.String()
+	}
+	switch field.Kind() {
+	case reflect.Slice:
+		return strings.Join(field.Interface().([]string), " ")
+	case reflect.Int, reflect.Int64:
+		if p.octal {
+			return strconv.FormatInt(field.Int(), 8)
+		}
+		return strconv.FormatInt(field.Int(), 10)
+	case reflect.Bool:
+		if field.Bool() {
+			return "yes"
+		}
+		return "no"
+	}
+	return field.String()
+}
+
+// GetParams returns names and values of params matching glob pattern
+func GetParams(pattern string) (names []string, values []string) {
+	props := Get()
+	for _, p := range params {
+		if wildcard.MatchFold(pattern, p.name) {
+			names = append(names, p.name)
+			values = append(values, p.getValue(props))
+		}
+	}
+	return
+}
+
+// Set changes params at runtime, args are name value pairs.
+// Either all params are changed or none of them is changed.
+func Set(args []string) error {
+	if len(args) == 0 || len(args)%2 != 0 {
+		return errors.New("wrong number of arguments")
+	}
+	old := Get()
+	props, fns, err := set(args)
+	if err != nil {
+		return err
+	}
+	// call watchers without lock, so they can read config
+	for i, fn := range fns {
+		if err := fn(props); err != nil {
+			mu.Lock()
+			if Get() == props {
+				properties.Store(old)
+			}
+			mu.Unlock()
+			for _, applied := range fns[:i] {
+				_ = applied(old)
+			}
+			return errors.New("CONFIG SET failed - " + err.Error())
+		}
+	}
+	return nil
+}
+
+func set(args []string) (*ServerProperties, []func(props *ServerProperties) error, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	props := *Get()
+	seen := make(map[string]struct{})
+	for i := 0; i < len(args); i += 2 {
+		name := strings.ToLower(args[i])
+		p, ok := paramTable[name]
+		if !ok || !p.mutable {
+			return nil, nil, fmt.Errorf("Unknown option or number of arguments for CONFIG SET - '%s'", args[i])
+		}
+		if _, ok := seen[name]; ok {
+			return nil, nil, fmt.Errorf("Duplicate parameter - '%s'", args[i])
+		}
+		seen[name] = struct{}{}
+		if err := p.setValue(&props, []string{args[i+1]}); err != nil {
+			return nil, nil, fmt.Errorf("CONFIG SET failed (possibly related to argument '%s') - %s", args[i], err.Error())
+		}
+	}
+	properties.Store(&props)
+	return &props, watchers, nil
+}
+
+// IsMutable returns whether param can be changed by CONFIG SET
+func IsMutable(name string) bool {
+	p, ok := paramTable[strings.ToLower(name)]
+	return ok && p.mutable
+}
+
+// splitLine splits a line of config file, it returns nil for blank lines and comments
+func splitLine(line string) ([]string, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || line[0] == '#' {
+		return nil, nil
+	}
+	args, err := parser.SplitArgs(line)
+	if err != nil {
+		return nil, errors.New("unbalanced quotes in configuration line")
+	}
+	result := make([]string, len(args))
+	for i, arg := range args {
+		result[i] = string(arg)
+	}
+	return result, nil
+}
+
+// maxIncludeDepth prevents include loop
+const maxIncludeDepth = 16
+
+// Load parses config file, params not in the file keep their default value
+func Load(filename string) (*ServerProperties, error) {
+	props := defaultProperties()
+	if err := load(props, filename, 0); err != nil {
+		return nil, err
+	}
+	return props, nil
+}
+
+func load(props *ServerProperties, filename string, depth int) error {
+	if depth > maxIncludeDepth {
+		return fmt.Errorf("too many nested includes in %s", filename)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	return parse(props, string(data), filename, depth)
+}
+
+// parse applies config lines in content, source is used in error message
+func parse(props *ServerProperties, content string, source string, depth int) error {
+	for i, line := range strings.Split(content, "\n") {
+		args, err := splitLine(line)
+		if err == nil && len(args) > 0 {
+			name := strings.ToLower(args[0])
+			if name == "include" {
+				if len(args) != 2 {
+					err = errors.New("wrong number of arguments")
+				} else {
+					// relative path is relative to working directory like redis
+					err = load(props, args[1], depth+1)
+				}
+			} else if p, ok := paramTable[name]; ok {
+				err = p.setValue(props, args[1:])
+			} else {
+				err = errors.New("bad directive or wrong number of arguments")
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s:%d: %s: %s", source, i+1, strings.TrimSpace(line), err.Error())
+		}
+	}
+	return nil
+}
+
+// ArgsToOptions converts command line arguments like "--port 7000 --bind 127.0.0.1 ::1" into config lines
+func ArgsToOptions(args []string) string {
+	var buf strings.Builder
+	for i, arg := range args {
+		if strings.HasPrefix(arg, "--") {
+			if i > 0 {
+				buf.WriteByte('\n')
+			}
+			buf.WriteString(arg[2:])
+		} else {
+			buf.WriteByte(' ')
+			buf.WriteString(quoteArg(arg))
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	included := filepath.Join(dir, "included.conf")
+	main := filepath.Join(dir, "redis.conf")
+	_ = os.WriteFile(included, []byte("databases 4\nappendonly yes\n"), 0644)
+	_ = os.WriteFile(main, []byte(`# comment
+bind 127.0.0.1 ::1
+port 7000
+
+include `+included+`
+maxclients 100
+dir "/tmp/my dir"
+proto-max-bulk-len 1mb
+`), 0644)
+	props, err := Load(main)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(props.Bind) != 2 || props.Bind[1] != "::1" || props.Port != 7000 || props.Address() != "127.0.0.1:7000" ||
+		len(props.ExtraBinds()) != 1 || props.ExtraBinds()[0] != "::1" {
+		t.Errorf("wrong bind or port: %v %d", props.Bind, props.Port)
+	}
+	if props.Databases != 4 || !props.AppendOnly || props.MaxClients != 100 {
+		t.Errorf("wrong included params: %+v", props)
+	}
+	if props.Dir != "/tmp/my dir" || props.ProtoMaxBulkLen != 1024*1024 {
+		t.Errorf("wrong dir or bulk len: %s %d", props.Dir, props.ProtoMaxBulkLen)
+	}
+
+	_ = os.WriteFile(main, []byte("port 7000\nno-such-param 1\n"), 0644)
+	if _, err = Load(main); err == nil || !strings.Contains(err.Error(), ":2:") {
+		t.Errorf("expect error at line 2, got %v", err)
+	}
+	_ = os.WriteFile(main, []byte("include "+main+"\n"), 0644)
+	if _, err = Load(main); err == nil {
+		t.Error("expect include loop error")
+	}
+}
+
+func TestGetSet(t *testing.T) {
+	names, values := GetParams("maxc*")
+	if len(names) != 1 || names[0] != "maxclients" || values[0] != "10000" {
+		t.Errorf("wrong result of maxc*: %v %v", names, values)
+	}
+	if err := Set([]string{"maxclients", "5", "timeout", "10"}); err != nil {
+		t.Fatal(err)
+	}
+	if Get().MaxClients != 5 || Get().Timeout != 10 {
+		t.Error("params are not changed")
+	}
+	// port is not mutable, nothing should be changed
+	if err := Set([]string{"maxclients", "6", "port", "1"}); err == nil {
+		t.Error("expect error for immutable param")
+	}
+	if Get().MaxClients != 5 {
+		t.Error("failed CONFIG SET should not change anything")
+	}
+	if err := Set([]string{"timeout", "abc"}); err == nil {
+		t.Error("expect error for invalid integer")
+	}
+	if err := Set([]string{"timeout", "-1"}); err == nil {
+		t.Error("expect error for negative integer")
+	}
+	if err := Set([]string{"hotkeys-top-k", "10001"}); err == nil {
+		t.Error("expect error for integer exceeding max")
+	}
+	if err := Set([]string{"slowlog-log-slower-than", "-1"}); err != nil || Get().SlowlogLogSlowerThan != -1 {
+		t.Errorf("signed param should accept negative integer: %v", err)
+	}
+	if err := Set([]string{"client-output-buffer-limit", "pubsub 64mb 16mb 30 slave 0 0 0"}); err != nil {
+		t.Fatal(err)
+	}
+	if limits := Get().ClientOutputBufferLimit; limits[ClassPubSub].Hard != 64<<20 || limits[ClassReplica].Hard != 0 {
+		t.Errorf("wrong client-output-buffer-limit: %s", limits.String())
+	}
+	if err := Set([]string{"client-output-buffer-limit", "normal 1mb"}); err == nil {
+		t.Error("expect error for incomplete limits")
+	}
+	// watcher refuses the change, old value should be restored
+	Watch(func(props *ServerProperties) error {
+		if props.TLSCertFile == "bad.crt" {
+			return errors.New("bad certificate")
+		}
+		return nil
+	})
+	if err := Set([]string{"maxclients", "7", "tls-cert-file", "bad.crt"}); err == nil {
+		t.Error("expect error from watcher")
+	}
+	if Get().MaxClients != 5 || Get().TLSCertFile != "" {
+		t.Error("params should be restored after watcher failed")
+	}
+	Update(func(props *ServerProperties) {
+		*props = *defaultProperties()
+	})
+}
+
+func TestRewrite(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "redis.conf")
+	_ = os.WriteFile(filename, []byte("# my config\nport 7000\nmaxclients 100\n\nmaxclients 200\ntimeout    3\n"), 0600)
+	if err := Setup(filename, ""); err != nil {
+		t.Fatal(err)
+	}
+	defer Update(func(props *ServerProperties) {
+		*props = *defaultProperties()
+	})
+	if err := Set([]string{"maxclients", "300", "requirepass", "my pass"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Rewrite(); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(filename)
+	expected := "# my config\nport 7000\nmaxclients 300\n\ntimeout    3\n" + rewriteSignature + "\nrequirepass \"my pass\"\n"
+	if string(data) != expected {
+		t.Errorf("wrong rewrite result:\n%s", data)
+	}
+	if info, _ := os.Stat(filename); info.Mode().Perm() != 0600 {
+		t.Errorf("file mode changed: %v", info.Mode())
+	}
+	props, err := Load(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if props.MaxClients != 300 || props.RequirePass != "my pass" || props.Timeout != 3 {
+		t.Errorf("wrong params after rewrite: %+v", props)
+	}
+}
+
+func TestArgsToOptions(t *testing.T) {
+	options := ArgsToOptions([]string{"--port", "7000", "--bind", "127.0.0.1", "::1", "--requirepass", "my pass"})
+	expected := "port 7000\nbind 127.0.0.1 ::1\nrequirepass \"my pass\""
+	if options != expected {
+		t.Errorf("expect %q, actual %q", expected, options)
+	}
+}
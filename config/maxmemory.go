@@ -0,0 +1,49 @@
+package config
+
+import (
+	"errors"
+	"strings"
+)
+
+// maxmemory-policy
+const (
+	NoEviction = EvictionPolicy(iota)
+	AllKeysLRU
+	AllKeysLFU
+	AllKeysRandom
+	VolatileLRU
+	VolatileLFU
+	VolatileRandom
+	VolatileTTL
+)
+
+var policyNames = []string{
+	"noeviction", "allkeys-lru", "allkeys-lfu", "allkeys-random",
+	"volatile-lru", "volatile-lfu", "volatile-random", "volatile-ttl",
+}
+
+// EvictionPolicy decides which keys are evicted when used memory exceeds maxmemory
+type EvictionPolicy int
+
+// Set parses policy name, names are case insensitive
+func (p *EvictionPolicy) Set(args []string) error {
+	if len(args) != 1 {
+		return errors.New("wrong number of arguments")
+	}
+	for i, name := range policyNames {
+		if strings.EqualFold(args[0], name) {
+			*p = EvictionPolicy(i)
+			return nil
+		}
+	}
+	return errors.New("argument(s) must be one of the following: " + strings.Join(policyNames, ", "))
+}
+
+func (p *EvictionPolicy) String() string {
+	return policyNames[*p]
+}
+
+// Volatile returns whether only keys with expiration are evicted
+func (p EvictionPolicy) Volatile() bool {
+	return p >= VolatileLRU
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// client classes of client-output-buffer-limit
+const (
+	ClassNormal = iota
+	ClassReplica
+	ClassPubSub
+)
+
+var classNames = []string{"normal", "replica", "pubsub"}
+
+// OutputBufferLimit limits the output buffer of a client class, 0 means no limit.
+// Client is disconnected if buffer exceeds Hard, or exceeds Soft for SoftSeconds continuously.
+type OutputBufferLimit struct {
+	Hard        int64
+	Soft        int64
+	SoftSeconds int
+}
+
+// OutputBufferLimits is client-output-buffer-limit indexed by client class
+type OutputBufferLimits [3]OutputBufferLimit
+
+func defaultOutputBufferLimits() OutputBufferLimits {
+	return OutputBufferLimits{
+		ClassNormal:  {},
+		ClassReplica: {Hard: 256 * 1024 * 1024, Soft: 64 * 1024 * 1024, SoftSeconds: 60},
+		ClassPubSub:  {Hard: 32 * 1024 * 1024, Soft: 8 * 1024 * 1024, SoftSeconds: 60},
+	}
+}
+
+// Set parses "<class> <hard> <soft> <soft seconds>" groups, classes not mentioned are not changed
+func (l *OutputBufferLimits) Set(args []string) error {
+	fields := strings.Fields(strings.Join(args, " "))
+	if len(fields) == 0 || len(fields)%4 != 0 {
+		return errors.New("wrong number of arguments")
+	}
+	result := *l
+	for i := 0; i < len(fields); i += 4 {
+		class := -1
+		for j, name := range classNames {
+			if strings.EqualFold(fields[i], name) {
+				class = j
+			}
+		}
+		if strings.EqualFold(fields[i], "slave") {
+			class = ClassReplica
+		}
+		if class < 0 {
+			return errors.New("invalid client class " + fields[i])
+		}
+		hard, err := parseMemory(fields[i+1])
+		if err != nil {
+			return err
+		}
+		soft, err := parseMemory(fields[i+2])
+		if err != nil {
+			return err
+		}
+		seconds, err := strconv.Atoi(fields[i+3])
+		if err != nil || hard < 0 || soft < 0 || seconds < 0 {
+			return errors.New("invalid limits")
+		}
+		result[class] = OutputBufferLimit{Hard: hard, Soft: soft, SoftSeconds: seconds}
+	}
+	*l = result
+	return nil
+}
+
+func (l *OutputBufferLimits) String() string {
+	parts := make([]string, 0, len(l)*4)
+	for class, limit := range l {
+		parts = append(parts, classNames[class],
+			strconv.FormatInt(limit.Hard, 10),
+			strconv.FormatInt(limit.Soft, 10),
+			strconv.Itoa(limit.SoftSeconds))
+	}
+	return strings.Join(parts, " ")
+}
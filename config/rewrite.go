@@ -0,0 +1,169 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// CONFIG REWRITE 只改写主配置文件: 保留注释和未知的行, 已有的指令原地替换, 重复的指令只保留第一条,
+// 文件中没有的参数追加在 rewriteSignature 之后
+
+const rewriteSignature = "# Generated by CONFIG REWRITE"
+
+// quoteArg quotes arg if it can't be read back as it is
+func quoteArg(arg string) string {
+	if arg == "" {
+		return `""`
+	}
+	needQuote := false
+	for i := 0; i < len(arg); i++ {
+		c := arg[i]
+		if c <= ' ' || c >= 0x7f || c == '"' || c == '\'' || c == '\\' || (i == 0 && c == '#') {
+			needQuote = true
+			break
+		}
+	}
+	if !needQuote {
+		return arg
+	}
+	var buf strings.Builder
+	buf.WriteByte('"')
+	for i := 0; i < len(arg); i++ {
+		c := arg[i]
+		switch c {
+		case '\\', '"':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if c < ' ' || c >= 0x7f {
+				buf.WriteString(`\x`)
+				buf.WriteString(strconv.FormatInt(int64(c)>>4, 16))
+				buf.WriteString(strconv.FormatInt(int64(c)&0xf, 16))
+			} else {
+				buf.WriteByte(c)
+			}
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// formatLine makes the config line of param
+func (p *param) formatLine(props *ServerProperties) string {
+	field := reflect.ValueOf(props).Elem().Field(p.index)
+	if v, ok := field.Addr().Interface().(Value); ok {
+		// Value formats itself in config syntax
+		return p.name + " " + v.String()
+	}
+	if field.Kind() == reflect.Slice {
+		args := []string{p.name}
+		for _, arg := range field.Interface().([]string) {
+			args = append(args, quoteArg(arg))
+		}
+		return strings.Join(args, " ")
+	}
+	return p.name + " " + quoteArg(p.getValue(props))
+}
+
+// lineValue returns the value set by a config line, it returns empty string if args are invalid
+func (p *param) lineValue(args []string) string {
+	props := defaultProperties()
+	if err := p.setValue(props, args); err != nil {
+		return ""
+	}
+	return p.getValue(props)
+}
+
+// Rewrite writes current properties into the config file loaded by Setup
+func Rewrite() error {
+	mu.Lock()
+	defer mu.Unlock()
+	if configFile == "" {
+		return errors.New("The server is running without a config file")
+	}
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return err
+	}
+	// what the file says now, params set by included files are only rewritten if they are changed
+	loaded, err := Load(configFile)
+	if err != nil {
+		loaded = defaultProperties()
+	}
+	props := Get()
+
+	var lines []string
+	written := make(map[string]struct{})
+	signed := false
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		if strings.TrimSpace(line) == rewriteSignature {
+			signed = true
+		}
+		args, err := splitLine(line)
+		if err != nil || len(args) == 0 {
+			lines = append(lines, line)
+			continue
+		}
+		p, ok := paramTable[strings.ToLower(args[0])]
+		if !ok {
+			lines = append(lines, line)
+			continue
+		}
+		if _, ok := written[p.name]; ok {
+			// duplicated directive, the first one has been rewritten
+			continue
+		}
+		written[p.name] = struct{}{}
+		if p.lineValue(args[1:]) == p.getValue(props) {
+			// keep the original format if the line still sets the current value
+			lines = append(lines, line)
+		} else {
+			lines = append(lines, p.formatLine(props))
+		}
+	}
+	for _, p := range params {
+		if _, ok := written[p.name]; ok || p.getValue(props) == p.getValue(loaded) {
+			continue
+		}
+		if !signed {
+			lines = append(lines, rewriteSignature)
+			signed = true
+		}
+		lines = append(lines, p.formatLine(props))
+	}
+	content := strings.Join(lines, "\n") + "\n"
+
+	// write to temp file and rename, so config file is never half written
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(configFile); err == nil {
+		perm = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(configFile), "temp-config-*.conf")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.WriteString(content); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), configFile)
+}
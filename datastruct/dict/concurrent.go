@@ -225,6 +225,27 @@ func (dict *ConcurrentDict) Keys() []string {
 	return keys
 }
 
+// ScanKeys 从第 cursor 个 shard 开始返回至少 count 个 key (最后一批可能更少) 和下一次的 cursor, cursor 为 0 表示遍历结束.
+// 每次只在读锁内复制一个 shard 的 key, 两次调用之间不持有锁, 遍历期间新增或删除的 key 可能被遗漏, 但不会重复
+func (dict *ConcurrentDict) ScanKeys(cursor int, count int) ([]string, int) {
+	if cursor < 0 || cursor >= len(dict.table) {
+		return nil, 0
+	}
+	keys := make([]string, 0, count)
+	for ; cursor < len(dict.table) && len(keys) < count; cursor++ {
+		s := dict.table[cursor]
+		s.mutex.RLock()
+		for key := range s.m {
+			keys = append(keys, key)
+		}
+		s.mutex.RUnlock()
+	}
+	if cursor == len(dict.table) {
+		cursor = 0
+	}
+	return keys, cursor
+}
+
 // 返回一个随机 key
 func (shard *shard) RandonKey() string {
 	if shard == nil {
@@ -297,9 +318,27 @@ func (dict *ConcurrentDict) RandomDistinctKeys(limit int) []string {
 	return arr
 }
 
-// 清空 dict
+// 清空 dict, 每个 shard 在自己的锁内换成空 map, 不会影响并发的读写
 func (dict *ConcurrentDict) Clear() {
-	*dict = *MakeConcurrent(dict.shardCount)
+	dict.Detach()
+}
+
+// Detach 把所有 key 移到一个新的 dict 并返回, 原 dict 变为空. 只替换每个 shard 的 map, 耗时与 key 的数量无关,
+// 返回的 dict 可以交给后台慢慢释放
+func (dict *ConcurrentDict) Detach() *ConcurrentDict {
+	detached := &ConcurrentDict{
+		table:      make([]*shard, len(dict.table)),
+		shardCount: dict.shardCount,
+	}
+	for i, s := range dict.table {
+		s.mutex.Lock()
+		detached.table[i] = &shard{m: s.m}
+		detached.count += int32(len(s.m))
+		atomic.AddInt32(&dict.count, -int32(len(s.m)))
+		s.m = make(map[string]interface{})
+		s.mutex.Unlock()
+	}
+	return detached
 }
 
 // 字符串转正则表达式匹配
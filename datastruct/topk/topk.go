@@ -0,0 +1,217 @@
+package topk
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// TopK 用 count-min sketch 估算每个 key 的访问次数, 再用大小为 k 的小顶堆保留次数最多的 key.
+// 估算值只会偏大不会偏小. 总次数每达到 decayWindow 时所有计数减半, 所以结果反映的是最近的访问.
+// 每次 Add 计算一次 fnv 并原子地更新 depth 个计数器, 不分配内存; 已在堆中的 key 只原子地更新计数, 不加锁,
+// 只有可能进入堆的新 key 才加锁并用 O(k) 重建堆. 内存约为每个 k 1KB
+
+const (
+	depth    = 4
+	minWidth = 1024
+	// maxWidth limits counters to 64MB however large k is
+	maxWidth = 1 << 22
+)
+
+// Item is a key and its estimated count
+type Item struct {
+	Key   string
+	Count uint32
+}
+
+type entry struct {
+	key   string
+	count uint32 // accessed by sync/atomic, it is updated without lock so heap may be out of order
+	index int
+}
+
+// minHeap of entries ordered by count
+type minHeap []*entry
+
+func (h minHeap) Len() int { return len(h) }
+func (h minHeap) Less(i, j int) bool {
+	return atomic.LoadUint32(&h[i].count) < atomic.LoadUint32(&h[j].count)
+}
+func (h minHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *minHeap) Push(x interface{}) {
+	e := x.(*entry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *minHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+// TopK finds the most frequent keys, it is safe for concurrent use
+type TopK struct {
+	k     int
+	width uint32
+	// counters has depth rows of width counters, accessed by sync/atomic
+	counters    []uint32
+	total       uint64
+	decayWindow uint64
+
+	mu   sync.Mutex
+	heap minHeap
+	// index is key -> *entry of keys in heap, it is changed with mu held and read without lock
+	index sync.Map
+	// min is the smallest count in heap when heap is full, otherwise 0
+	min uint32
+}
+
+// New creates a TopK keeping k keys, callers should limit k since memory grows with it
+func New(k int) *TopK {
+	width := minWidth
+	if k > minWidth/64 {
+		width = maxWidth
+		if k < maxWidth/64 {
+			width = k * 64
+		}
+	}
+	return &TopK{
+		k:           k,
+		width:       uint32(width),
+		counters:    make([]uint32, depth*width),
+		decayWindow: uint64(width) * 64,
+	}
+}
+
+// fnv64a is fnv-1a of key without allocation
+func fnv64a(key string) uint64 {
+	hash := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint64(key[i])
+		hash *= 1099511628211
+	}
+	return hash
+}
+
+// K returns the max number of keys kept
+func (t *TopK) K() int {
+	return t.k
+}
+
+// Total returns the number of adds since last decay, halved by each decay
+func (t *TopK) Total() uint64 {
+	return atomic.LoadUint64(&t.total)
+}
+
+// Add counts an access of key
+func (t *TopK) Add(key string) {
+	sum := fnv64a(key)
+	h1, h2 := uint32(sum), uint32(sum>>32)
+	var est uint32
+	for i := uint32(0); i < depth; i++ {
+		pos := i*t.width + (h1+i*h2)%t.width
+		n := atomic.AddUint32(&t.counters[pos], 1)
+		if i == 0 || n < est {
+			est = n
+		}
+	}
+	if atomic.AddUint64(&t.total, 1)%t.decayWindow == 0 {
+		t.decay()
+	}
+	if v, ok := t.index.Load(key); ok {
+		// hot key in heap, heap is fixed when a new key enters
+		atomic.StoreUint32(&v.(*entry).count, est)
+		return
+	}
+	// a key in heap has count not less than min, so key can't be in heap
+	if est < atomic.LoadUint32(&t.min) {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if v, ok := t.index.Load(key); ok {
+		atomic.StoreUint32(&v.(*entry).count, est)
+		return
+	}
+	if len(t.heap) < t.k {
+		e := &entry{key: key, count: est}
+		heap.Push(&t.heap, e)
+		t.index.Store(key, e)
+		if len(t.heap) == t.k {
+			// counts of keys in heap have been increased without lock
+			heap.Init(&t.heap)
+		}
+	} else {
+		heap.Init(&t.heap)
+		if old := t.heap[0]; est > atomic.LoadUint32(&old.count) {
+			t.index.Delete(old.key)
+			e := &entry{key: key, count: est}
+			t.heap[0] = e
+			heap.Fix(&t.heap, 0)
+			t.index.Store(key, e)
+		}
+	}
+	t.updateMin()
+}
+
+func (t *TopK) updateMin() {
+	min := uint32(0)
+	if len(t.heap) >= t.k {
+		min = atomic.LoadUint32(&t.heap[0].count)
+	}
+	atomic.StoreUint32(&t.min, min)
+}
+
+// decay halves all counts, increments during decay may be lost which is acceptable for estimation
+func (t *TopK) decay() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := range t.counters {
+		atomic.StoreUint32(&t.counters[i], atomic.LoadUint32(&t.counters[i])/2)
+	}
+	atomic.StoreUint64(&t.total, atomic.LoadUint64(&t.total)/2)
+	for _, e := range t.heap {
+		atomic.StoreUint32(&e.count, atomic.LoadUint32(&e.count)/2)
+	}
+	t.updateMin()
+}
+
+// List returns keys sorted by count in descending order
+func (t *TopK) List() []Item {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	items := make([]Item, len(t.heap))
+	for i, e := range t.heap {
+		items[i] = Item{Key: e.key, Count: atomic.LoadUint32(&e.count)}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Count != items[j].Count {
+			return items[i].Count > items[j].Count
+		}
+		return items[i].Key < items[j].Key
+	})
+	return items
+}
+
+// Reset forgets all counts
+func (t *TopK) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := range t.counters {
+		atomic.StoreUint32(&t.counters[i], 0)
+	}
+	atomic.StoreUint64(&t.total, 0)
+	for _, e := range t.heap {
+		t.index.Delete(e.key)
+	}
+	t.heap = nil
+	t.updateMin()
+}
@@ -8,6 +8,8 @@ import (
 type CmdLine = [][]byte
 
 type DB interface {
+	// Exec executes cmdLine. Arguments of write commands belong to DB, arguments of read only commands
+	// are reused by the server after Exec returns, DB must copy them if it keeps them, e.g. queued by MULTI
 	Exec(client redis.Connection, cmdLine [][]byte) redis.Reply
 	AfterClientClose(c redis.Connection)
 	Close()
@@ -25,6 +27,8 @@ type DBEngine interface {
 	ExecMulti(conn redis.Connection, watching map[string]uint32, cmdLines []CmdLine) redis.Reply
 	GetUndoLogs(dbIndex int, cmdLine [][]byte) redis.Reply
 	ForEach(dbIndex int, cb func(key string, data *DataEntity, expiration *time.Time) bool)
+	// ScanKeys returns keys from cursor and the next cursor, 0 means the end, see dict.ConcurrentDict.ScanKeys
+	ScanKeys(dbIndex int, cursor int, count int) ([]string, int)
 	RWLocks(dbIndex int, writeKeys []string, readKeys []string)
 	RWUnlocks(dbIndex int, writeKeys []string, readKeys []string)
 	GetDBSize(dbIndex int) (int, int)
@@ -34,6 +38,27 @@ type DBEngine interface {
 	SetKeyDeletedCallback(cb KeyEventCallback)
 }
 
-type DataEntity struct {
-	Data interface{}
+// Stats are keyspace counters reported by INFO
+type Stats struct {
+	KeyspaceHits   int64
+	KeyspaceMisses int64
+	ExpiredKeys    int64
+}
+
+// StatsReporter is implemented by DB which counts keyspace events
+type StatsReporter interface {
+	GetStats() Stats
+}
+
+// PersistenceStats is the state of RDB and AOF reported by INFO
+type PersistenceStats struct {
+	Loading              bool
+	RDBSaveInProgress    bool
+	RDBLastSaveTime      time.Time // zero means never saved
+	AOFRewriteInProgress bool
+}
+
+// PersistenceReporter is implemented by DB which persists data
+type PersistenceReporter interface {
+	GetPersistenceStats() PersistenceStats
 }
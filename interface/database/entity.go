@@ -0,0 +1,156 @@
+package database
+
+import (
+	"math/rand"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/atomwqh/MyGodis/config"
+	"github.com/atomwqh/MyGodis/datastruct/dict"
+	"github.com/atomwqh/MyGodis/datastruct/list"
+	"github.com/atomwqh/MyGodis/datastruct/set"
+)
+
+// DataEntity 除了数据本身还记录淘汰策略需要的访问信息: LRU 时钟是最近一次访问的秒级时间戳,
+// LFU 计数器与 redis 一样只有 8 位, 按对数增长并且每 lfu-decay-time 分钟衰减 1.
+// 读命令只持有读锁, 所以访问信息通过 sync/atomic 读写. OBJECT 命令通过 Idle, Freq 和 Encoding 查看这些信息
+
+// LFUInitVal is the LFU counter of new keys, so they are not evicted before they have a chance to be accessed
+const LFUInitVal = 5
+
+const lfuMaxVal = 255
+
+// DataEntity stores data bound to a key, including a string, list, hash, set and so on
+type DataEntity struct {
+	// size is the memory accounted for the entity, it is placed first to be 64-bit aligned
+	size int64
+	Data interface{}
+	// access is unix seconds of the last access
+	access uint32
+	// lfu is last decrement time in minutes (16 bits) << 8 | counter, 0 means never accessed
+	lfu uint32
+}
+
+// Touch updates access metadata, it should be called when the key is inserted and every time it is read or written.
+// The first Touch sets LFU counter to LFUInitVal like creating a key in redis
+func (e *DataEntity) Touch() {
+	now := time.Now()
+	atomic.StoreUint32(&e.access, uint32(now.Unix()))
+	counter := uint8(LFUInitVal)
+	if atomic.LoadUint32(&e.lfu) != 0 {
+		counter = lfuLogIncr(e.lfuCounter(now))
+	}
+	atomic.StoreUint32(&e.lfu, lfuMinutes(now)<<8|uint32(counter))
+}
+
+// Idle returns the time since the last access
+func (e *DataEntity) Idle() time.Duration {
+	access := atomic.LoadUint32(&e.access)
+	if access == 0 {
+		return 0
+	}
+	idle := time.Now().Unix() - int64(access)
+	if idle < 0 {
+		return 0
+	}
+	return time.Duration(idle) * time.Second
+}
+
+// Freq returns the LFU counter after decay, it does not change the entity
+func (e *DataEntity) Freq() uint8 {
+	return e.lfuCounter(time.Now())
+}
+
+// Type returns the type of data like TYPE command
+func (e *DataEntity) Type() string {
+	switch e.Data.(type) {
+	case []byte:
+		return "string"
+	case *list.QuickList:
+		return "list"
+	case *set.Set:
+		return "set"
+	case *dict.SimpleDict, *dict.ConcurrentDict:
+		return "hash"
+	}
+	return "unknown"
+}
+
+// embstrSizeLimit is the max length of strings in embstr encoding of redis
+const embstrSizeLimit = 44
+
+// Encoding returns the name of internal representation of data like OBJECT ENCODING
+func (e *DataEntity) Encoding() string {
+	switch data := e.Data.(type) {
+	case []byte:
+		if len(data) <= 20 {
+			if _, err := strconv.ParseInt(string(data), 10, 64); err == nil {
+				return "int"
+			}
+		}
+		if len(data) <= embstrSizeLimit {
+			return "embstr"
+		}
+		return "raw"
+	case *list.QuickList:
+		return "quicklist"
+	case *set.Set, *dict.SimpleDict, *dict.ConcurrentDict:
+		return "hashtable"
+	}
+	return "unknown"
+}
+
+// SwapSize sets the memory accounted for the entity and returns the old one
+func (e *DataEntity) SwapSize(size int64) int64 {
+	return atomic.SwapInt64(&e.size, size)
+}
+
+// Size returns the memory accounted for the entity
+func (e *DataEntity) Size() int64 {
+	return atomic.LoadInt64(&e.size)
+}
+
+// lfuMinutes returns the LFU clock in minutes, it wraps around every 45 days like redis
+func lfuMinutes(now time.Time) uint32 {
+	return uint32(now.Unix()/60) & 0xffff
+}
+
+// lfuCounter returns the counter decayed by lfu-decay-time
+func (e *DataEntity) lfuCounter(now time.Time) uint8 {
+	lfu := atomic.LoadUint32(&e.lfu)
+	if lfu == 0 {
+		return LFUInitVal
+	}
+	counter := uint8(lfu & 0xff)
+	decayTime := config.Get().LFUDecayTime
+	if decayTime <= 0 {
+		return counter
+	}
+	last, current := lfu>>8, lfuMinutes(now)
+	elapsed := current - last
+	if current < last {
+		elapsed = 0xffff - last + current
+	}
+	periods := int(elapsed) / decayTime
+	if periods >= int(counter) {
+		return 0
+	}
+	return counter - uint8(periods)
+}
+
+// lfuLogIncr increases counter with probability 1/((counter-LFUInitVal)*lfu-log-factor+1)
+func lfuLogIncr(counter uint8) uint8 {
+	if counter == lfuMaxVal {
+		return counter
+	}
+	base := float64(counter) - LFUInitVal
+	if base < 0 {
+		base = 0
+	}
+	p := 1.0 / (base*float64(config.Get().LFULogFactor) + 1)
+	if rand.Float64() < p {
+		counter++
+	}
+	return counter
+}
@@ -0,0 +1,20 @@
+package redis
+
+// Connection represents a connection with redis client
+type Connection interface {
+	Write([]byte) (int, error)
+	Close() error
+	RemoteAddr() string
+
+	// GetDBIndex returns the index of selected db
+	GetDBIndex() int
+	SelectDB(int)
+
+	// GetProtocol returns the RESP version negotiated by HELLO, 2 by default
+	GetProtocol() int
+	SetProtocol(int)
+
+	// GetUser returns the ACL user authenticated by AUTH or HELLO, empty means not authenticated
+	GetUser() string
+	SetUser(string)
+}
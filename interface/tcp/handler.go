@@ -11,3 +11,28 @@ type Handler interface {
 	Handle(ctx context.Context, conn net.Conn)
 	Close() error
 }
+
+// EventHandler is a Handler which can also be driven by an event loop, so connections don't need their own goroutines.
+// OnOpen, OnData and OnClose of the same connection are never called concurrently.
+type EventHandler interface {
+	Handler
+	// OnOpen is called after a connection is accepted, the result is passed to OnData and OnClose
+	OnOpen(conn net.Conn) interface{}
+	// OnData handles received data and returns the number of bytes consumed,
+	// bytes not consumed are passed again with more data. Connection is closed if err is not nil.
+	OnData(session interface{}, data []byte) (int, error)
+	// OnClose is called after the connection is closed
+	OnClose(session interface{})
+}
+
+// IdleExemptConn is implemented by connections passed to Handler.
+// Handler exempts clients which are expected to be quiet, such as subscribers and monitors, from the idle timeout
+type IdleExemptConn interface {
+	SetIdleExempt(exempt bool)
+}
+
+// ResumableConn is implemented by connections of event loop.
+// Handler calls Resume to get OnData called again with data not consumed, e.g. after a paused command may run
+type ResumableConn interface {
+	Resume()
+}
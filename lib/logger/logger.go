@@ -5,7 +5,6 @@ import (
 	"io"
 	"log"
 	"os"
-	"path"
 	"path/filepath"
 	"runtime"
 	"sync"
@@ -49,6 +48,8 @@ type Logger struct {
 	logger    *log.Logger
 	entryChan chan *logEntry
 	entryPool *sync.Pool
+	// reopenChan asks writing goroutine to reopen log file, it is nil for stdout logger
+	reopenChan chan struct{}
 }
 
 var DefaultLogger = MakeStdoutLogger()
@@ -94,28 +95,64 @@ func NewFileLogger(settings *Settings) (*Logger, error) {
 				return &logEntry{}
 			},
 		},
+		reopenChan: make(chan struct{}, 1),
+	}
+	// failedName is the file failed to open, it is not retried for every entry
+	failedName := ""
+	// switch to logFileName, reopen it even if the name is not changed when force is true
+	switchFile := func(logFileName string, force bool) {
+		// same as the name built by mustOpen
+		if !force && (settings.Path+string(os.PathSeparator)+logFileName == logger.logFile.Name() || logFileName == failedName) {
+			return
+		}
+		logFile, err := mustOpen(logFileName, settings.Path)
+		if err != nil {
+			// keep writing to the old file rather than crashing the server
+			fmt.Fprintf(os.Stderr, "open log %s failed: %v\n", logFileName, err)
+			failedName = logFileName
+			return
+		}
+		failedName = ""
+		_ = logger.logFile.Close()
+		logger.logFile = logFile
+		logger.logger = log.New(io.MultiWriter(os.Stdout, logFile), "", flags)
 	}
 	go func() {
-		for e := range logger.entryChan {
-			logFileName := fmt.Sprintf("%s-%s.%s",
-				settings.Name,
-				time.Now().Format(settings.TimeFormat),
-				settings.Ext)
-			if path.Join(settings.Path, logFileName) != logger.logFile.Name() {
-				logFile, err := mustOpen(logFileName, settings.Path)
-				if err != nil {
-					panic("open log " + logFileName + " failed: " + err.Error())
-				}
-				logger.logFile = logFile
-				logger.logger = log.New(io.MultiWriter(os.Stdout, logFile), "", flags)
+		for {
+			select {
+			case e := <-logger.entryChan:
+				switchFile(fmt.Sprintf("%s-%s.%s",
+					settings.Name,
+					time.Now().Format(settings.TimeFormat),
+					settings.Ext), false)
+				_ = logger.logger.Output(0, e.msg)
+				logger.entryPool.Put(e)
+			case <-logger.reopenChan:
+				// log file may have been moved by logrotate
+				switchFile(filepath.Base(logger.logFile.Name()), true)
 			}
-			_ = logger.logger.Output(0, e.msg)
-			logger.entryPool.Put(e)
 		}
 	}()
 	return logger, nil
 }
 
+// Reopen closes and opens log file again, it does nothing if logger prints to stdout only
+func (l *Logger) Reopen() {
+	if l.reopenChan == nil {
+		return
+	}
+	select {
+	case l.reopenChan <- struct{}{}:
+	default:
+		// a reopen is pending
+	}
+}
+
+// Reopen reopens log file of DefaultLogger
+func Reopen() {
+	DefaultLogger.Reopen()
+}
+
 // Setup init DefaultLogger
 func Setup(settings *Settings) {
 	logger, err := NewFileLogger(settings)
@@ -0,0 +1,20 @@
+package utils
+
+// ToCmdLine convert strings to [][]byte
+func ToCmdLine(cmd ...string) [][]byte {
+	args := make([][]byte, len(cmd))
+	for i, s := range cmd {
+		args[i] = []byte(s)
+	}
+	return args
+}
+
+// ToCmdLine2 convert commandName and string-type argument to [][]byte
+func ToCmdLine2(commandName string, args ...string) [][]byte {
+	result := make([][]byte, len(args)+1)
+	result[0] = []byte(commandName)
+	for i, s := range args {
+		result[i+1] = []byte(s)
+	}
+	return result
+}
@@ -0,0 +1,100 @@
+package wildcard
+
+// 与 redis stringmatchlen 相同的 glob 匹配规则:
+// * 匹配任意字符串, ? 匹配单个字符, [abc] [^abc] [a-z] 匹配字符集合, \ 转义下一个字符
+
+// Match returns whether s matches glob pattern
+func Match(pattern string, s string) bool {
+	return match(pattern, s, false)
+}
+
+// MatchFold is Match ignoring ASCII case
+func MatchFold(pattern string, s string) bool {
+	return match(pattern, s, true)
+}
+
+func lower(c byte, fold bool) byte {
+	if fold && c >= 'A' && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+func match(pattern string, s string, fold bool) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if match(pattern[1:], s[i:], fold) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[1:]
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			pattern = pattern[1:]
+			not := len(pattern) > 0 && pattern[0] == '^'
+			if not {
+				pattern = pattern[1:]
+			}
+			matched := false
+			for len(pattern) > 0 && pattern[0] != ']' {
+				if pattern[0] == '\\' && len(pattern) >= 2 {
+					if pattern[1] == s[0] {
+						matched = true
+					}
+					pattern = pattern[2:]
+				} else if len(pattern) >= 3 && pattern[1] == '-' {
+					start, end := lower(pattern[0], fold), lower(pattern[2], fold)
+					if start > end {
+						start, end = end, start
+					}
+					c := lower(s[0], fold)
+					if c >= start && c <= end {
+						matched = true
+					}
+					pattern = pattern[3:]
+				} else {
+					if lower(pattern[0], fold) == lower(s[0], fold) {
+						matched = true
+					}
+					pattern = pattern[1:]
+				}
+			}
+			if len(pattern) > 0 {
+				// skip ']'
+				pattern = pattern[1:]
+			}
+			if matched == not {
+				return false
+			}
+			s = s[1:]
+		case '\\':
+			if len(pattern) >= 2 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || lower(pattern[0], fold) != lower(s[0], fold) {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[1:]
+		}
+	}
+	return len(s) == 0
+}
@@ -0,0 +1,190 @@
+package acl
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/atomwqh/MyGodis/redis/parser"
+)
+
+/*
+ * ACL 用户保存在进程内, 修改用户时先复制再替换, 检查权限时不需要加锁.
+ * 连接只记录用户名, 每条命令都重新查找用户, 所以 ACL SETUSER 对已经登录的连接立即生效
+ */
+
+// DefaultUser is used by AUTH <password> and new connections, it can't be deleted
+const DefaultUser = "default"
+
+var (
+	mu    sync.RWMutex
+	users = map[string]*User{DefaultUser: newDefaultUser()}
+)
+
+// GetUser returns the user named name, or nil if it doesn't exist
+func GetUser(name string) *User {
+	mu.RLock()
+	defer mu.RUnlock()
+	return users[name]
+}
+
+// Users returns all users sorted by name
+func Users() []*User {
+	mu.RLock()
+	defer mu.RUnlock()
+	result := make([]*User, 0, len(users))
+	for _, u := range users {
+		result = append(result, u)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// SetUser creates or modifies user by rules, user is not changed if any rule is invalid
+func SetUser(name string, rules []string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	u, err := buildUser(users[name], name, rules)
+	if err != nil {
+		return err
+	}
+	users[name] = u
+	return nil
+}
+
+func buildUser(old *User, name string, rules []string) (*User, error) {
+	if strings.ContainsAny(name, " \t\r\n") || name == "" {
+		return nil, errors.New("Usernames can't contain spaces or null characters")
+	}
+	var u *User
+	if old != nil {
+		u = old.clone()
+	} else {
+		u = newUser(name)
+	}
+	for _, rule := range rules {
+		if err := u.applyRule(rule); err != nil {
+			return nil, fmt.Errorf("Error in ACL SETUSER modifier '%s': %s", rule, err.Error())
+		}
+	}
+	return u, nil
+}
+
+// DelUsers deletes users and returns the number of deleted users
+func DelUsers(names []string) (int, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, name := range names {
+		if name == DefaultUser {
+			return 0, errors.New("The 'default' user cannot be removed")
+		}
+	}
+	deleted := 0
+	for _, name := range names {
+		if _, ok := users[name]; ok {
+			delete(users, name)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Authenticate returns whether password is correct for the enabled user
+func Authenticate(name string, password string) bool {
+	u := GetUser(name)
+	return u != nil && u.Enabled && u.checkPassword(password)
+}
+
+// AutoLogin returns the user of a new connection, it is the default user if it needs no password, otherwise empty
+func AutoLogin() string {
+	u := GetUser(DefaultUser)
+	if u != nil && u.Enabled && u.NoPass {
+		return DefaultUser
+	}
+	return ""
+}
+
+// SetRequirePass sets the only password of default user like config requirepass, empty means nopass
+func SetRequirePass(password string) {
+	rule := "nopass"
+	if password != "" {
+		rule = ">" + password
+	}
+	_ = SetUser(DefaultUser, []string{"resetpass", rule})
+}
+
+// LoadFile replaces all users by the users in file, nothing is changed if file has any error.
+// The default user is kept if file doesn't mention it.
+func LoadFile(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	loaded := make(map[string]*User)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		lineErr := func(msg string) error {
+			return fmt.Errorf("%s:%d: %s", filename, i+1, msg)
+		}
+		raw, err := parser.SplitArgs(line)
+		if err != nil {
+			return lineErr(err.Error())
+		}
+		args := make([]string, len(raw))
+		for j, arg := range raw {
+			args[j] = string(arg)
+		}
+		if len(args) < 2 || args[0] != "user" {
+			return lineErr("should start with user keyword followed by the username")
+		}
+		name := args[1]
+		if _, ok := loaded[name]; ok {
+			return lineErr("duplicate user '" + name + "' found")
+		}
+		u, err := buildUser(nil, name, args[2:])
+		if err != nil {
+			return lineErr(err.Error())
+		}
+		loaded[name] = u
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := loaded[DefaultUser]; !ok {
+		loaded[DefaultUser] = users[DefaultUser]
+	}
+	users = loaded
+	return nil
+}
+
+// SaveFile writes all users into file, the file is replaced atomically
+func SaveFile(filename string) error {
+	var buf strings.Builder
+	for _, u := range Users() {
+		buf.WriteString(u.Describe())
+		buf.WriteByte('\n')
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "temp-acl-*.acl")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.WriteString(buf.String()); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
@@ -0,0 +1,126 @@
+package acl
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/atomwqh/MyGodis/lib/utils"
+)
+
+func TestCheck(t *testing.T) {
+	defer func() { _, _ = DelUsers([]string{"alice"}) }()
+	err := SetUser("alice", []string{"on", ">secret", "~team:*", "&news.*", "+@all", "-@dangerous", "+config|get"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := GetUser("alice")
+	tests := []struct {
+		cmdLine string
+		reason  string
+	}{
+		{"get team:a", ""},
+		{"get other", "key"},
+		{"mset team:a 1 team:b 2", ""},
+		{"mset team:a 1 other 2", "key"},
+		{"zunionstore team:dst 2 team:a other", "key"},
+		{"flushall", "command"},
+		{"config get maxclients", ""},
+		{"config set maxclients 1", "command"},
+		{"publish news.sport hi", ""},
+		{"publish other hi", "channel"},
+		{"psubscribe news.*", ""},
+		{"psubscribe news.s*", "channel"},
+		{"unknowncmd team:a", "command"},
+	}
+	for _, tt := range tests {
+		denied := u.Check(utils.ToCmdLine(strings.Fields(tt.cmdLine)...))
+		reason := ""
+		if denied != nil {
+			reason = denied.Reason
+		}
+		if reason != tt.reason {
+			t.Errorf("%s: expect %q, actual %q", tt.cmdLine, tt.reason, reason)
+		}
+	}
+
+	if !Authenticate("alice", "secret") || Authenticate("alice", "wrong") {
+		t.Error("wrong result of authentication")
+	}
+	// the last matching rule wins
+	if err = SetUser("alice", []string{"-config", "off"}); err != nil {
+		t.Fatal(err)
+	}
+	if GetUser("alice").Check(utils.ToCmdLine("config", "get", "port")) == nil {
+		t.Error("-config should override +config|get")
+	}
+	if Authenticate("alice", "secret") {
+		t.Error("disabled user should not be authenticated")
+	}
+	// user is unchanged if any rule is invalid
+	if err = SetUser("alice", []string{"on", "+nosuchcmd"}); err == nil {
+		t.Error("expect error for unknown command")
+	}
+	if GetUser("alice").Enabled {
+		t.Error("failed ACL SETUSER should not change user")
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	if s := GetUser(DefaultUser).Describe(); s != "user default on nopass ~* &* +@all" {
+		t.Errorf("unexpected default user %q", s)
+	}
+	u, err := buildUser(nil, "bob", []string{"on", "#" + hashPassword("pw"), "~a:*", "-@all", "+get"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "user bob on #" + hashPassword("pw") + " ~a:* resetchannels -@all +get"
+	if s := u.Describe(); s != expect {
+		t.Errorf("expect %q, actual %q", expect, s)
+	}
+}
+
+func TestFile(t *testing.T) {
+	defer func() { _, _ = DelUsers([]string{"carol"}) }()
+	filename := filepath.Join(t.TempDir(), "users.acl")
+	if err := SetUser("carol", []string{"on", ">pw", "~c:*", "+get"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DelUsers([]string{"carol"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	if !Authenticate("carol", "pw") {
+		t.Error("user should be loaded from file")
+	}
+
+	// invalid file changes nothing
+	_ = os.WriteFile(filename, []byte("user dave on\nuser dave off\n"), 0600)
+	if err := LoadFile(filename); err == nil || !strings.Contains(err.Error(), ":2:") {
+		t.Errorf("expect error at line 2, actual %v", err)
+	}
+	if GetUser("dave") != nil || GetUser("carol") == nil {
+		t.Error("failed ACL LOAD should not change users")
+	}
+}
+
+func TestLog(t *testing.T) {
+	ResetLog()
+	AddLog("auth", "AUTH", "eve", "addr=1")
+	AddLog("auth", "AUTH", "eve", "addr=2")
+	AddLog("key", "k", "eve", "addr=2")
+	entries := Logs(-1)
+	if len(entries) != 2 || entries[0].Reason != "key" || entries[1].Count != 2 {
+		t.Errorf("unexpected log %+v", entries)
+	}
+	ResetLog()
+	if len(Logs(-1)) != 0 {
+		t.Error("log should be empty after reset")
+	}
+}
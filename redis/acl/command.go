@@ -0,0 +1,502 @@
+package acl
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 命令表记录每个命令所属的 ACL 分类, 以及哪些参数是 key 或 channel, 与 redis 7.0 的 COMMAND INFO 一致.
+// 容器命令 (例如 config, client) 的子命令可以单独登记, 查找时优先使用 "命令|子命令"
+
+// command categories, the bit of a category is 1 << index
+var categoryNames = []string{
+	"keyspace", "read", "write", "set", "sortedset", "list", "hash", "string", "bitmap", "hyperloglog",
+	"geo", "stream", "pubsub", "admin", "fast", "slow", "blocking", "dangerous", "connection", "transaction",
+	"scripting",
+}
+
+// categoryFlag returns the bit of category name, 0 means unknown
+func categoryFlag(name string) uint32 {
+	for i, n := range categoryNames {
+		if n == name {
+			return 1 << i
+		}
+	}
+	return 0
+}
+
+// how arguments of a command are checked against channel patterns
+const (
+	channelNone = iota
+	channelFirst
+	channelAll
+	// patterns of PSUBSCRIBE must be equal to a pattern of user, or user has allchannels
+	channelPatterns
+)
+
+type commandSpec struct {
+	name       string
+	categories uint32
+	// positions of keys in command line (command name is 0), lastKey < 0 counts from the end
+	firstKey, lastKey, keyStep int
+	// extraKeys finds keys which can't be described by firstKey and lastKey, may be nil
+	extraKeys func(args [][]byte) []int
+	channels  int
+	// container commands have subcommands, such as CONFIG GET
+	container bool
+}
+
+// keyPositions returns the positions of keys in cmdLine
+func (spec *commandSpec) keyPositions(cmdLine [][]byte) []int {
+	var positions []int
+	if spec.firstKey > 0 {
+		last := spec.lastKey
+		if last < 0 {
+			last = len(cmdLine) + last
+		}
+		for i := spec.firstKey; i <= last && i < len(cmdLine); i += spec.keyStep {
+			positions = append(positions, i)
+		}
+	}
+	if spec.extraKeys != nil {
+		positions = append(positions, spec.extraKeys(cmdLine)...)
+	}
+	return positions
+}
+
+var commandTable = make(map[string]*commandSpec)
+
+// register adds a command to commandTable, categories are separated by space
+func register(name string, categories string, firstKey, lastKey, keyStep int) *commandSpec {
+	spec := &commandSpec{name: name, firstKey: firstKey, lastKey: lastKey, keyStep: keyStep}
+	for _, cat := range strings.Fields(categories) {
+		flag := categoryFlag(cat)
+		if flag == 0 {
+			panic("unknown acl category " + cat)
+		}
+		spec.categories |= flag
+	}
+	commandTable[name] = spec
+	return spec
+}
+
+// numKeys returns extraKeys for commands like ZUNION which have numkeys at pos followed by keys
+func numKeys(pos int) func(args [][]byte) []int {
+	return func(args [][]byte) []int {
+		if pos >= len(args) {
+			return nil
+		}
+		n, err := strconv.Atoi(string(args[pos]))
+		if err != nil || n <= 0 || pos+n >= len(args) {
+			return nil
+		}
+		positions := make([]int, n)
+		for i := range positions {
+			positions[i] = pos + 1 + i
+		}
+		return positions
+	}
+}
+
+// keysAfter returns extraKeys for options like "STORE key"
+func keysAfter(options ...string) func(args [][]byte) []int {
+	return func(args [][]byte) []int {
+		var positions []int
+		for i := 1; i < len(args)-1; i++ {
+			for _, opt := range options {
+				if strings.EqualFold(string(args[i]), opt) {
+					positions = append(positions, i+1)
+				}
+			}
+		}
+		return positions
+	}
+}
+
+// streamKeys finds keys of XREAD and XREADGROUP: STREAMS key [key ...] id [id ...]
+func streamKeys(args [][]byte) []int {
+	for i := 1; i < len(args); i++ {
+		if strings.EqualFold(string(args[i]), "streams") {
+			n := (len(args) - i - 1) / 2
+			positions := make([]int, n)
+			for j := range positions {
+				positions[j] = i + 1 + j
+			}
+			return positions
+		}
+	}
+	return nil
+}
+
+func init() {
+	// keyspace
+	register("del", "keyspace write slow", 1, -1, 1)
+	register("unlink", "keyspace write fast", 1, -1, 1)
+	register("exists", "keyspace read fast", 1, -1, 1)
+	register("touch", "keyspace read fast", 1, -1, 1)
+	register("type", "keyspace read fast", 1, 1, 1)
+	register("expire", "keyspace write fast", 1, 1, 1)
+	register("expireat", "keyspace write fast", 1, 1, 1)
+	register("pexpire", "keyspace write fast", 1, 1, 1)
+	register("pexpireat", "keyspace write fast", 1, 1, 1)
+	register("persist", "keyspace write fast", 1, 1, 1)
+	register("ttl", "keyspace read fast", 1, 1, 1)
+	register("pttl", "keyspace read fast", 1, 1, 1)
+	register("expiretime", "keyspace read fast", 1, 1, 1)
+	register("pexpiretime", "keyspace read fast", 1, 1, 1)
+	register("rename", "keyspace write slow", 1, 2, 1)
+	register("renamenx", "keyspace write fast", 1, 2, 1)
+	register("move", "keyspace write fast", 1, 1, 1)
+	register("copy", "keyspace write slow", 1, 2, 1)
+	register("dump", "keyspace read slow", 1, 1, 1)
+	register("restore", "keyspace write slow dangerous", 1, 1, 1)
+	register("keys", "keyspace read slow dangerous", 0, 0, 0)
+	register("scan", "keyspace read slow", 0, 0, 0)
+	register("randomkey", "keyspace read slow", 0, 0, 0)
+	register("dbsize", "keyspace read fast", 0, 0, 0)
+	register("select", "keyspace fast", 0, 0, 0)
+	register("swapdb", "keyspace write fast dangerous", 0, 0, 0)
+	register("flushdb", "keyspace write slow dangerous", 0, 0, 0)
+	register("flushall", "keyspace write slow dangerous", 0, 0, 0)
+	register("object", "keyspace read slow", 2, 2, 1)
+	register("sort", "write set sortedset list slow dangerous", 1, 1, 1).extraKeys = keysAfter("store")
+	register("sort_ro", "read set sortedset list slow dangerous", 1, 1, 1)
+
+	// string
+	register("get", "read string fast", 1, 1, 1)
+	register("set", "write string slow", 1, 1, 1)
+	register("setnx", "write string fast", 1, 1, 1)
+	register("setex", "write string slow", 1, 1, 1)
+	register("psetex", "write string slow", 1, 1, 1)
+	register("getset", "write string fast", 1, 1, 1)
+	register("getdel", "write string fast", 1, 1, 1)
+	register("getex", "write string fast", 1, 1, 1)
+	register("mget", "read string fast", 1, -1, 1)
+	register("mset", "write string slow", 1, -1, 2)
+	register("msetnx", "write string slow", 1, -1, 2)
+	register("incr", "write string fast", 1, 1, 1)
+	register("decr", "write string fast", 1, 1, 1)
+	register("incrby", "write string fast", 1, 1, 1)
+	register("decrby", "write string fast", 1, 1, 1)
+	register("incrbyfloat", "write string fast", 1, 1, 1)
+	register("append", "write string fast", 1, 1, 1)
+	register("strlen", "read string fast", 1, 1, 1)
+	register("getrange", "read string slow", 1, 1, 1)
+	register("substr", "read string slow", 1, 1, 1)
+	register("setrange", "write string slow", 1, 1, 1)
+	register("lcs", "read string slow", 1, 2, 1)
+
+	// bitmap and hyperloglog
+	register("setbit", "write bitmap slow", 1, 1, 1)
+	register("getbit", "read bitmap fast", 1, 1, 1)
+	register("bitcount", "read bitmap slow", 1, 1, 1)
+	register("bitpos", "read bitmap slow", 1, 1, 1)
+	register("bitop", "write bitmap slow", 2, -1, 1)
+	register("bitfield", "write bitmap slow", 1, 1, 1)
+	register("bitfield_ro", "read bitmap fast", 1, 1, 1)
+	register("pfadd", "write hyperloglog fast", 1, 1, 1)
+	register("pfcount", "read hyperloglog slow", 1, -1, 1)
+	register("pfmerge", "write hyperloglog slow", 1, -1, 1)
+
+	// list
+	register("lpush", "write list fast", 1, 1, 1)
+	register("rpush", "write list fast", 1, 1, 1)
+	register("lpushx", "write list fast", 1, 1, 1)
+	register("rpushx", "write list fast", 1, 1, 1)
+	register("lpop", "write list fast", 1, 1, 1)
+	register("rpop", "write list fast", 1, 1, 1)
+	register("llen", "read list fast", 1, 1, 1)
+	register("lindex", "read list slow", 1, 1, 1)
+	register("lset", "write list slow", 1, 1, 1)
+	register("lrange", "read list slow", 1, 1, 1)
+	register("ltrim", "write list slow", 1, 1, 1)
+	register("lrem", "write list slow", 1, 1, 1)
+	register("linsert", "write list slow", 1, 1, 1)
+	register("lpos", "read list slow", 1, 1, 1)
+	register("rpoplpush", "write list slow", 1, 2, 1)
+	register("lmove", "write list slow", 1, 2, 1)
+	register("lmpop", "write list slow", 0, 0, 0).extraKeys = numKeys(1)
+	register("blpop", "write list slow blocking", 1, -2, 1)
+	register("brpop", "write list slow blocking", 1, -2, 1)
+	register("brpoplpush", "write list slow blocking", 1, 2, 1)
+	register("blmove", "write list slow blocking", 1, 2, 1)
+	register("blmpop", "write list slow blocking", 0, 0, 0).extraKeys = numKeys(2)
+
+	// hash
+	register("hset", "write hash fast", 1, 1, 1)
+	register("hsetnx", "write hash fast", 1, 1, 1)
+	register("hmset", "write hash fast", 1, 1, 1)
+	register("hget", "read hash fast", 1, 1, 1)
+	register("hmget", "read hash fast", 1, 1, 1)
+	register("hdel", "write hash fast", 1, 1, 1)
+	register("hlen", "read hash fast", 1, 1, 1)
+	register("hstrlen", "read hash fast", 1, 1, 1)
+	register("hexists", "read hash fast", 1, 1, 1)
+	register("hkeys", "read hash slow", 1, 1, 1)
+	register("hvals", "read hash slow", 1, 1, 1)
+	register("hgetall", "read hash slow", 1, 1, 1)
+	register("hincrby", "write hash fast", 1, 1, 1)
+	register("hincrbyfloat", "write hash fast", 1, 1, 1)
+	register("hrandfield", "read hash slow", 1, 1, 1)
+	register("hscan", "read hash slow", 1, 1, 1)
+
+	// set
+	register("sadd", "write set fast", 1, 1, 1)
+	register("srem", "write set fast", 1, 1, 1)
+	register("smembers", "read set slow", 1, 1, 1)
+	register("sismember", "read set fast", 1, 1, 1)
+	register("smismember", "read set fast", 1, 1, 1)
+	register("scard", "read set fast", 1, 1, 1)
+	register("spop", "write set fast", 1, 1, 1)
+	register("srandmember", "read set slow", 1, 1, 1)
+	register("smove", "write set fast", 1, 2, 1)
+	register("sinter", "read set slow", 1, -1, 1)
+	register("sinterstore", "write set slow", 1, -1, 1)
+	register("sintercard", "read set slow", 0, 0, 0).extraKeys = numKeys(1)
+	register("sunion", "read set slow", 1, -1, 1)
+	register("sunionstore", "write set slow", 1, -1, 1)
+	register("sdiff", "read set slow", 1, -1, 1)
+	register("sdiffstore", "write set slow", 1, -1, 1)
+	register("sscan", "read set slow", 1, 1, 1)
+
+	// sorted set
+	register("zadd", "write sortedset fast", 1, 1, 1)
+	register("zincrby", "write sortedset fast", 1, 1, 1)
+	register("zrem", "write sortedset fast", 1, 1, 1)
+	register("zcard", "read sortedset fast", 1, 1, 1)
+	register("zscore", "read sortedset fast", 1, 1, 1)
+	register("zmscore", "read sortedset fast", 1, 1, 1)
+	register("zrank", "read sortedset fast", 1, 1, 1)
+	register("zrevrank", "read sortedset fast", 1, 1, 1)
+	register("zcount", "read sortedset fast", 1, 1, 1)
+	register("zlexcount", "read sortedset fast", 1, 1, 1)
+	register("zrange", "read sortedset slow", 1, 1, 1)
+	register("zrangestore", "write sortedset slow", 1, 2, 1)
+	register("zrevrange", "read sortedset slow", 1, 1, 1)
+	register("zrangebyscore", "read sortedset slow", 1, 1, 1)
+	register("zrevrangebyscore", "read sortedset slow", 1, 1, 1)
+	register("zrangebylex", "read sortedset slow", 1, 1, 1)
+	register("zrevrangebylex", "read sortedset slow", 1, 1, 1)
+	register("zremrangebyrank", "write sortedset slow", 1, 1, 1)
+	register("zremrangebyscore", "write sortedset slow", 1, 1, 1)
+	register("zremrangebylex", "write sortedset slow", 1, 1, 1)
+	register("zpopmin", "write sortedset fast", 1, 1, 1)
+	register("zpopmax", "write sortedset fast", 1, 1, 1)
+	register("bzpopmin", "write sortedset fast blocking", 1, -2, 1)
+	register("bzpopmax", "write sortedset fast blocking", 1, -2, 1)
+	register("zrandmember", "read sortedset slow", 1, 1, 1)
+	register("zscan", "read sortedset slow", 1, 1, 1)
+	register("zunionstore", "write sortedset slow", 1, 1, 1).extraKeys = numKeys(2)
+	register("zinterstore", "write sortedset slow", 1, 1, 1).extraKeys = numKeys(2)
+	register("zdiffstore", "write sortedset slow", 1, 1, 1).extraKeys = numKeys(2)
+	register("zunion", "read sortedset slow", 0, 0, 0).extraKeys = numKeys(1)
+	register("zinter", "read sortedset slow", 0, 0, 0).extraKeys = numKeys(1)
+	register("zdiff", "read sortedset slow", 0, 0, 0).extraKeys = numKeys(1)
+	register("zintercard", "read sortedset slow", 0, 0, 0).extraKeys = numKeys(1)
+	register("zmpop", "write sortedset slow", 0, 0, 0).extraKeys = numKeys(1)
+	register("bzmpop", "write sortedset slow blocking", 0, 0, 0).extraKeys = numKeys(2)
+
+	// geo
+	register("geoadd", "write geo slow", 1, 1, 1)
+	register("geopos", "read geo slow", 1, 1, 1)
+	register("geodist", "read geo slow", 1, 1, 1)
+	register("geohash", "read geo slow", 1, 1, 1)
+	register("geosearch", "read geo slow", 1, 1, 1)
+	register("geosearchstore", "write geo slow", 1, 2, 1)
+	register("georadius", "write geo slow", 1, 1, 1).extraKeys = keysAfter("store", "storedist")
+	register("georadiusbymember", "write geo slow", 1, 1, 1).extraKeys = keysAfter("store", "storedist")
+	register("georadius_ro", "read geo slow", 1, 1, 1)
+	register("georadiusbymember_ro", "read geo slow", 1, 1, 1)
+
+	// stream
+	register("xadd", "write stream fast", 1, 1, 1)
+	register("xlen", "read stream fast", 1, 1, 1)
+	register("xrange", "read stream slow", 1, 1, 1)
+	register("xrevrange", "read stream slow", 1, 1, 1)
+	register("xdel", "write stream fast", 1, 1, 1)
+	register("xtrim", "write stream slow", 1, 1, 1)
+	register("xread", "read stream slow blocking", 0, 0, 0).extraKeys = streamKeys
+	register("xreadgroup", "write stream slow blocking", 0, 0, 0).extraKeys = streamKeys
+	register("xgroup", "write stream slow", 2, 2, 1)
+	register("xack", "write stream fast", 1, 1, 1)
+	register("xpending", "read stream slow", 1, 1, 1)
+	register("xclaim", "write stream fast", 1, 1, 1)
+	register("xautoclaim", "write stream fast", 1, 1, 1)
+	register("xinfo", "read stream slow", 2, 2, 1)
+	register("xsetid", "write stream fast", 1, 1, 1)
+
+	// pubsub
+	register("publish", "pubsub fast", 0, 0, 0).channels = channelFirst
+	register("spublish", "pubsub fast", 0, 0, 0).channels = channelFirst
+	register("subscribe", "pubsub slow", 0, 0, 0).channels = channelAll
+	register("ssubscribe", "pubsub slow", 0, 0, 0).channels = channelAll
+	register("psubscribe", "pubsub slow", 0, 0, 0).channels = channelPatterns
+	register("unsubscribe", "pubsub slow", 0, 0, 0)
+	register("sunsubscribe", "pubsub slow", 0, 0, 0)
+	register("punsubscribe", "pubsub slow", 0, 0, 0)
+	register("pubsub", "pubsub slow", 0, 0, 0)
+
+	// transaction
+	register("multi", "transaction fast", 0, 0, 0)
+	register("exec", "transaction slow", 0, 0, 0)
+	register("discard", "transaction fast", 0, 0, 0)
+	register("watch", "transaction fast", 1, -1, 1)
+	register("unwatch", "transaction fast", 0, 0, 0)
+
+	// scripting
+	register("eval", "scripting slow", 0, 0, 0).extraKeys = numKeys(2)
+	register("evalsha", "scripting slow", 0, 0, 0).extraKeys = numKeys(2)
+	register("eval_ro", "scripting slow", 0, 0, 0).extraKeys = numKeys(2)
+	register("evalsha_ro", "scripting slow", 0, 0, 0).extraKeys = numKeys(2)
+	register("fcall", "scripting slow", 0, 0, 0).extraKeys = numKeys(2)
+	register("fcall_ro", "scripting slow", 0, 0, 0).extraKeys = numKeys(2)
+	register("script", "scripting slow", 0, 0, 0)
+	register("function", "scripting slow", 0, 0, 0)
+
+	// connection
+	register("auth", "connection fast", 0, 0, 0)
+	register("hello", "connection fast", 0, 0, 0)
+	register("ping", "connection fast", 0, 0, 0)
+	register("echo", "connection fast", 0, 0, 0)
+	register("quit", "connection fast", 0, 0, 0)
+	register("reset", "connection fast", 0, 0, 0)
+	register("command", "connection slow", 0, 0, 0)
+	register("client", "connection slow", 0, 0, 0)
+	register("client|kill", "admin connection slow dangerous", 0, 0, 0)
+	register("client|pause", "admin connection slow dangerous", 0, 0, 0)
+	register("client|unpause", "admin connection slow dangerous", 0, 0, 0)
+	register("client|list", "admin connection slow dangerous", 0, 0, 0)
+	register("client|no-evict", "admin connection slow dangerous", 0, 0, 0)
+
+	// server
+	register("acl", "slow", 0, 0, 0)
+	for _, sub := range []string{"setuser", "getuser", "deluser", "list", "users", "log", "load", "save"} {
+		register("acl|"+sub, "admin slow dangerous", 0, 0, 0)
+	}
+	register("config", "admin slow dangerous", 0, 0, 0)
+	register("info", "slow dangerous", 0, 0, 0)
+	register("time", "fast", 0, 0, 0)
+	register("lastsave", "fast dangerous", 0, 0, 0)
+	register("save", "admin slow dangerous", 0, 0, 0)
+	register("bgsave", "admin slow dangerous", 0, 0, 0)
+	register("bgrewriteaof", "admin slow dangerous", 0, 0, 0)
+	register("shutdown", "admin slow dangerous", 0, 0, 0)
+	register("debug", "admin slow dangerous", 0, 0, 0)
+	register("monitor", "admin slow dangerous", 0, 0, 0)
+	register("slowlog", "admin slow dangerous", 0, 0, 0)
+	register("latency", "admin slow dangerous", 0, 0, 0)
+	register("bigkeys", "keyspace read slow dangerous", 0, 0, 0)
+	register("hotkeys", "admin slow dangerous", 0, 0, 0)
+	register("memory", "slow", 0, 0, 0)
+	register("memory|usage", "read slow", 2, 2, 1)
+	register("replicaof", "admin slow dangerous", 0, 0, 0)
+	register("slaveof", "admin slow dangerous", 0, 0, 0)
+	register("role", "admin fast dangerous", 0, 0, 0)
+	register("sync", "admin slow dangerous", 0, 0, 0)
+	register("psync", "admin slow dangerous", 0, 0, 0)
+	register("replconf", "admin slow dangerous", 0, 0, 0)
+	register("wait", "slow", 0, 0, 0)
+
+	for _, name := range []string{"object", "xgroup", "xinfo", "pubsub", "script", "function", "command", "client",
+		"acl", "config", "debug", "slowlog", "latency", "memory"} {
+		commandTable[name].container = true
+	}
+}
+
+// lookupCommand returns the spec of command, name of subcommand is "command|subcommand".
+// Spec of subcommand is preferred if it is in table, otherwise spec of the container command is returned.
+func lookupCommand(cmdLine [][]byte) (name string, spec *commandSpec) {
+	name = strings.ToLower(string(cmdLine[0]))
+	spec = commandTable[name]
+	if spec == nil || !spec.container || len(cmdLine) < 2 {
+		return name, spec
+	}
+	name += "|" + strings.ToLower(string(cmdLine[1]))
+	if sub, ok := commandTable[name]; ok {
+		spec = sub
+	}
+	return name, spec
+}
+
+// CommandName returns the lower case name of command, subcommand of container command is "command|subcommand"
+func CommandName(cmdLine [][]byte) string {
+	name, _ := lookupCommand(cmdLine)
+	return name
+}
+
+// KnownCommandName is like CommandName but only returns names in command table, unknown subcommand is
+// reported as its container command. ok is false if the command is unknown
+func KnownCommandName(cmdLine [][]byte) (name string, ok bool) {
+	name, spec := lookupCommand(cmdLine)
+	if spec == nil {
+		return "", false
+	}
+	return spec.name, true
+}
+
+// IsWrite returns whether the command may modify data
+func IsWrite(cmdLine [][]byte) bool {
+	_, spec := lookupCommand(cmdLine)
+	return spec != nil && spec.categories&categoryFlag("write") != 0
+}
+
+// shrinkingCommands are write commands which never use more memory, they are allowed when maxmemory is reached
+var shrinkingCommands = map[string]struct{}{
+	"del": {}, "unlink": {}, "expire": {}, "expireat": {}, "pexpire": {}, "pexpireat": {}, "persist": {},
+	"flushdb": {}, "flushall": {}, "getdel": {}, "lpop": {}, "rpop": {}, "ltrim": {}, "lrem": {}, "lmpop": {},
+	"blpop": {}, "brpop": {}, "blmpop": {}, "hdel": {}, "srem": {}, "spop": {}, "zrem": {},
+	"zremrangebyrank": {}, "zremrangebyscore": {}, "zremrangebylex": {}, "zpopmin": {}, "zpopmax": {},
+	"bzpopmin": {}, "bzpopmax": {}, "zmpop": {}, "bzmpop": {}, "xdel": {}, "xtrim": {}, "xack": {},
+}
+
+// DenyOOM returns whether the command is rejected when used memory exceeds maxmemory,
+// they are write commands which may use more memory
+func DenyOOM(cmdLine [][]byte) bool {
+	_, spec := lookupCommand(cmdLine)
+	if spec == nil || spec.categories&categoryFlag("write") == 0 {
+		return false
+	}
+	_, shrinking := shrinkingCommands[spec.name]
+	return !shrinking
+}
+
+// IsReadOnly returns whether the command only reads data
+func IsReadOnly(cmdLine [][]byte) bool {
+	_, spec := lookupCommand(cmdLine)
+	return spec != nil && spec.categories&categoryFlag("read") != 0 && spec.categories&categoryFlag("write") == 0
+}
+
+// CommandKeys returns keys in cmdLine, it returns nil if the command is unknown
+func CommandKeys(cmdLine [][]byte) []string {
+	_, spec := lookupCommand(cmdLine)
+	if spec == nil {
+		return nil
+	}
+	positions := spec.keyPositions(cmdLine)
+	keys := make([]string, len(positions))
+	for i, pos := range positions {
+		keys[i] = string(cmdLine[pos])
+	}
+	return keys
+}
+
+// Categories returns all command categories
+func Categories() []string {
+	return append([]string(nil), categoryNames...)
+}
+
+// CategoryCommands returns the commands in category sorted by name, ok is false if category is unknown
+func CategoryCommands(category string) (commands []string, ok bool) {
+	flag := categoryFlag(strings.ToLower(category))
+	if flag == 0 {
+		return nil, false
+	}
+	for name, spec := range commandTable {
+		if spec.categories&flag != 0 {
+			commands = append(commands, name)
+		}
+	}
+	sort.Strings(commands)
+	return commands, true
+}
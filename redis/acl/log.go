@@ -0,0 +1,88 @@
+package acl
+
+import (
+	"sync"
+	"time"
+
+	"github.com/atomwqh/MyGodis/config"
+)
+
+// ACL LOG 记录被拒绝的命令和失败的认证, 60 秒内相同的事件合并为一条并增加计数,
+// 最多保留 acllog-max-len 条, 新的在前
+
+// logGroupingInterval is the max interval of similar events merged into one entry
+const logGroupingInterval = 60 * time.Second
+
+// LogEntry is an entry of ACL LOG
+type LogEntry struct {
+	Count int
+	// Reason is "auth", "command", "key" or "channel"
+	Reason string
+	// Context is where the command was executed, "toplevel" for commands sent by clients
+	Context    string
+	Object     string
+	Username   string
+	ClientInfo string
+	EntryID    int64
+	Created    time.Time
+	Updated    time.Time
+}
+
+var (
+	logMu     sync.Mutex
+	logs      []*LogEntry // newest first
+	nextLogID int64
+)
+
+// AddLog records a denied event
+func AddLog(reason string, object string, username string, clientInfo string) {
+	now := time.Now()
+	logMu.Lock()
+	defer logMu.Unlock()
+	for _, e := range logs {
+		if e.Reason == reason && e.Object == object && e.Username == username &&
+			now.Sub(e.Updated) < logGroupingInterval {
+			e.Count++
+			e.Updated = now
+			e.ClientInfo = clientInfo
+			return
+		}
+	}
+	entry := &LogEntry{
+		Count:      1,
+		Reason:     reason,
+		Context:    "toplevel",
+		Object:     object,
+		Username:   username,
+		ClientInfo: clientInfo,
+		EntryID:    nextLogID,
+		Created:    now,
+		Updated:    now,
+	}
+	nextLogID++
+	logs = append([]*LogEntry{entry}, logs...)
+	if max := config.Get().ACLLogMaxLen; max >= 0 && len(logs) > max {
+		logs = logs[:max]
+	}
+}
+
+// Logs returns copies of the newest count entries, count < 0 means all
+func Logs(count int) []LogEntry {
+	logMu.Lock()
+	defer logMu.Unlock()
+	if count < 0 || count > len(logs) {
+		count = len(logs)
+	}
+	result := make([]LogEntry, count)
+	for i := range result {
+		result[i] = *logs[i]
+	}
+	return result
+}
+
+// ResetLog clears ACL LOG
+func ResetLog() {
+	logMu.Lock()
+	defer logMu.Unlock()
+	logs = nil
+}
@@ -0,0 +1,376 @@
+package acl
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/atomwqh/MyGodis/lib/wildcard"
+)
+
+// 命令权限按规则的顺序计算: 依次检查每条 +/- 规则, 最后一条匹配命令的规则决定是否允许.
+// +@all 和 -@all 会覆盖之前所有的命令规则, 所以规则列表不会无限增长
+
+// Denied describes why a command is refused
+type Denied struct {
+	// Reason is "command", "key" or "channel", the same as the reason of ACL LOG
+	Reason string
+	// Object is the command, key or channel refused
+	Object string
+}
+
+// User is an ACL user, it is immutable after created so it can be read without lock
+type User struct {
+	Name    string
+	Enabled bool
+	NoPass  bool
+	// sha256 of passwords in hex
+	passwords []string
+
+	allKeys     bool
+	keys        []string
+	allChannels bool
+	channels    []string
+	// command rules in order, such as "+@all", "-flushdb", "+config|get"
+	commands []string
+}
+
+// newUser returns a user which can do nothing
+func newUser(name string) *User {
+	return &User{Name: name}
+}
+
+// newDefaultUser returns the default user of a new server which can do everything without password
+func newDefaultUser() *User {
+	return &User{
+		Name:        DefaultUser,
+		Enabled:     true,
+		NoPass:      true,
+		allKeys:     true,
+		allChannels: true,
+		commands:    []string{"+@all"},
+	}
+}
+
+func (u *User) clone() *User {
+	c := *u
+	c.passwords = append([]string(nil), u.passwords...)
+	c.keys = append([]string(nil), u.keys...)
+	c.channels = append([]string(nil), u.channels...)
+	c.commands = append([]string(nil), u.commands...)
+	return &c
+}
+
+// hashPassword returns sha256 of password in hex
+func hashPassword(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+func isHash(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !(s[i] >= '0' && s[i] <= '9' || s[i] >= 'a' && s[i] <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func addUnique(list []string, s string) []string {
+	for _, item := range list {
+		if item == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+func remove(list []string, s string) ([]string, bool) {
+	for i, item := range list {
+		if item == s {
+			return append(list[:i], list[i+1:]...), true
+		}
+	}
+	return list, false
+}
+
+// checkPassword compares password with all hashes of user in constant time
+func (u *User) checkPassword(password string) bool {
+	if u.NoPass {
+		return true
+	}
+	hash := []byte(hashPassword(password))
+	ok := false
+	for _, p := range u.passwords {
+		if subtle.ConstantTimeCompare(hash, []byte(p)) == 1 {
+			ok = true
+		}
+	}
+	return ok
+}
+
+// validCommandRule checks the command or category name of a +/- rule
+func validCommandRule(name string) bool {
+	if strings.HasPrefix(name, "@") {
+		return name == "@all" || categoryFlag(name[1:]) != 0
+	}
+	if i := strings.IndexByte(name, '|'); i > 0 {
+		// subcommands are not listed in table unless they have different categories
+		_, ok := commandTable[name[:i]]
+		return ok && i < len(name)-1
+	}
+	_, ok := commandTable[name]
+	return ok
+}
+
+// applyRule changes user by a rule of ACL SETUSER
+func (u *User) applyRule(rule string) error {
+	switch strings.ToLower(rule) {
+	case "on":
+		u.Enabled = true
+		return nil
+	case "off":
+		u.Enabled = false
+		return nil
+	case "nopass":
+		u.NoPass = true
+		u.passwords = nil
+		return nil
+	case "resetpass":
+		u.NoPass = false
+		u.passwords = nil
+		return nil
+	case "allkeys":
+		return u.applyRule("~*")
+	case "resetkeys":
+		u.allKeys = false
+		u.keys = nil
+		return nil
+	case "allchannels":
+		return u.applyRule("&*")
+	case "resetchannels":
+		u.allChannels = false
+		u.channels = nil
+		return nil
+	case "allcommands":
+		return u.applyRule("+@all")
+	case "nocommands":
+		return u.applyRule("-@all")
+	case "reset":
+		for _, r := range []string{"resetpass", "resetkeys", "resetchannels", "off", "-@all"} {
+			_ = u.applyRule(r)
+		}
+		return nil
+	}
+	if rule == "" {
+		return errors.New("Syntax error")
+	}
+	arg := rule[1:]
+	switch rule[0] {
+	case '>':
+		u.passwords = addUnique(u.passwords, hashPassword(arg))
+		u.NoPass = false
+	case '#':
+		if !isHash(arg) {
+			return errors.New("The password hash must be exactly 64 characters and contain only lowercase hexadecimal characters")
+		}
+		u.passwords = addUnique(u.passwords, arg)
+		u.NoPass = false
+	case '<', '!':
+		hash := arg
+		if rule[0] == '<' {
+			hash = hashPassword(arg)
+		}
+		var ok bool
+		if u.passwords, ok = remove(u.passwords, hash); !ok {
+			return errors.New("The password you are trying to remove from the user does not exist")
+		}
+	case '~':
+		if u.allKeys {
+			return errors.New("Adding a pattern after the * pattern (or the 'allkeys' flag) is not valid and does not have any effect. Try 'resetkeys' to start with an empty list of patterns")
+		}
+		if arg == "*" {
+			u.allKeys = true
+			u.keys = nil
+		} else {
+			u.keys = addUnique(u.keys, arg)
+		}
+	case '&':
+		if u.allChannels {
+			return errors.New("Adding a pattern after the * pattern (or the 'allchannels' flag) is not valid and does not have any effect. Try 'resetchannels' to start with an empty list of channels")
+		}
+		if arg == "*" {
+			u.allChannels = true
+			u.channels = nil
+		} else {
+			u.channels = addUnique(u.channels, arg)
+		}
+	case '+', '-':
+		name := strings.ToLower(arg)
+		if !validCommandRule(name) {
+			return errors.New("Unknown command or category name in ACL")
+		}
+		if name == "@all" {
+			// overrides all rules before
+			u.commands = nil
+		}
+		u.commands = append(u.commands, rule[:1]+name)
+	default:
+		return errors.New("Syntax error")
+	}
+	return nil
+}
+
+// ruleMatches returns whether a command rule without sign applies to command
+func ruleMatches(rule string, name string, spec *commandSpec) bool {
+	if rule == "@all" {
+		return true
+	}
+	if spec == nil {
+		// commands not in table only match @all
+		return false
+	}
+	if strings.HasPrefix(rule, "@") {
+		return spec.categories&categoryFlag(rule[1:]) != 0
+	}
+	// "config" matches all subcommands, "config|get" matches only itself
+	return rule == name || strings.HasPrefix(name, rule+"|")
+}
+
+// canRun returns whether user is allowed to run the command by command rules
+func (u *User) canRun(name string, spec *commandSpec) bool {
+	allowed := false
+	for _, rule := range u.commands {
+		if ruleMatches(rule[1:], name, spec) {
+			allowed = rule[0] == '+'
+		}
+	}
+	return allowed
+}
+
+func (u *User) canAccessKey(key string) bool {
+	if u.allKeys {
+		return true
+	}
+	for _, pattern := range u.keys {
+		if wildcard.Match(pattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *User) canAccessChannel(channel string, isPattern bool) bool {
+	if u.allChannels {
+		return true
+	}
+	for _, pattern := range u.channels {
+		if isPattern && pattern == channel || !isPattern && wildcard.Match(pattern, channel) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns nil if user is allowed to run cmdLine.
+// Commands unknown to ACL are only allowed for users with +@all and allkeys, since their keys are unknown.
+func (u *User) Check(cmdLine [][]byte) *Denied {
+	name, spec := lookupCommand(cmdLine)
+	if !u.canRun(name, spec) || spec == nil && !u.allKeys {
+		return &Denied{Reason: "command", Object: name}
+	}
+	if spec == nil {
+		return nil
+	}
+	for _, i := range spec.keyPositions(cmdLine) {
+		if key := string(cmdLine[i]); !u.canAccessKey(key) {
+			return &Denied{Reason: "key", Object: key}
+		}
+	}
+	if spec.channels != channelNone && len(cmdLine) > 1 {
+		channels := cmdLine[1:]
+		if spec.channels == channelFirst {
+			channels = channels[:1]
+		}
+		for _, channel := range channels {
+			if !u.canAccessChannel(string(channel), spec.channels == channelPatterns) {
+				return &Denied{Reason: "channel", Object: string(channel)}
+			}
+		}
+	}
+	return nil
+}
+
+// Flags returns flags shown by ACL GETUSER
+func (u *User) Flags() []string {
+	flags := []string{"off"}
+	if u.Enabled {
+		flags[0] = "on"
+	}
+	if u.NoPass {
+		flags = append(flags, "nopass")
+	}
+	return flags
+}
+
+// Passwords returns sha256 of passwords in hex
+func (u *User) Passwords() []string {
+	return append([]string(nil), u.passwords...)
+}
+
+// KeysRule returns key patterns in rule format
+func (u *User) KeysRule() string {
+	if u.allKeys {
+		return "~*"
+	}
+	patterns := make([]string, len(u.keys))
+	for i, p := range u.keys {
+		patterns[i] = "~" + p
+	}
+	return strings.Join(patterns, " ")
+}
+
+// ChannelsRule returns channel patterns in rule format
+func (u *User) ChannelsRule() string {
+	if u.allChannels {
+		return "&*"
+	}
+	patterns := make([]string, len(u.channels))
+	for i, p := range u.channels {
+		patterns[i] = "&" + p
+	}
+	return strings.Join(patterns, " ")
+}
+
+// CommandsRule returns command rules in order
+func (u *User) CommandsRule() string {
+	if len(u.commands) == 0 {
+		return "-@all"
+	}
+	return strings.Join(u.commands, " ")
+}
+
+// Describe returns the rules which create user, used by ACL LIST and aclfile
+func (u *User) Describe() string {
+	parts := []string{"user", u.Name}
+	parts = append(parts, u.Flags()...)
+	for _, p := range u.passwords {
+		parts = append(parts, "#"+p)
+	}
+	if keys := u.KeysRule(); keys != "" {
+		parts = append(parts, keys)
+	}
+	if !u.allChannels {
+		parts = append(parts, "resetchannels")
+	}
+	if channels := u.ChannelsRule(); channels != "" {
+		parts = append(parts, channels)
+	}
+	parts = append(parts, u.CommandsRule())
+	return strings.Join(parts, " ")
+}
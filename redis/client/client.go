@@ -0,0 +1,265 @@
+package client
+
+import (
+	"bufio"
+	"errors"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/atomwqh/MyGodis/interface/redis"
+	"github.com/atomwqh/MyGodis/lib/sync/wait"
+	"github.com/atomwqh/MyGodis/lib/utils"
+	"github.com/atomwqh/MyGodis/redis/parser"
+	"github.com/atomwqh/MyGodis/redis/protocol"
+)
+
+// 客户端会把并发发送的请求合并成一批写入同一个连接 (自动 pipeline)
+// 服务端按顺序返回结果，读协程按顺序把结果交给等待中的请求
+
+var (
+	// ErrTimeout means the reply didn't arrive within Config.Timeout
+	ErrTimeout = errors.New("client: request timeout")
+	// ErrClosed means the client has been closed
+	ErrClosed = errors.New("client: closed")
+)
+
+// Config is the settings of a Client
+type Config struct {
+	// Network is "tcp" or "unix", default is "tcp"
+	Network     string
+	Address     string
+	DialTimeout time.Duration
+	// Timeout limits the time for writing a batch and waiting for a reply, 0 means no limit
+	Timeout time.Duration
+	// Protocol is the RESP version, HELLO 3 is sent after connected if it is 3
+	Protocol int
+	// Username and Password are sent by AUTH after connected if Password is not empty, empty Username means default user
+	Username string
+	Password string
+	// PushHandler receives RESP3 push messages which don't belong to any request, may be nil
+	PushHandler func(reply *protocol.PushReply)
+}
+
+// Client is a pipeline mode redis client, it is safe for concurrent use
+type Client struct {
+	conn   net.Conn
+	cfg    *Config
+	reader *parser.Reader
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending []*Request // waiting to be sent
+	waiting []*Request // sent, waiting for reply
+	err     error      // not nil after client is broken or closed
+
+	lastUsed time.Time // used by pool to decide whether to check health
+}
+
+// Request is a command sent by Client, use Client.Receive to get the reply
+type Request struct {
+	args    [][]byte
+	reply   redis.Reply
+	err     error
+	waiting wait.Wait
+}
+
+func (req *Request) finish(reply redis.Reply, err error) {
+	req.reply = reply
+	req.err = err
+	req.waiting.Done()
+}
+
+// Dial connects to server and starts the client
+func Dial(cfg *Config) (*Client, error) {
+	network := cfg.Network
+	if network == "" {
+		network = "tcp"
+	}
+	conn, err := net.DialTimeout(network, cfg.Address, cfg.DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	client := &Client{
+		conn:     conn,
+		cfg:      cfg,
+		reader:   parser.NewReaderWithLimits(conn, unlimited()),
+		lastUsed: time.Now(),
+	}
+	client.cond = sync.NewCond(&client.mu)
+	go client.handleWrite()
+	go client.handleRead()
+
+	var handshake [][]byte
+	if cfg.Protocol == protocol.RESP3 {
+		handshake = utils.ToCmdLine("HELLO", strconv.Itoa(cfg.Protocol))
+		if cfg.Password != "" {
+			username := cfg.Username
+			if username == "" {
+				username = "default"
+			}
+			handshake = append(handshake, utils.ToCmdLine("AUTH", username, cfg.Password)...)
+		}
+	} else if cfg.Password != "" {
+		handshake = utils.ToCmdLine("AUTH", cfg.Password)
+		if cfg.Username != "" {
+			handshake = utils.ToCmdLine("AUTH", cfg.Username, cfg.Password)
+		}
+	}
+	if handshake != nil {
+		if _, err = checkReply(client.Do(handshake)); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+// unlimited returns limits for reading replies, we trust the server
+func unlimited() parser.Limits {
+	return parser.Limits{
+		MaxBulkLen:      math.MaxInt64,
+		MaxMultiBulkLen: math.MaxInt64,
+		MaxInlineSize:   math.MaxInt,
+	}
+}
+
+// Send queues cmdLine and returns without waiting for the reply
+func (c *Client) Send(cmdLine [][]byte) *Request {
+	req := &Request{args: cmdLine}
+	req.waiting.Add(1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		req.finish(nil, c.err)
+		return req
+	}
+	c.pending = append(c.pending, req)
+	c.lastUsed = time.Now()
+	c.cond.Signal()
+	return req
+}
+
+// Receive waits for the reply of req, error reply from server is returned as redis.Reply rather than error
+func (c *Client) Receive(req *Request) (redis.Reply, error) {
+	if c.cfg.Timeout > 0 {
+		if timeout := req.waiting.WaitWithTimeout(c.cfg.Timeout); timeout {
+			return nil, ErrTimeout
+		}
+	} else {
+		req.waiting.Wait()
+	}
+	return req.reply, req.err
+}
+
+// Do sends cmdLine and waits for the reply
+func (c *Client) Do(cmdLine [][]byte) (redis.Reply, error) {
+	return c.Receive(c.Send(cmdLine))
+}
+
+// Err returns the reason why client is broken, returns nil if client is healthy
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// idleSince returns the time of last request
+func (c *Client) idleSince() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastUsed
+}
+
+// Close stops client, requests not finished will get ErrClosed
+func (c *Client) Close() {
+	c.fail(ErrClosed)
+}
+
+// fail closes connection and finishes all unfinished requests with err
+func (c *Client) fail(err error) {
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return
+	}
+	c.err = err
+	unfinished := append(c.waiting, c.pending...)
+	c.waiting = nil
+	c.pending = nil
+	c.cond.Broadcast()
+	c.mu.Unlock()
+
+	_ = c.conn.Close()
+	for _, req := range unfinished {
+		req.finish(nil, err)
+	}
+}
+
+// handleWrite writes all pending requests in one batch
+func (c *Client) handleWrite() {
+	writer := bufio.NewWriter(c.conn)
+	for {
+		c.mu.Lock()
+		for len(c.pending) == 0 && c.err == nil {
+			c.cond.Wait()
+		}
+		if c.err != nil {
+			c.mu.Unlock()
+			return
+		}
+		batch := c.pending
+		c.pending = nil
+		// requests must be waiting before written, otherwise reply may arrive before they are found
+		c.waiting = append(c.waiting, batch...)
+		c.mu.Unlock()
+
+		if c.cfg.Timeout > 0 {
+			_ = c.conn.SetWriteDeadline(time.Now().Add(c.cfg.Timeout))
+		}
+		var err error
+		for _, req := range batch {
+			if _, err = writer.Write(protocol.MakeMultiBulkReply(req.args).ToBytes()); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = writer.Flush()
+		}
+		if err != nil {
+			c.fail(err)
+			return
+		}
+	}
+}
+
+// handleRead finishes waiting requests in order
+func (c *Client) handleRead() {
+	for {
+		reply, err := c.reader.Next()
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		if push, ok := reply.(*protocol.PushReply); ok {
+			// out of band message, doesn't belong to any request
+			if c.cfg.PushHandler != nil {
+				c.cfg.PushHandler(push)
+			}
+			continue
+		}
+		c.mu.Lock()
+		if len(c.waiting) == 0 {
+			c.mu.Unlock()
+			c.fail(errors.New("client: unexpected reply " + strconv.Quote(string(reply.ToBytes()))))
+			return
+		}
+		req := c.waiting[0]
+		c.waiting[0] = nil
+		c.waiting = c.waiting[1:]
+		c.mu.Unlock()
+		req.finish(reply, nil)
+	}
+}
@@ -0,0 +1,139 @@
+package client
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/atomwqh/MyGodis/lib/utils"
+	"github.com/atomwqh/MyGodis/redis/server"
+	"github.com/atomwqh/MyGodis/tcp"
+)
+
+func startServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closeChan := make(chan struct{})
+	go tcp.ListenAndServe(listener, server.MakeHandler(nil), closeChan)
+	t.Cleanup(func() {
+		closeChan <- struct{}{}
+	})
+	return listener.Addr().String()
+}
+
+func TestClient(t *testing.T) {
+	c, err := Dial(&Config{Address: startServer(t), Timeout: 3 * time.Second, Protocol: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	status, err := String(c.Do(utils.ToCmdLine("PING")))
+	if err != nil || status != "PONG" {
+		t.Errorf("PING failed: %s %v", status, err)
+	}
+	hello, err := Values(c.Do(utils.ToCmdLine("HELLO")))
+	if err != nil || len(hello) != 14 {
+		t.Fatalf("HELLO failed: %v", err)
+	}
+	if proto, err := Int64(hello[5], nil); err != nil || proto != 3 {
+		t.Errorf("expect proto 3, actual %d %v", proto, err)
+	}
+	if _, err = String(c.Do(utils.ToCmdLine("PING", "a", "b"))); err == nil {
+		t.Error("expect error reply")
+	}
+
+	// concurrent requests are pipelined and each gets its own reply
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			msg := strconv.Itoa(i)
+			reply, err := String(c.Do(utils.ToCmdLine("PING", msg)))
+			if err != nil || reply != msg {
+				t.Errorf("expect %s, actual %s %v", msg, reply, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Send/Receive
+	reqs := make([]*Request, 10)
+	for i := range reqs {
+		reqs[i] = c.Send(utils.ToCmdLine("PING", strconv.Itoa(i)))
+	}
+	for i, req := range reqs {
+		if n, err := Int64(c.Receive(req)); err != nil || n != int64(i) {
+			t.Errorf("expect %d, actual %d %v", i, n, err)
+		}
+	}
+
+	c.Close()
+	if _, err = c.Do(utils.ToCmdLine("PING")); err != ErrClosed {
+		t.Errorf("expect ErrClosed, actual %v", err)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	// a server never replies
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(2 * time.Second)
+		}
+	}()
+	c, err := Dial(&Config{Address: listener.Addr().String(), Timeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err = c.Do(utils.ToCmdLine("PING")); err != ErrTimeout {
+		t.Errorf("expect ErrTimeout, actual %v", err)
+	}
+}
+
+func TestPool(t *testing.T) {
+	pool := MakePool(&Config{Address: startServer(t)}, PoolConfig{
+		MaxIdle:             2,
+		MaxActive:           2,
+		WaitTimeout:         100 * time.Millisecond,
+		HealthCheckInterval: time.Millisecond,
+	})
+	defer pool.Close()
+
+	c1, err := pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, err := pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = pool.Get(); err != ErrPoolExhausted {
+		t.Errorf("expect ErrPoolExhausted, actual %v", err)
+	}
+	c2.Close() // broken client is dropped
+	pool.Put(c1)
+	pool.Put(c2)
+
+	time.Sleep(2 * time.Millisecond) // c1 should be checked by PING
+	c, err := pool.Get()
+	if err != nil || c != c1 {
+		t.Errorf("expect idle client, actual %v", err)
+	}
+	pool.Put(c)
+	if status, err := String(pool.Do(utils.ToCmdLine("PING"))); err != nil || status != "PONG" {
+		t.Errorf("PING failed: %s %v", status, err)
+	}
+}
@@ -0,0 +1,166 @@
+package client
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/atomwqh/MyGodis/interface/redis"
+	"github.com/atomwqh/MyGodis/lib/utils"
+	"github.com/atomwqh/MyGodis/redis/protocol"
+)
+
+var (
+	// ErrPoolExhausted means no client is available within PoolConfig.WaitTimeout
+	ErrPoolExhausted = errors.New("client: connection pool exhausted")
+	// ErrPoolClosed means the pool has been closed
+	ErrPoolClosed = errors.New("client: pool closed")
+)
+
+// PoolConfig is the settings of Pool
+type PoolConfig struct {
+	// MaxIdle is the max number of idle clients kept in pool
+	MaxIdle int
+	// MaxActive is the max number of clients borrowed at the same time, 0 means no limit
+	MaxActive int
+	// WaitTimeout is the max time Get waits for a free client, 0 means waiting forever
+	WaitTimeout time.Duration
+	// HealthCheckInterval, clients idle for longer than it are checked by PING before being returned by Get
+	HealthCheckInterval time.Duration
+}
+
+// Pool is a bounded pool of Client
+type Pool struct {
+	cfg     *Config
+	poolCfg PoolConfig
+
+	mu     sync.Mutex
+	idles  []*Client
+	closed bool
+	// active holds a token for each borrowed client, it is nil if MaxActive is 0
+	active chan struct{}
+}
+
+// MakePool creates a Pool, clients are dialed lazily
+func MakePool(cfg *Config, poolCfg PoolConfig) *Pool {
+	pool := &Pool{
+		cfg:     cfg,
+		poolCfg: poolCfg,
+	}
+	if poolCfg.MaxActive > 0 {
+		pool.active = make(chan struct{}, poolCfg.MaxActive)
+	}
+	return pool
+}
+
+func (pool *Pool) acquire() error {
+	if pool.active == nil {
+		return nil
+	}
+	if pool.poolCfg.WaitTimeout <= 0 {
+		pool.active <- struct{}{}
+		return nil
+	}
+	timer := time.NewTimer(pool.poolCfg.WaitTimeout)
+	defer timer.Stop()
+	select {
+	case pool.active <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return ErrPoolExhausted
+	}
+}
+
+func (pool *Pool) release() {
+	if pool.active != nil {
+		<-pool.active
+	}
+}
+
+// Get borrows a healthy client from pool, it must be returned by Put
+func (pool *Pool) Get() (*Client, error) {
+	if err := pool.acquire(); err != nil {
+		return nil, err
+	}
+	for {
+		pool.mu.Lock()
+		if pool.closed {
+			pool.mu.Unlock()
+			pool.release()
+			return nil, ErrPoolClosed
+		}
+		if len(pool.idles) == 0 {
+			pool.mu.Unlock()
+			break
+		}
+		c := pool.idles[len(pool.idles)-1]
+		pool.idles = pool.idles[:len(pool.idles)-1]
+		pool.mu.Unlock()
+		if pool.healthy(c) {
+			return c, nil
+		}
+		c.Close()
+	}
+	c, err := Dial(pool.cfg)
+	if err != nil {
+		pool.release()
+		return nil, err
+	}
+	return c, nil
+}
+
+// healthy checks broken clients and PINGs clients idle for a long time
+func (pool *Pool) healthy(c *Client) bool {
+	if c.Err() != nil {
+		return false
+	}
+	interval := pool.poolCfg.HealthCheckInterval
+	if interval <= 0 || time.Since(c.idleSince()) < interval {
+		return true
+	}
+	reply, err := c.Do(utils.ToCmdLine("PING"))
+	if err != nil {
+		return false
+	}
+	status, ok := reply.(*protocol.StatusReply)
+	return ok && status.Status == "PONG"
+}
+
+// Put returns client to pool, broken clients are closed
+func (pool *Pool) Put(c *Client) {
+	defer pool.release()
+	if c.Err() != nil {
+		c.Close()
+		return
+	}
+	pool.mu.Lock()
+	if pool.closed || len(pool.idles) >= pool.poolCfg.MaxIdle {
+		pool.mu.Unlock()
+		c.Close()
+		return
+	}
+	pool.idles = append(pool.idles, c)
+	pool.mu.Unlock()
+}
+
+// Do borrows a client, executes cmdLine and returns the client
+func (pool *Pool) Do(cmdLine [][]byte) (redis.Reply, error) {
+	c, err := pool.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer pool.Put(c)
+	return c.Do(cmdLine)
+}
+
+// Close closes idle clients, borrowed clients are closed when they are returned
+func (pool *Pool) Close() {
+	pool.mu.Lock()
+	pool.closed = true
+	idles := pool.idles
+	pool.idles = nil
+	pool.mu.Unlock()
+	for _, c := range idles {
+		c.Close()
+	}
+}
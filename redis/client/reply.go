@@ -0,0 +1,194 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/atomwqh/MyGodis/interface/redis"
+	"github.com/atomwqh/MyGodis/redis/protocol"
+)
+
+// 把 redis.Reply 转换成 Go 类型的辅助函数, 可以直接包裹 Do 的返回值:
+//   val, err := client.String(c.Do(utils.ToCmdLine("GET", "key")))
+// 服务端返回的错误会被转换为 error
+
+// ErrNil means server returned nil bulk or nil reply
+var ErrNil = errors.New("client: nil reply")
+
+// checkReply converts error reply and nil reply to error
+func checkReply(reply redis.Reply, err error) (redis.Reply, error) {
+	if err != nil {
+		return nil, err
+	}
+	switch r := reply.(type) {
+	case protocol.ErrorReply:
+		return nil, errors.New(r.Error())
+	case *protocol.NullBulkReply, *protocol.NullReply:
+		return nil, ErrNil
+	case *protocol.AttributeReply:
+		return checkReply(r.Reply, nil)
+	}
+	return reply, nil
+}
+
+func unexpected(reply redis.Reply, want string) error {
+	return fmt.Errorf("client: unexpected reply type %T for %s", reply, want)
+}
+
+// Bytes converts status, bulk, verbatim, integer and double reply to []byte
+func Bytes(reply redis.Reply, err error) ([]byte, error) {
+	reply, err = checkReply(reply, err)
+	if err != nil {
+		return nil, err
+	}
+	switch r := reply.(type) {
+	case *protocol.BulkReply:
+		return r.Arg, nil
+	case *protocol.StatusReply:
+		return []byte(r.Status), nil
+	case *protocol.VerbatimReply:
+		return r.Text, nil
+	case *protocol.IntReply:
+		return []byte(strconv.FormatInt(r.Code, 10)), nil
+	case *protocol.DoubleReply:
+		return []byte(r.String()), nil
+	case *protocol.BigNumberReply:
+		return []byte(r.Value), nil
+	}
+	return nil, unexpected(reply, "string")
+}
+
+// String converts reply to string, see Bytes
+func String(reply redis.Reply, err error) (string, error) {
+	b, err := Bytes(reply, err)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// Int64 converts integer reply or numeric string to int64
+func Int64(reply redis.Reply, err error) (int64, error) {
+	reply, err = checkReply(reply, err)
+	if err != nil {
+		return 0, err
+	}
+	switch r := reply.(type) {
+	case *protocol.IntReply:
+		return r.Code, nil
+	case *protocol.BooleanReply:
+		if r.Value {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	s, err := String(reply, nil)
+	if err != nil {
+		return 0, unexpected(reply, "int64")
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// Float64 converts double reply or numeric string to float64
+func Float64(reply redis.Reply, err error) (float64, error) {
+	reply, err = checkReply(reply, err)
+	if err != nil {
+		return 0, err
+	}
+	if r, ok := reply.(*protocol.DoubleReply); ok {
+		return r.Value, nil
+	}
+	s, err := String(reply, nil)
+	if err != nil {
+		return 0, unexpected(reply, "float64")
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// Bool converts boolean reply, integer reply and status OK to bool
+func Bool(reply redis.Reply, err error) (bool, error) {
+	reply, err = checkReply(reply, err)
+	if err != nil {
+		return false, err
+	}
+	switch r := reply.(type) {
+	case *protocol.BooleanReply:
+		return r.Value, nil
+	case *protocol.IntReply:
+		return r.Code != 0, nil
+	case *protocol.StatusReply:
+		return r.Status == "OK", nil
+	}
+	return false, unexpected(reply, "bool")
+}
+
+// elements returns the children of array, set and push reply
+func elements(reply redis.Reply) ([]redis.Reply, bool) {
+	switch r := reply.(type) {
+	case *protocol.MultiBulkReply:
+		replies := make([]redis.Reply, len(r.Args))
+		for i, arg := range r.Args {
+			replies[i] = protocol.MakeBulkReply(arg)
+		}
+		return replies, true
+	case *protocol.EmptyMultiBulkReply:
+		return nil, true
+	case *protocol.MultiRawReply:
+		return r.Replies, true
+	case *protocol.SetReply:
+		return r.Members, true
+	case *protocol.PushReply:
+		return r.Replies, true
+	}
+	return nil, false
+}
+
+// Values converts aggregate reply to []redis.Reply, map reply is flattened into key value key value ...
+func Values(reply redis.Reply, err error) ([]redis.Reply, error) {
+	reply, err = checkReply(reply, err)
+	if err != nil {
+		return nil, err
+	}
+	if r, ok := reply.(*protocol.MapReply); ok {
+		return protocol.ToResp2(r).(*protocol.MultiRawReply).Replies, nil
+	}
+	replies, ok := elements(reply)
+	if !ok {
+		return nil, unexpected(reply, "array")
+	}
+	return replies, nil
+}
+
+// Strings converts aggregate reply to []string, nil elements are converted to empty string
+func Strings(reply redis.Reply, err error) ([]string, error) {
+	replies, err := Values(reply, err)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, len(replies))
+	for i, r := range replies {
+		s, err := String(r, nil)
+		if err != nil && err != ErrNil {
+			return nil, err
+		}
+		result[i] = s
+	}
+	return result, nil
+}
+
+// StringMap converts map reply or array of key value pairs (such as HGETALL in RESP2) to map
+func StringMap(reply redis.Reply, err error) (map[string]string, error) {
+	values, err := Strings(reply, err)
+	if err != nil {
+		return nil, err
+	}
+	if len(values)%2 != 0 {
+		return nil, errors.New("client: StringMap expects even number of values")
+	}
+	result := make(map[string]string, len(values)/2)
+	for i := 0; i < len(values); i += 2 {
+		result[values[i]] = values[i+1]
+	}
+	return result, nil
+}
@@ -0,0 +1,286 @@
+package connection
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/atomwqh/MyGodis/config"
+	"github.com/atomwqh/MyGodis/interface/tcp"
+	"github.com/atomwqh/MyGodis/lib/logger"
+	"github.com/atomwqh/MyGodis/lib/sync/wait"
+	"github.com/atomwqh/MyGodis/redis/protocol"
+)
+
+// 回复先写入输出缓冲, 一批命令执行完后由 Flush 一次性发送.
+// 正在 Flush 的 goroutine 会把期间新写入缓冲的数据一起发出, 其他 goroutine 不会阻塞在慢客户端上,
+// 输出缓冲超过 client-output-buffer-limit 的客户端会被断开.
+// 其他客户端 Push 的消息由每个连接自己的 flusher goroutine 发送, 它在第一次 Push 时启动, 连接关闭时退出
+
+// ErrOutputBufferLimit means client is disconnected since it can't keep up with replies
+var ErrOutputBufferLimit = errors.New("output buffer limit reached")
+
+// maxReusedBuffer is the max capacity of output buffer kept for reuse after flushed
+const maxReusedBuffer = 64 * 1024
+
+// Connection represents a connection with a redis-cli
+type Connection struct {
+	conn net.Conn
+
+	// wait until finish sending data, used for graceful shutdown
+	sendingData wait.Wait
+
+	// pushWake wakes up the flusher started by the first Push, done stops it
+	pushOnce  sync.Once
+	pushWake  chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// protects output buffer
+	mu        sync.Mutex
+	outBuf    []byte
+	inflight  int  // bytes being written by flushing goroutine
+	flushing  bool // a goroutine is writing outBuf
+	softSince time.Time
+	overLimit bool
+	class     int
+
+	id        uint64
+	createdAt time.Time
+	// replyMode and closeAfterReply are only accessed by the goroutine executing commands of the connection
+	replyMode       int
+	closeAfterReply bool
+
+	// fields below are read by other clients running CLIENT LIST or ACL DELUSER, they must be accessed atomically
+	selectedDB int32
+	// RESP version, switched by HELLO
+	protocol int32
+	// name of ACL user
+	user            atomic.Value
+	name            atomic.Value
+	lastCmd         atomic.Value
+	lastInteraction int64 // unix nano
+	queryBufSize    int64
+	noEvict         int32 // 1 means CLIENT NO-EVICT on
+	tracking        int32 // 1 means CLIENT TRACKING on
+	monitor         int32 // 1 means the connection runs MONITOR
+	redirect        uint64
+}
+
+// idCounter generates id of connections, the first id is 1 like redis
+var idCounter uint64
+
+// NewConn creates Connection instance
+func NewConn(conn net.Conn) *Connection {
+	now := time.Now()
+	return &Connection{
+		conn:            conn,
+		id:              atomic.AddUint64(&idCounter, 1),
+		createdAt:       now,
+		lastInteraction: now.UnixNano(),
+		protocol:        protocol.RESP2,
+		done:            make(chan struct{}),
+	}
+}
+
+// RemoteAddr returns the remote network address
+func (c *Connection) RemoteAddr() string {
+	addr := c.conn.RemoteAddr()
+	if addr == nil {
+		// client of unix socket may have no address
+		return ""
+	}
+	return addr.String()
+}
+
+// Close disconnect with the client
+func (c *Connection) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+	c.sendingData.WaitWithTimeout(10 * time.Second)
+	_ = c.conn.Close()
+	return nil
+}
+
+// Kill closes the network connection at once, the goroutine serving it cleans up after its read fails
+func (c *Connection) Kill() error {
+	return c.conn.Close()
+}
+
+// Write sends response to client over tcp connection, data buffered before is sent first
+func (c *Connection) Write(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	if err := c.Buffer(b); err != nil {
+		return 0, err
+	}
+	return len(b), c.Flush()
+}
+
+// pendingConn is implemented by connections which buffer data themselves, e.g. netpoll connections
+type pendingConn interface {
+	Buffered() int
+}
+
+// outputBufferSize returns bytes not sent to client yet, it must be called with mu held
+func (c *Connection) outputBufferSize() int {
+	size := len(c.outBuf) + c.inflight
+	if pc, ok := c.conn.(pendingConn); ok {
+		size += pc.Buffered()
+	}
+	return size
+}
+
+// checkLimit returns whether output buffer exceeds client-output-buffer-limit, it must be called with mu held
+func (c *Connection) checkLimit() bool {
+	limit := config.Get().ClientOutputBufferLimit[c.class]
+	if limit.Hard == 0 && limit.Soft == 0 {
+		return false
+	}
+	size := int64(c.outputBufferSize())
+	if limit.Hard > 0 && size >= limit.Hard {
+		return true
+	}
+	if limit.Soft > 0 && size >= limit.Soft {
+		if c.softSince.IsZero() {
+			c.softSince = time.Now()
+		}
+		return time.Since(c.softSince) >= time.Duration(limit.SoftSeconds)*time.Second
+	}
+	c.softSince = time.Time{}
+	return false
+}
+
+// Buffer appends b to output buffer, it will be sent by Flush.
+// Client is disconnected if output buffer exceeds limit.
+func (c *Connection) Buffer(b []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.overLimit {
+		return ErrOutputBufferLimit
+	}
+	c.outBuf = append(c.outBuf, b...)
+	if c.checkLimit() {
+		c.overLimit = true
+		c.outBuf = nil
+		logger.Warn("client " + c.RemoteAddr() + " closed for overcoming of output buffer limits")
+		// net.Conn.Close doesn't block, it also stops the flushing goroutine
+		_ = c.conn.Close()
+		return ErrOutputBufferLimit
+	}
+	return nil
+}
+
+// Flush sends buffered data. If another goroutine is flushing it returns immediately, the data will be sent by that goroutine.
+func (c *Connection) Flush() error {
+	c.sendingData.Add(1)
+	defer c.sendingData.Done()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.flushing {
+		return nil
+	}
+	c.flushing = true
+	defer func() {
+		c.flushing = false
+	}()
+	for len(c.outBuf) > 0 {
+		data := c.outBuf
+		c.outBuf = nil
+		c.inflight = len(data)
+		// others can append to buffer while we are writing
+		c.mu.Unlock()
+		_, err := c.conn.Write(data)
+		c.mu.Lock()
+		c.inflight = 0
+		if err != nil {
+			c.outBuf = nil
+			return err
+		}
+		if c.outBuf == nil && cap(data) <= maxReusedBuffer {
+			c.outBuf = data[:0]
+		}
+	}
+	if !c.softSince.IsZero() {
+		c.checkLimit()
+	}
+	return nil
+}
+
+// Push sends data which doesn't reply to a command of this connection, such as pub/sub messages.
+// It is called by other clients so it never blocks on slow connections.
+func (c *Connection) Push(b []byte) error {
+	if err := c.Buffer(b); err != nil {
+		return err
+	}
+	c.pushOnce.Do(func() {
+		c.pushWake = make(chan struct{}, 1)
+		go c.flushPushed()
+	})
+	select {
+	case c.pushWake <- struct{}{}:
+	default:
+		// flusher has been woken up, it sends data buffered by now
+	}
+	return nil
+}
+
+// flushPushed sends pushed data until connection is closed
+func (c *Connection) flushPushed() {
+	for {
+		select {
+		case <-c.pushWake:
+			if err := c.Flush(); err != nil {
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// SetClass sets the class of client-output-buffer-limit, it is config.ClassNormal by default.
+// Like redis, timeout doesn't apply to pub/sub clients, replicas and monitors which are quiet by design
+func (c *Connection) SetClass(class int) {
+	c.mu.Lock()
+	c.class = class
+	c.mu.Unlock()
+	if ic, ok := c.conn.(tcp.IdleExemptConn); ok {
+		ic.SetIdleExempt(class != config.ClassNormal)
+	}
+}
+
+// GetDBIndex returns selected db
+func (c *Connection) GetDBIndex() int {
+	return int(atomic.LoadInt32(&c.selectedDB))
+}
+
+// SelectDB selects a database
+func (c *Connection) SelectDB(dbNum int) {
+	atomic.StoreInt32(&c.selectedDB, int32(dbNum))
+}
+
+// GetProtocol returns the RESP version of connection
+func (c *Connection) GetProtocol() int {
+	return int(atomic.LoadInt32(&c.protocol))
+}
+
+// SetProtocol switches the RESP version of connection
+func (c *Connection) SetProtocol(version int) {
+	atomic.StoreInt32(&c.protocol, int32(version))
+}
+
+// GetUser returns the ACL user of connection
+func (c *Connection) GetUser() string {
+	name, _ := c.user.Load().(string)
+	return name
+}
+
+// SetUser changes the ACL user of connection
+func (c *Connection) SetUser(name string) {
+	c.user.Store(name)
+}
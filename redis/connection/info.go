@@ -0,0 +1,224 @@
+package connection
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/atomwqh/MyGodis/config"
+)
+
+// 连接的元信息, 用于 CLIENT LIST / CLIENT INFO / CLIENT KILL
+
+// reply modes set by CLIENT REPLY
+const (
+	ReplyOn = iota
+	ReplyOff
+	// ReplySkip skips the reply of next command
+	ReplySkip
+	// replySkipping means the current command is skipped, replies are on after it
+	replySkipping
+)
+
+// ID returns the unique id of connection
+func (c *Connection) ID() uint64 {
+	return c.id
+}
+
+// LocalAddr returns the server address the client connected to
+func (c *Connection) LocalAddr() string {
+	addr := c.conn.LocalAddr()
+	if addr == nil {
+		return ""
+	}
+	return addr.String()
+}
+
+// GetName returns the name set by CLIENT SETNAME
+func (c *Connection) GetName() string {
+	name, _ := c.name.Load().(string)
+	return name
+}
+
+// SetName sets the name of connection, empty means no name
+func (c *Connection) SetName(name string) {
+	c.name.Store(name)
+}
+
+// Age returns how long the connection has been established
+func (c *Connection) Age() time.Duration {
+	return time.Since(c.createdAt)
+}
+
+// Idle returns the time since last command
+func (c *Connection) Idle() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&c.lastInteraction)))
+}
+
+// LastCommand returns the name of last command, subcommand is separated by '|'
+func (c *Connection) LastCommand() string {
+	cmd, _ := c.lastCmd.Load().(string)
+	return cmd
+}
+
+// StartCommand records the command being executed and the size of query buffer not parsed yet
+func (c *Connection) StartCommand(name string, queryBufSize int) {
+	c.lastCmd.Store(name)
+	atomic.StoreInt64(&c.lastInteraction, time.Now().UnixNano())
+	atomic.StoreInt64(&c.queryBufSize, int64(queryBufSize))
+}
+
+// SetNoEvict changes the flag of CLIENT NO-EVICT
+func (c *Connection) SetNoEvict(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&c.noEvict, v)
+}
+
+// NoEvict returns whether client is excluded from client eviction
+func (c *Connection) NoEvict() bool {
+	return atomic.LoadInt32(&c.noEvict) == 1
+}
+
+// SetTracking records the state of CLIENT TRACKING shown by CLIENT LIST, redirect is 0 if not redirected
+func (c *Connection) SetTracking(on bool, redirect uint64) {
+	var v int32
+	if on {
+		v = 1
+	}
+	atomic.StoreUint64(&c.redirect, redirect)
+	atomic.StoreInt32(&c.tracking, v)
+}
+
+// Tracking returns whether CLIENT TRACKING is on
+func (c *Connection) Tracking() bool {
+	return atomic.LoadInt32(&c.tracking) == 1
+}
+
+// SetMonitor marks the connection as a monitor, monitors use limits of replicas like redis
+func (c *Connection) SetMonitor() {
+	atomic.StoreInt32(&c.monitor, 1)
+	c.SetClass(config.ClassReplica)
+}
+
+// IsMonitor returns whether the connection runs MONITOR
+func (c *Connection) IsMonitor() bool {
+	return atomic.LoadInt32(&c.monitor) == 1
+}
+
+// SetReplyMode changes reply mode to ReplyOn, ReplyOff or ReplySkip
+func (c *Connection) SetReplyMode(mode int) {
+	c.replyMode = mode
+}
+
+// ShouldReply is called once after each command, it returns whether the reply should be sent
+func (c *Connection) ShouldReply() bool {
+	switch c.replyMode {
+	case ReplyOff:
+		return false
+	case ReplySkip:
+		// the reply of CLIENT REPLY SKIP itself is not sent either
+		c.replyMode = replySkipping
+		return false
+	case replySkipping:
+		c.replyMode = ReplyOn
+		return false
+	}
+	return true
+}
+
+// CloseAfterReply marks connection to be closed after the reply of current command is sent
+func (c *Connection) CloseAfterReply() {
+	c.closeAfterReply = true
+}
+
+// ClosingAfterReply returns whether CloseAfterReply has been called
+func (c *Connection) ClosingAfterReply() bool {
+	return c.closeAfterReply
+}
+
+// OutputBufferSize returns bytes not sent to client yet
+func (c *Connection) OutputBufferSize() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.outputBufferSize()
+}
+
+// Type returns the type used by CLIENT LIST TYPE and CLIENT KILL TYPE
+func (c *Connection) Type() string {
+	if c.IsMonitor() {
+		// monitors only borrow the output buffer limits of replicas
+		return "normal"
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch c.class {
+	case config.ClassReplica:
+		return "replica"
+	case config.ClassPubSub:
+		return "pubsub"
+	}
+	return "normal"
+}
+
+// flags returns flags shown by CLIENT LIST
+func (c *Connection) flags() string {
+	var flags strings.Builder
+	if c.IsMonitor() {
+		flags.WriteByte('O')
+	}
+	switch c.Type() {
+	case "replica":
+		flags.WriteByte('S')
+	case "pubsub":
+		flags.WriteByte('P')
+	}
+	if c.NoEvict() {
+		flags.WriteByte('e')
+	}
+	if c.Tracking() {
+		flags.WriteByte('t')
+	}
+	if flags.Len() == 0 {
+		return "N"
+	}
+	return flags.String()
+}
+
+// Info returns a line of CLIENT LIST
+func (c *Connection) Info() string {
+	c.mu.Lock()
+	obl := len(c.outBuf)
+	omem := c.outputBufferSize()
+	c.mu.Unlock()
+	cmd := c.LastCommand()
+	if cmd == "" {
+		cmd = "NULL"
+	}
+	redir := "-1"
+	if c.Tracking() {
+		redir = strconv.FormatUint(atomic.LoadUint64(&c.redirect), 10)
+	}
+	fields := []string{
+		"id=" + strconv.FormatUint(c.id, 10),
+		"addr=" + c.RemoteAddr(),
+		"laddr=" + c.LocalAddr(),
+		"name=" + c.GetName(),
+		"age=" + strconv.FormatInt(int64(c.Age()/time.Second), 10),
+		"idle=" + strconv.FormatInt(int64(c.Idle()/time.Second), 10),
+		"flags=" + c.flags(),
+		"db=" + strconv.Itoa(c.GetDBIndex()),
+		"multi=-1",
+		"qbuf=" + strconv.FormatInt(atomic.LoadInt64(&c.queryBufSize), 10),
+		"obl=" + strconv.Itoa(obl),
+		"omem=" + strconv.Itoa(omem),
+		"cmd=" + cmd,
+		"user=" + c.GetUser(),
+		"redir=" + redir,
+		"resp=" + strconv.Itoa(c.GetProtocol()),
+	}
+	return strings.Join(fields, " ")
+}
@@ -0,0 +1,208 @@
+package eviction
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/atomwqh/MyGodis/config"
+	"github.com/atomwqh/MyGodis/datastruct/dict"
+	"github.com/atomwqh/MyGodis/interface/database"
+	"github.com/atomwqh/MyGodis/redis/latency"
+)
+
+/*
+ * 内存淘汰: 每个 DataEntity 的内存由 EntitySize 估算后累加到 Used, 超过 maxmemory 时按 maxmemory-policy 淘汰 key.
+ * 与 redis 一样使用采样: 每轮从每个 db 随机取 maxmemory-samples 个 key, 淘汰其中最合适的一个, 直到内存低于 maxmemory.
+ * 存储引擎通过 Track 注册回调来维护 Used, 原地修改数据后调用 Account
+ */
+
+// ErrOOM is returned when eviction can't free enough memory
+var ErrOOM = errors.New("OOM command not allowed when used memory > 'maxmemory'.")
+
+// sizeSamples is the number of elements sampled when accounting containers
+const sizeSamples = 5
+
+var (
+	// used and evicted must be accessed by sync/atomic
+	used    int64
+	evicted int64
+	// dbUsed is dbIndex -> *int64, memory accounted for keys of each db, so that a whole db can be released at once
+	dbUsed sync.Map
+	// mu allows one eviction at a time
+	mu sync.Mutex
+	// nextDB is the db which allkeys-random and volatile-random start from
+	nextDB int
+)
+
+// Used returns memory accounted for all keys
+func Used() int64 {
+	return atomic.LoadInt64(&used)
+}
+
+// EvictedKeys returns the number of keys evicted since server started
+func EvictedKeys() int64 {
+	return atomic.LoadInt64(&evicted)
+}
+
+// dbCounter returns the memory counter of db
+func dbCounter(dbIndex int) *int64 {
+	if counter, ok := dbUsed.Load(dbIndex); ok {
+		return counter.(*int64)
+	}
+	counter, _ := dbUsed.LoadOrStore(dbIndex, new(int64))
+	return counter.(*int64)
+}
+
+// Adjust adds delta to used memory of db
+func Adjust(dbIndex int, delta int64) {
+	if delta == 0 {
+		return
+	}
+	atomic.AddInt64(dbCounter(dbIndex), delta)
+	atomic.AddInt64(&used, delta)
+}
+
+// Account updates used memory after entity of db is inserted or modified
+func Account(dbIndex int, key string, entity *database.DataEntity) {
+	size := EntitySize(key, entity, sizeSamples)
+	Adjust(dbIndex, size-entity.SwapSize(size))
+}
+
+// Release removes memory of entity from used memory after it is deleted from db
+func Release(dbIndex int, entity *database.DataEntity) {
+	Adjust(dbIndex, -entity.SwapSize(0))
+}
+
+// ReleaseDB removes memory of all keys of db from used memory and returns it, it is used after the dict of db is detached.
+// Keys inserted or deleted while detaching make the result inexact, the caller corrects it by Adjust
+func ReleaseDB(dbIndex int) int64 {
+	size := atomic.SwapInt64(dbCounter(dbIndex), 0)
+	atomic.AddInt64(&used, -size)
+	return size
+}
+
+// Track accounts memory of keys inserted into or deleted from engine, it takes both key event callbacks of engine
+func Track(engine database.DBEngine) {
+	engine.SetKeyInsertedCallback(func(dbIndex int, key string, entity *database.DataEntity) {
+		entity.Touch()
+		Account(dbIndex, key, entity)
+	})
+	engine.SetKeyDeletedCallback(func(dbIndex int, key string, entity *database.DataEntity) {
+		Release(dbIndex, entity)
+	})
+}
+
+// Keyspace is implemented by storage engine whose keys can be evicted
+type Keyspace interface {
+	// Dicts returns data (key -> *database.DataEntity) and ttl (key -> time.Time) of db
+	Dicts(dbIndex int) (data *dict.ConcurrentDict, ttl *dict.ConcurrentDict)
+	// Evict removes key like DEL, memory of the key must be released by the deleted callback
+	Evict(dbIndex int, key string)
+}
+
+// candidate is a key sampled for eviction, the one with the highest score is evicted
+type candidate struct {
+	dbIndex int
+	key     string
+	score   int64
+}
+
+// FreeMemory evicts keys until used memory is not more than maxmemory, it returns the keys evicted.
+// ErrOOM is returned if the policy is noeviction or there is no key to evict.
+func FreeMemory(ks Keyspace) ([]string, error) {
+	props := config.Get()
+	if props.MaxMemory <= 0 || Used() <= props.MaxMemory {
+		return nil, nil
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	start := time.Now()
+	var keys []string
+	defer func() {
+		if len(keys) > 0 {
+			latency.Record(latency.EvictionCycle, time.Since(start))
+		}
+	}()
+	for Used() > props.MaxMemory {
+		if props.MaxMemoryPolicy == config.NoEviction {
+			return keys, ErrOOM
+		}
+		best, ok := pick(ks, props)
+		if !ok {
+			return keys, ErrOOM
+		}
+		ks.Evict(best.dbIndex, best.key)
+		atomic.AddInt64(&evicted, 1)
+		keys = append(keys, best.key)
+	}
+	return keys, nil
+}
+
+// pick samples keys of all dbs and returns the best one to evict
+func pick(ks Keyspace, props *config.ServerProperties) (best candidate, found bool) {
+	policy := props.MaxMemoryPolicy
+	samples := props.MaxMemorySamples
+	if samples <= 0 {
+		samples = 1
+	}
+	random := policy == config.AllKeysRandom || policy == config.VolatileRandom
+	for i := 0; i < props.Databases; i++ {
+		dbIndex := i
+		if random {
+			dbIndex = (nextDB + i) % props.Databases
+		}
+		data, ttl := ks.Dicts(dbIndex)
+		if data == nil {
+			continue
+		}
+		from := data
+		if policy.Volatile() {
+			from = ttl
+		}
+		if from == nil || from.Len() == 0 {
+			continue
+		}
+		if random {
+			keys := from.RandomDistinctKeys(1)
+			if len(keys) == 0 {
+				continue
+			}
+			nextDB = (dbIndex + 1) % props.Databases
+			return candidate{dbIndex: dbIndex, key: keys[0]}, true
+		}
+		for _, key := range from.RandomDistinctKeys(samples) {
+			score, ok := evictionScore(policy, key, data, ttl)
+			if ok && (!found || score > best.score) {
+				best = candidate{dbIndex: dbIndex, key: key, score: score}
+				found = true
+			}
+		}
+	}
+	return best, found
+}
+
+// evictionScore returns how much key is preferred to be evicted, ok is false if the key has been removed
+func evictionScore(policy config.EvictionPolicy, key string, data, ttl *dict.ConcurrentDict) (score int64, ok bool) {
+	if policy == config.VolatileTTL {
+		val, exists := ttl.Get(key)
+		if !exists {
+			return 0, false
+		}
+		// the sooner key expires, the higher the score is
+		return math.MaxInt64 - val.(time.Time).UnixNano(), true
+	}
+	val, exists := data.Get(key)
+	if !exists {
+		return 0, false
+	}
+	entity := val.(*database.DataEntity)
+	switch policy {
+	case config.AllKeysLFU, config.VolatileLFU:
+		return math.MaxUint8 - int64(entity.Freq()), true
+	default:
+		return int64(entity.Idle()), true
+	}
+}
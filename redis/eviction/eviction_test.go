@@ -0,0 +1,134 @@
+package eviction
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/atomwqh/MyGodis/config"
+	"github.com/atomwqh/MyGodis/datastruct/dict"
+	"github.com/atomwqh/MyGodis/datastruct/set"
+	"github.com/atomwqh/MyGodis/interface/database"
+)
+
+// keyspace keeps keys in db 0
+type keyspace struct {
+	data *dict.ConcurrentDict
+	ttl  *dict.ConcurrentDict
+}
+
+func makeKeyspace() *keyspace {
+	return &keyspace{data: dict.MakeConcurrent(16), ttl: dict.MakeConcurrent(16)}
+}
+
+func (ks *keyspace) Dicts(dbIndex int) (*dict.ConcurrentDict, *dict.ConcurrentDict) {
+	if dbIndex != 0 {
+		return nil, nil
+	}
+	return ks.data, ks.ttl
+}
+
+func (ks *keyspace) Evict(dbIndex int, key string) {
+	val, result := ks.data.Remove(key)
+	ks.ttl.Remove(key)
+	if result > 0 {
+		Release(dbIndex, val.(*database.DataEntity))
+	}
+}
+
+func (ks *keyspace) set(key string, value string, expire time.Duration) {
+	entity := &database.DataEntity{Data: []byte(value)}
+	entity.Touch()
+	ks.data.Put(key, entity)
+	if expire > 0 {
+		ks.ttl.Put(key, time.Now().Add(expire))
+	}
+	Account(0, key, entity)
+}
+
+func (ks *keyspace) clear() {
+	for _, key := range ks.data.Keys() {
+		ks.Evict(0, key)
+	}
+}
+
+func setMaxMemory(maxMemory int64, policy config.EvictionPolicy) {
+	config.Update(func(props *config.ServerProperties) {
+		props.MaxMemory = maxMemory
+		props.MaxMemoryPolicy = policy
+		props.MaxMemorySamples = 100
+	})
+}
+
+func TestEntitySize(t *testing.T) {
+	small := EntitySize("k", &database.DataEntity{Data: []byte("v")}, 0)
+	big := EntitySize("k", &database.DataEntity{Data: make([]byte, 1000)}, 0)
+	if big-small != 999 {
+		t.Errorf("unexpected sizes %d %d", small, big)
+	}
+	members := set.Make()
+	for i := 0; i < 100; i++ {
+		members.Add(strconv.Itoa(1000 + i))
+	}
+	exact := EntitySize("k", &database.DataEntity{Data: members}, 0)
+	sampled := EntitySize("k", &database.DataEntity{Data: members}, 5)
+	if exact != sampled || exact < 100*(fieldOverhead+4) {
+		t.Errorf("unexpected set sizes %d %d", exact, sampled)
+	}
+}
+
+func TestFreeMemory(t *testing.T) {
+	defer setMaxMemory(0, config.NoEviction)
+	ks := makeKeyspace()
+	defer ks.clear()
+	for i := 0; i < 10; i++ {
+		ks.set("persistent"+strconv.Itoa(i), "value", 0)
+		ks.set("volatile"+strconv.Itoa(i), "value", time.Duration(i+1)*time.Hour)
+	}
+	entitySize := func(key string) int64 {
+		val, _ := ks.data.Get(key)
+		return val.(*database.DataEntity).Size()
+	}
+	volatileSize, persistentSize := entitySize("volatile0"), entitySize("persistent0")
+
+	setMaxMemory(Used()-1, config.NoEviction)
+	if keys, err := FreeMemory(ks); err != ErrOOM || len(keys) != 0 {
+		t.Fatalf("noeviction should not evict keys, got %v %v", keys, err)
+	}
+
+	// the keys expiring first are evicted
+	setMaxMemory(Used()-2*volatileSize, config.VolatileTTL)
+	keys, err := FreeMemory(ks)
+	if err != nil || len(keys) != 2 || keys[0] != "volatile0" || keys[1] != "volatile1" {
+		t.Fatalf("unexpected evicted keys %v %v", keys, err)
+	}
+
+	// persistent keys are never evicted by volatile policies
+	setMaxMemory(persistentSize, config.VolatileRandom)
+	if keys, err = FreeMemory(ks); err != ErrOOM || len(keys) != 8 || ks.ttl.Len() != 0 {
+		t.Fatalf("unexpected evicted keys %v %v", keys, err)
+	}
+
+	before := EvictedKeys()
+	setMaxMemory(persistentSize*5, config.AllKeysLRU)
+	if keys, err = FreeMemory(ks); err != nil || len(keys) != 5 || Used() > persistentSize*5 {
+		t.Fatalf("unexpected evicted keys %v %v", keys, err)
+	}
+	if EvictedKeys()-before != 5 {
+		t.Errorf("unexpected evicted count %d", EvictedKeys()-before)
+	}
+}
+
+func TestLFU(t *testing.T) {
+	entity := &database.DataEntity{Data: []byte("v")}
+	if entity.Freq() != database.LFUInitVal {
+		t.Errorf("new key should have counter %d, got %d", database.LFUInitVal, entity.Freq())
+	}
+	for i := 0; i < 1000; i++ {
+		entity.Touch()
+	}
+	// counter grows logarithmically with lfu-log-factor 10
+	if freq := entity.Freq(); freq <= database.LFUInitVal || freq > 30 {
+		t.Errorf("unexpected counter %d", freq)
+	}
+}
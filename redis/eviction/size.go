@@ -0,0 +1,89 @@
+package eviction
+
+import (
+	"github.com/atomwqh/MyGodis/datastruct/dict"
+	"github.com/atomwqh/MyGodis/datastruct/list"
+	"github.com/atomwqh/MyGodis/datastruct/set"
+	"github.com/atomwqh/MyGodis/interface/database"
+)
+
+// 内存是估算的: 固定开销加上数据长度. 容器只读取前 samples 个元素, 用平均长度乘以元素个数,
+// 所以估算的耗时不随容器大小增长
+
+// approximate overheads in bytes
+const (
+	// keyOverhead is the dict entry, DataEntity and header of key
+	keyOverhead = 64
+	// elementOverhead is the header of an element in list
+	elementOverhead = 16
+	// fieldOverhead is the map entry of a member in set or a field in hash
+	fieldOverhead = 48
+)
+
+// hash is implemented by dicts stored as hash
+type hash interface {
+	Len() int
+	ForEach(consumer dict.Consumer)
+}
+
+// valueSize returns the size of an element
+func valueSize(val interface{}) int64 {
+	switch v := val.(type) {
+	case []byte:
+		return int64(len(v))
+	case string:
+		return int64(len(v))
+	}
+	return 8
+}
+
+// estimate returns total size of n elements by the sizes of the sampled ones
+func estimate(n int, sampled int, sum int64) int64 {
+	if sampled == 0 {
+		return 0
+	}
+	return sum * int64(n) / int64(sampled)
+}
+
+// EntitySize estimates the memory used by key and entity, samples is the number of elements read from containers,
+// 0 means all elements
+func EntitySize(key string, entity *database.DataEntity, samples int) int64 {
+	size := int64(keyOverhead + len(key))
+	more := func(sampled int) bool {
+		return samples <= 0 || sampled < samples
+	}
+	switch data := entity.Data.(type) {
+	case []byte:
+		size += int64(len(data))
+	case *list.QuickList:
+		var sum int64
+		sampled := 0
+		data.ForEach(func(i int, v any) bool {
+			sum += elementOverhead + valueSize(v)
+			sampled++
+			return more(sampled)
+		})
+		size += estimate(data.Len(), sampled, sum)
+	case *set.Set:
+		var sum int64
+		sampled := 0
+		data.ForEach(func(member string) bool {
+			sum += fieldOverhead + int64(len(member))
+			sampled++
+			return more(sampled)
+		})
+		size += estimate(data.Len(), sampled, sum)
+	case hash:
+		var sum int64
+		sampled := 0
+		data.ForEach(func(field string, v interface{}) bool {
+			sum += fieldOverhead + int64(len(field)) + valueSize(v)
+			sampled++
+			return more(sampled)
+		})
+		size += estimate(data.Len(), sampled, sum)
+	default:
+		size += 8
+	}
+	return size
+}
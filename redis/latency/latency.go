@@ -0,0 +1,175 @@
+package latency
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atomwqh/MyGodis/config"
+)
+
+// 延迟监控: 耗时不低于 latency-monitor-threshold 的事件按类别记录, 同一秒内的样本只保留最大值,
+// 每个类别最多保留 HistoryLen 个样本. 命令执行和 maxmemory 淘汰通过 Record 上报,
+// fsync, 过期清理, fork 等类别在存储引擎实现持久化和主动过期时再加入
+
+// event classes reported by modules
+const (
+	Command = "command"
+	// EvictionCycle is a round of evicting keys to free memory under maxmemory
+	EvictionCycle = "eviction-cycle"
+)
+
+// HistoryLen is the max number of samples of an event
+const HistoryLen = 160
+
+// Sample is a latency spike
+type Sample struct {
+	Time    time.Time
+	Latency time.Duration
+}
+
+type eventHistory struct {
+	samples []Sample // oldest first
+	max     time.Duration
+}
+
+var (
+	mu     sync.Mutex
+	events = make(map[string]*eventHistory)
+)
+
+// Threshold returns latency-monitor-threshold, 0 means disabled
+func Threshold() time.Duration {
+	return time.Duration(config.Get().LatencyMonitorThreshold) * time.Millisecond
+}
+
+// Record adds a sample if elapsed reaches latency-monitor-threshold
+func Record(event string, elapsed time.Duration) {
+	threshold := Threshold()
+	if threshold <= 0 || elapsed < threshold {
+		return
+	}
+	now := time.Now().Truncate(time.Second)
+	mu.Lock()
+	defer mu.Unlock()
+	history := events[event]
+	if history == nil {
+		history = &eventHistory{}
+		events[event] = history
+	}
+	if elapsed > history.max {
+		history.max = elapsed
+	}
+	if n := len(history.samples); n > 0 && history.samples[n-1].Time.Equal(now) {
+		// keep the max sample of a second
+		if elapsed > history.samples[n-1].Latency {
+			history.samples[n-1].Latency = elapsed
+		}
+		return
+	}
+	if len(history.samples) >= HistoryLen {
+		history.samples = append(history.samples[:0], history.samples[1:]...)
+	}
+	history.samples = append(history.samples, Sample{Time: now, Latency: elapsed})
+}
+
+// Latest is the latest sample and the max latency of an event
+type Latest struct {
+	Event string
+	Sample
+	Max time.Duration
+}
+
+// LatestSamples returns the latest sample of each event sorted by event name
+func LatestSamples() []Latest {
+	mu.Lock()
+	defer mu.Unlock()
+	result := make([]Latest, 0, len(events))
+	for event, history := range events {
+		result = append(result, Latest{
+			Event:  event,
+			Sample: history.samples[len(history.samples)-1],
+			Max:    history.max,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Event < result[j].Event
+	})
+	return result
+}
+
+// History returns samples of event, oldest first
+func History(event string) []Sample {
+	mu.Lock()
+	defer mu.Unlock()
+	if history := events[event]; history != nil {
+		return append([]Sample(nil), history.samples...)
+	}
+	return nil
+}
+
+// Reset clears history of given events or all events if none is given, it returns the number of events cleared
+func Reset(names ...string) int {
+	mu.Lock()
+	defer mu.Unlock()
+	if len(names) == 0 {
+		n := len(events)
+		events = make(map[string]*eventHistory)
+		return n
+	}
+	n := 0
+	for _, name := range names {
+		if _, ok := events[name]; ok {
+			delete(events, name)
+			n++
+		}
+	}
+	return n
+}
+
+// advices for events in Doctor
+var advices = map[string]string{
+	Command: "Check SLOWLOG GET for commands with high latency, avoid O(N) commands on big keys.",
+	EvictionCycle: "Many keys are evicted to free memory for big writes, raise maxmemory or " +
+		"reduce maxmemory-samples.",
+}
+
+// Doctor returns a human readable report of latency spikes
+func Doctor() string {
+	if Threshold() <= 0 {
+		return "Latency monitoring is disabled in this MyGodis instance. " +
+			"You may use \"CONFIG SET latency-monitor-threshold <milliseconds>.\" to enable it.\n"
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) == 0 {
+		return "I'm glad to inform you that no latency spikes were detected in this MyGodis instance.\n"
+	}
+	names := make([]string, 0, len(events))
+	for name := range events {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buf strings.Builder
+	buf.WriteString("Latency spikes were detected in this MyGodis instance:\n\n")
+	for i, name := range names {
+		history := events[name]
+		var sum time.Duration
+		for _, s := range history.samples {
+			sum += s.Latency
+		}
+		avg := sum / time.Duration(len(history.samples))
+		period := history.samples[len(history.samples)-1].Time.Sub(history.samples[0].Time)
+		fmt.Fprintf(&buf, "%d. %s: %d latency spikes (average %dms, period %s). Worst all time event %dms.\n",
+			i+1, name, len(history.samples), avg.Milliseconds(), period, history.max.Milliseconds())
+	}
+	buf.WriteString("\nAdvices:\n")
+	for _, name := range names {
+		if advice, ok := advices[name]; ok {
+			buf.WriteString("- " + name + ": " + advice + "\n")
+		}
+	}
+	return buf.String()
+}
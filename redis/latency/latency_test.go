@@ -0,0 +1,42 @@
+package latency
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atomwqh/MyGodis/config"
+)
+
+func TestRecord(t *testing.T) {
+	defer Reset()
+	Record(Command, time.Second)
+	if len(LatestSamples()) != 0 {
+		t.Error("samples should not be recorded when latency monitor is disabled")
+	}
+	config.Update(func(props *config.ServerProperties) {
+		props.LatencyMonitorThreshold = 10
+	})
+	defer config.Update(func(props *config.ServerProperties) {
+		props.LatencyMonitorThreshold = 0
+	})
+
+	Record(Command, 5*time.Millisecond)
+	Record(Command, 20*time.Millisecond)
+	Record(Command, 30*time.Millisecond)
+	Record(EvictionCycle, 15*time.Millisecond)
+	latest := LatestSamples()
+	if len(latest) != 2 || latest[0].Event != Command || latest[0].Max != 30*time.Millisecond {
+		t.Fatalf("unexpected latest samples %+v", latest)
+	}
+	// samples in the same second are merged
+	if history := History(Command); len(history) != 1 || history[0].Latency != 30*time.Millisecond {
+		t.Errorf("unexpected history %+v", history)
+	}
+	if report := Doctor(); !strings.Contains(report, "command: 1 latency spikes") {
+		t.Errorf("unexpected report %q", report)
+	}
+	if n := Reset(EvictionCycle, "nosuchevent"); n != 1 || len(History(EvictionCycle)) != 0 {
+		t.Errorf("unexpected reset result %d", n)
+	}
+}
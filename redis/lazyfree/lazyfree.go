@@ -0,0 +1,150 @@
+package lazyfree
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/atomwqh/MyGodis/config"
+	"github.com/atomwqh/MyGodis/datastruct/dict"
+	"github.com/atomwqh/MyGodis/interface/database"
+	"github.com/atomwqh/MyGodis/redis/eviction"
+)
+
+/*
+ * 惰性释放: UNLINK, FLUSHDB ASYNC, FLUSHALL ASYNC 以及开启 lazyfree-lazy-expire 时的过期删除,
+ * 先把 key 从 dict 中摘下 (耗时与 key 的数量和 value 的大小无关), 剩下的工作交给后台 goroutine, 命令立即返回.
+ * 摘下时立即扣除内存记账, 这样 maxmemory 不会因为记账滞后而淘汰其他 key: 整个 db 通过 eviction.ReleaseDB 按 db 扣除,
+ * 后台 goroutine 再逐个遍历摘下的 key, 校正摘下期间并发写入造成的误差, 然后丢弃对 value 的引用交给 GC 回收.
+ * 元素不超过 Threshold 的 value 直接释放, 放进队列反而更慢
+ */
+
+// Threshold is the max number of elements of a value freed in place, like LAZYFREE_THRESHOLD of redis
+const Threshold = 64
+
+type job struct {
+	objects int64
+	free    func()
+}
+
+var (
+	// pending and freed must be accessed by sync/atomic
+	pending int64
+	freed   int64
+
+	// queue is unbounded, so that submitting never blocks or frees in place
+	mu    sync.Mutex
+	cond  = sync.NewCond(&mu)
+	queue []*job
+	start sync.Once
+)
+
+// Pending returns the number of objects waiting to be freed
+func Pending() int64 {
+	return atomic.LoadInt64(&pending)
+}
+
+// Freed returns the number of objects freed in background since server started
+func Freed() int64 {
+	return atomic.LoadInt64(&freed)
+}
+
+func worker() {
+	for {
+		mu.Lock()
+		for len(queue) == 0 {
+			cond.Wait()
+		}
+		j := queue[0]
+		queue[0] = nil
+		queue = queue[1:]
+		mu.Unlock()
+
+		j.free()
+		atomic.AddInt64(&pending, -j.objects)
+		atomic.AddInt64(&freed, j.objects)
+	}
+}
+
+// Submit runs free by the background goroutine in order, objects is the number of objects freed by it.
+// Storage engines may submit values of their own types, it never blocks
+func Submit(objects int64, free func()) {
+	start.Do(func() {
+		go worker()
+	})
+	atomic.AddInt64(&pending, objects)
+	mu.Lock()
+	queue = append(queue, &job{objects: objects, free: free})
+	mu.Unlock()
+	cond.Signal()
+}
+
+// effort returns the number of allocations to free entity
+func effort(entity *database.DataEntity) int {
+	if data, ok := entity.Data.(interface{ Len() int }); ok {
+		return data.Len()
+	}
+	return 1
+}
+
+// FreeEntity frees entity detached from db, its memory accounting is released at once,
+// the last reference to a big value is dropped in background
+func FreeEntity(dbIndex int, entity *database.DataEntity) {
+	eviction.Release(dbIndex, entity)
+	if effort(entity) <= Threshold {
+		return
+	}
+	// entity must not be cleared here, commands which got it before it was detached may still read it
+	Submit(1, func() {
+		_ = entity
+	})
+}
+
+// Unlink removes key from data (key -> *database.DataEntity) and ttl (key -> time.Time) of db like UNLINK,
+// the value is freed in background if it is big. It returns whether key existed
+func Unlink(dbIndex int, data, ttl *dict.ConcurrentDict, key string) bool {
+	val, result := data.Remove(key)
+	ttl.Remove(key)
+	if result == 0 {
+		return false
+	}
+	FreeEntity(dbIndex, val.(*database.DataEntity))
+	return true
+}
+
+// FlushAsync removes all keys of db like FLUSHDB ASYNC and returns the number of keys removed.
+// Keys are freed in background, the time it takes doesn't depend on the number of keys
+func FlushAsync(dbIndex int, data, ttl *dict.ConcurrentDict) int {
+	detached := data.Detach()
+	ttl.Clear()
+	n := detached.Len()
+	if n == 0 {
+		return 0
+	}
+	released := eviction.ReleaseDB(dbIndex)
+	Submit(int64(n), func() {
+		var size int64
+		detached.ForEach(func(key string, val interface{}) bool {
+			size += val.(*database.DataEntity).SwapSize(0)
+			return true
+		})
+		// keys changed while detaching are accounted for db but not released by ReleaseDB, or the other way around
+		eviction.Adjust(dbIndex, released-size)
+		detached.Clear()
+	})
+	return n
+}
+
+// Expire removes an expired key, the value is freed in background if lazyfree-lazy-expire is yes.
+// Storage engines call it instead of removing expired keys themselves. It returns whether key existed
+func Expire(dbIndex int, data, ttl *dict.ConcurrentDict, key string) bool {
+	if config.Get().LazyfreeLazyExpire {
+		return Unlink(dbIndex, data, ttl, key)
+	}
+	val, result := data.Remove(key)
+	ttl.Remove(key)
+	if result == 0 {
+		return false
+	}
+	eviction.Release(dbIndex, val.(*database.DataEntity))
+	return true
+}
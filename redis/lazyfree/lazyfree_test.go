@@ -0,0 +1,99 @@
+package lazyfree
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/atomwqh/MyGodis/config"
+	"github.com/atomwqh/MyGodis/datastruct/dict"
+	"github.com/atomwqh/MyGodis/datastruct/set"
+	"github.com/atomwqh/MyGodis/interface/database"
+	"github.com/atomwqh/MyGodis/redis/eviction"
+)
+
+func put(data *dict.ConcurrentDict, key string, value interface{}) {
+	entity := &database.DataEntity{Data: value}
+	data.Put(key, entity)
+	eviction.Account(0, key, entity)
+}
+
+// wait blocks until background goroutine has freed everything
+func wait(t *testing.T) {
+	deadline := time.Now().Add(time.Second)
+	for Pending() != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if Pending() != 0 {
+		t.Fatalf("%d objects are not freed", Pending())
+	}
+}
+
+func TestFlushAsync(t *testing.T) {
+	data, ttl := dict.MakeConcurrent(16), dict.MakeConcurrent(16)
+	used := eviction.Used()
+	for i := 0; i < 1000; i++ {
+		put(data, strconv.Itoa(i), []byte("v"))
+		ttl.Put(strconv.Itoa(i), time.Now().Add(time.Hour))
+	}
+	block := make(chan struct{})
+	Submit(0, func() {
+		<-block
+	})
+	before := Freed()
+	if n := FlushAsync(0, data, ttl); n != 1000 {
+		t.Errorf("expect 1000 keys flushed, actual %d", n)
+	}
+	if data.Len() != 0 || ttl.Len() != 0 || len(data.Keys()) != 0 {
+		t.Fatal("db should be empty after flush")
+	}
+	// released when detached, otherwise maxmemory would evict other keys
+	if eviction.Used() != used {
+		t.Errorf("memory of flushed keys is not released, used %d, expect %d", eviction.Used(), used)
+	}
+	if Pending() != 1000 {
+		t.Errorf("flushed keys should be freed in background, pending %d", Pending())
+	}
+	put(data, "new", []byte("v"))
+	close(block)
+	wait(t)
+	if Freed()-before != 1000 {
+		t.Errorf("expect 1000 keys freed, actual %d", Freed()-before)
+	}
+	if eviction.Used()-used != eviction.EntitySize("new", &database.DataEntity{Data: []byte("v")}, 0) {
+		t.Errorf("memory of new key should be kept after flushed keys are freed")
+	}
+	Unlink(0, data, ttl, "new")
+}
+
+func TestExpire(t *testing.T) {
+	data, ttl := dict.MakeConcurrent(16), dict.MakeConcurrent(16)
+	big := set.Make()
+	for i := 0; i <= Threshold; i++ {
+		big.Add(strconv.Itoa(i))
+	}
+	used := eviction.Used()
+	put(data, "a", big)
+	put(data, "b", big)
+	before := Freed()
+	if !Expire(0, data, ttl, "a") || Expire(0, data, ttl, "a") {
+		t.Error("Expire should return whether key existed")
+	}
+	if Freed() != before || Pending() != 0 {
+		t.Error("expired value should be freed in place")
+	}
+	config.Update(func(props *config.ServerProperties) {
+		props.LazyfreeLazyExpire = true
+	})
+	defer config.Update(func(props *config.ServerProperties) {
+		props.LazyfreeLazyExpire = false
+	})
+	Expire(0, data, ttl, "b")
+	wait(t)
+	if Freed()-before != 1 || data.Len() != 0 {
+		t.Error("expired value should be freed in background")
+	}
+	if eviction.Used() != used {
+		t.Errorf("memory of expired keys is not released, used %d, expect %d", eviction.Used(), used)
+	}
+}
@@ -0,0 +1,38 @@
+package parser
+
+import "errors"
+
+// ProtocolError means the client sent something which violates RESP.
+// If Fatal is false the malformed line has been consumed entirely and Reader can go on,
+// otherwise Reader lost its position in the stream and the connection must be closed.
+type ProtocolError struct {
+	Msg   string
+	Fatal bool
+}
+
+func (e *ProtocolError) Error() string {
+	return "Protocol error: " + e.Msg
+}
+
+func recoverableErr(msg string) error {
+	return &ProtocolError{Msg: msg}
+}
+
+func fatalErr(msg string) error {
+	return &ProtocolError{Msg: msg, Fatal: true}
+}
+
+// IsRecoverable returns whether Reader can still be used after err
+func IsRecoverable(err error) bool {
+	var protoErr *ProtocolError
+	return errors.As(err, &protoErr) && !protoErr.Fatal
+}
+
+// toFatal marks errors within aggregate types as fatal, since rest elements of the aggregate are left in stream
+func toFatal(err error) error {
+	var protoErr *ProtocolError
+	if errors.As(err, &protoErr) && !protoErr.Fatal {
+		return fatalErr(protoErr.Msg)
+	}
+	return err
+}
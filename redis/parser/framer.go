@@ -0,0 +1,157 @@
+package parser
+
+import "bytes"
+
+// Framer 在数据分多次到达时增量地找出完整请求的边界, 已扫描的部分不会重复扫描,
+// 只有完整的请求才交给 Reader 解析. 超大的 bulk 分多次到达时总开销与数据长度成正比.
+// 请求只能是 bulk string 组成的数组或 inline 命令, 其他格式交给 Reader 报告错误
+
+// Framer finds the end of complete requests in data arriving in pieces, it is not thread safe
+type Framer struct {
+	limits Limits
+	// start is the end of complete requests, the incomplete one starts at it
+	start int
+	// pos is where scanning continues
+	pos int
+	// searched is where searching for the end of current line continues, a long line arriving in pieces is searched once
+	searched int
+	// elems is the number of elements left of current array, -1 means a new request starts at pos
+	elems int64
+	// body is the number of bytes left of current bulk string including CRLF
+	body int64
+	// nested is set after an element which is not a bulk string, the framer can't tell the end of request
+	nested bool
+}
+
+// NewFramer creates a Framer, requests exceeding limits are reported as complete so Reader rejects them at once
+func NewFramer(limits Limits) *Framer {
+	return &Framer{limits: limits, elems: -1}
+}
+
+// Scan scans data which starts with the data passed last time minus bytes discarded,
+// it returns the length of complete requests. ok is false if requests can't be framed, the caller should parse all data
+func (f *Framer) Scan(data []byte) (end int, ok bool) {
+	if f.nested {
+		return len(data), false
+	}
+	for f.pos < len(data) {
+		if f.body > 0 {
+			avail := int64(len(data) - f.pos)
+			if avail < f.body {
+				f.body -= avail
+				f.pos = len(data)
+				break
+			}
+			f.pos += int(f.body)
+			f.body = 0
+			f.finishElement()
+			continue
+		}
+		from := f.pos
+		if f.searched > from {
+			from = f.searched
+		}
+		i := bytes.IndexByte(data[from:], '\n')
+		if i < 0 {
+			f.searched = len(data)
+			if len(data)-f.pos > f.limits.MaxInlineSize {
+				// let Reader report too big request
+				f.finishRequest(len(data))
+			}
+			break
+		}
+		i += from - f.pos
+		line := data[f.pos : f.pos+i]
+		f.pos += i + 1
+		if len(line) > 0 && line[len(line)-1] == '\r' {
+			line = line[:len(line)-1]
+		}
+		if f.elems < 0 {
+			f.scanHeader(line)
+		} else {
+			f.scanElement(line)
+		}
+		if f.nested {
+			return len(data), false
+		}
+	}
+	return f.start, true
+}
+
+// scanHeader handles the first line of a request
+func (f *Framer) scanHeader(line []byte) {
+	if len(line) == 0 || line[0] != '*' {
+		// inline command or something rejected by Reader
+		f.finishRequest(f.pos)
+		return
+	}
+	n, ok := parseInt(line[1:])
+	if !ok || n <= 0 || n > f.limits.MaxMultiBulkLen {
+		f.finishRequest(f.pos)
+		return
+	}
+	f.elems = n
+}
+
+// scanElement handles the header line of an element
+func (f *Framer) scanElement(line []byte) {
+	if len(line) == 0 {
+		f.finishRequest(f.pos)
+		return
+	}
+	switch line[0] {
+	case '$':
+		n, ok := parseInt(line[1:])
+		if !ok || n < -1 || n > f.limits.MaxBulkLen {
+			f.finishRequest(f.pos)
+		} else if n == -1 {
+			f.finishElement()
+		} else {
+			f.body = n + 2
+		}
+	case '*', '%', '~', '>', '|', '=':
+		f.nested = true
+	default:
+		// a single line element
+		f.finishElement()
+	}
+}
+
+func (f *Framer) finishElement() {
+	f.elems--
+	if f.elems == 0 {
+		f.finishRequest(f.pos)
+	}
+}
+
+func (f *Framer) finishRequest(end int) {
+	f.start = end
+	f.pos = end
+	f.elems = -1
+	f.body = 0
+}
+
+// Discard tells framer that n bytes at the beginning of data have been consumed, n must not exceed the end of requests.
+// Complete requests not consumed, e.g. paused by CLIENT PAUSE, are not scanned again
+func (f *Framer) Discard(n int) {
+	if f.nested {
+		f.Reset()
+		return
+	}
+	f.start -= n
+	f.pos -= n
+	f.searched -= n
+	if f.searched < 0 {
+		f.searched = 0
+	}
+}
+
+// Reset forgets scanned data, the next Scan starts from the beginning of data
+func (f *Framer) Reset() {
+	f.start = 0
+	f.pos = 0
+	f.searched = 0
+	f.elems = -1
+	f.body = 0
+	f.nested = false
+}
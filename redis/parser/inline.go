@@ -0,0 +1,127 @@
+package parser
+
+// 解析 inline 命令，规则与 redis-cli 相同 (sdssplitargs):
+// 参数之间可以有任意多个空白字符, 双引号内支持 \n \r \t \b \a \" \\ 和 \xHH 转义,
+// 单引号内只支持 \' 转义, 引号闭合后必须紧跟空白或行尾
+
+func isSpace(c byte) bool {
+	switch c {
+	case ' ', '\n', '\r', '\t', '\v', '\f':
+		return true
+	}
+	return false
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func hexDigitToInt(c byte) byte {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0'
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
+
+// splitArgs splits line into arguments, the results are written into buf which must be at least as long as line.
+// It returns a recoverable ProtocolError if quotes are unbalanced.
+func splitArgs(line []byte, buf []byte) ([][]byte, error) {
+	var args [][]byte
+	i := 0
+	n := len(line)
+	for {
+		// skip blanks
+		for i < n && isSpace(line[i]) {
+			i++
+		}
+		if i == n {
+			return args, nil
+		}
+		arg := buf[:0]
+		inq := false  // inside "double quotes"
+		insq := false // inside 'single quotes'
+		done := false
+		for !done {
+			if inq {
+				if i == n {
+					return nil, recoverableErr("unbalanced quotes in request")
+				}
+				c := line[i]
+				if c == '\\' && i+3 < n && line[i+1] == 'x' && isHexDigit(line[i+2]) && isHexDigit(line[i+3]) {
+					arg = append(arg, hexDigitToInt(line[i+2])*16+hexDigitToInt(line[i+3]))
+					i += 3
+				} else if c == '\\' && i+1 < n {
+					i++
+					switch line[i] {
+					case 'n':
+						c = '\n'
+					case 'r':
+						c = '\r'
+					case 't':
+						c = '\t'
+					case 'b':
+						c = '\b'
+					case 'a':
+						c = '\a'
+					default:
+						c = line[i]
+					}
+					arg = append(arg, c)
+				} else if c == '"' {
+					// closing quote must be followed by a space or nothing at all
+					if i+1 < n && !isSpace(line[i+1]) {
+						return nil, recoverableErr("unbalanced quotes in request")
+					}
+					done = true
+				} else {
+					arg = append(arg, c)
+				}
+			} else if insq {
+				if i == n {
+					return nil, recoverableErr("unbalanced quotes in request")
+				}
+				c := line[i]
+				if c == '\\' && i+1 < n && line[i+1] == '\'' {
+					i++
+					arg = append(arg, '\'')
+				} else if c == '\'' {
+					if i+1 < n && !isSpace(line[i+1]) {
+						return nil, recoverableErr("unbalanced quotes in request")
+					}
+					done = true
+				} else {
+					arg = append(arg, c)
+				}
+			} else {
+				if i == n {
+					break
+				}
+				switch c := line[i]; {
+				case isSpace(c):
+					done = true
+				case c == '"':
+					inq = true
+				case c == '\'':
+					insq = true
+				default:
+					arg = append(arg, c)
+				}
+			}
+			if i < n {
+				i++
+			}
+		}
+		// limit capacity so that appending to an argument won't overwrite the next one
+		args = append(args, arg[:len(arg):len(arg)])
+		buf = buf[len(arg):]
+	}
+}
+
+// SplitArgs splits line into arguments with the same rules as inline commands, used by command line tools
+func SplitArgs(line string) ([][]byte, error) {
+	return splitArgs([]byte(line), make([]byte, len(line)))
+}
@@ -1,16 +1,13 @@
 package parser
 
 import (
-	"bufio"
 	"bytes"
 	"errors"
-	"github.com/atomwqh/MyGodis/interface/redis"
-	"github.com/atomwqh/MyGodis/lib/logger"
-	"github.com/atomwqh/MyGodis/redis/protocol"
 	"io"
 	"runtime/debug"
-	"strconv"
-	"strings"
+
+	"github.com/atomwqh/MyGodis/interface/redis"
+	"github.com/atomwqh/MyGodis/lib/logger"
 )
 
 // 命令解析器，用来解析RESP redis协议
@@ -22,7 +19,7 @@ type Payload struct {
 }
 
 // ParseStream reads data from io.Reader and send payloads through chan
-// 流式处理结构适合客户端/服务端
+// 流式处理结构适合客户端/服务端, 对性能敏感的场景直接使用 Reader
 func ParseStream(reader io.Reader) <-chan *Payload {
 	ch := make(chan *Payload)
 	go parse0(reader, ch)
@@ -31,37 +28,29 @@ func ParseStream(reader io.Reader) <-chan *Payload {
 
 // ParseBytes reads data from []bytes and return all replies
 func ParseBytes(data []byte) ([]redis.Reply, error) {
-	ch := make(chan *Payload)
-	reader := bytes.NewReader(data)
-	go parse0(reader, ch)
+	reader := NewReader(bytes.NewReader(data))
 	var results []redis.Reply
-	for payload := range ch {
-		if payload == nil {
-			return nil, errors.New("no protocol")
-		}
-		if payload.Err != nil {
-			if payload.Err == io.EOF {
+	for {
+		reply, err := reader.Next()
+		if err != nil {
+			if err == io.EOF {
 				break
 			}
-			return nil, payload.Err
+			return nil, err
 		}
-		results = append(results, payload.Data)
+		results = append(results, reply)
 	}
 	return results, nil
 }
 
 // ParseOne reads data from []byte and return the first payload
 func ParseOne(data []byte) (redis.Reply, error) {
-	ch := make(chan *Payload)
-	reader := bytes.NewReader(data)
-	go parse0(reader, ch)
-	payload := <-ch // parse0 will close this channel
-
-	if payload == nil {
+	reader := NewReader(bytes.NewReader(data))
+	reply, err := reader.Next()
+	if err == io.EOF {
 		return nil, errors.New("no protocol")
 	}
-
-	return payload.Data, nil
+	return reply, err
 }
 
 func parse0(rawReader io.Reader, ch chan<- *Payload) {
@@ -70,149 +59,17 @@ func parse0(rawReader io.Reader, ch chan<- *Payload) {
 			logger.Error(err, string(debug.Stack()))
 		}
 	}()
-	reader := bufio.NewReader(rawReader)
+	reader := NewReader(rawReader)
 	for {
-		line, err := reader.ReadBytes('\n')
+		reply, err := reader.Next()
 		if err != nil {
 			ch <- &Payload{Err: err}
-			close(ch)
-			return
-		}
-		length := len(line)
-		if length <= 2 || line[length-2] != '\r' {
-			// there will be some empty lines within replication traffic, ignore it
-			// meaning this line is useless
-			continue
-		}
-		// RESP 协议使用第一个字符来表示格式
-		/*
-			+ 简单字符串
-			- 错误
-			: 整数
-			$ 字符串
-			* 数组
-		*/
-		line = bytes.TrimSuffix(line, []byte{'\r', '\n'})
-		switch line[0] {
-		case '+':
-			content := string(line[1:])
-			ch <- &Payload{
-				Data: protocol.MakeStatusReply(content),
-			}
-			if strings.HasPrefix(content, "FULLRESTNC") {
-				// TODO: add code when add RDB feature
-				// there is no CRLF between RDB and following AOF, therefore it needs to be treated differently
-				//err = parseRDBBulkString(reader, ch)
-				//if err != nil {
-				//	ch <- &Payload{Err: err}
-				//	close(ch)
-				//	return
-				//}
-			}
-		case '-':
-			ch <- &Payload{
-				Data: protocol.MakeErrReply(string(line[1:])),
-			}
-		case ':':
-			value, err := strconv.ParseInt(string(line[1:]), 10, 64)
-			if err != nil {
-				protocolError(ch, "illegal number"+string(line[1:]))
+			if IsRecoverable(err) {
 				continue
 			}
-			ch <- &Payload{
-				Data: protocol.MakeIntReply(value),
-			}
-		case '$':
-			err = parseBulkString(line, reader, ch)
-			if err != nil {
-				ch <- &Payload{Err: err}
-				close(ch)
-				return
-			}
-		case '*':
-			err = parseArray(line, reader, ch)
-			if err != nil {
-				ch <- &Payload{Err: err}
-				close(ch)
-				return
-			}
-		default:
-			args := bytes.Split(line, []byte{' '})
-			ch <- &Payload{
-				Data: protocol.MakeMultiBulkReply(args),
-			}
-		}
-	}
-}
-
-// parseBulkString 解析字符串
-func parseBulkString(header []byte, reader *bufio.Reader, ch chan<- *Payload) error {
-	strlen, err := strconv.ParseInt(string(header[1:]), 10, 64)
-	if err != nil || strlen < -1 {
-		protocolError(ch, "illegal bulk string header: "+string(header))
-		return nil
-	} else if strlen == -1 {
-		ch <- &Payload{
-			Data: protocol.MakeNullBulkReply(),
-		}
-		return nil
-	}
-	body := make([]byte, strlen+2)
-	_, err = io.ReadFull(reader, body)
-	if err != nil {
-		return err
-	}
-	ch <- &Payload{
-		Data: protocol.MakeBulkReply(body[:len(body)-2]),
-	}
-	return nil
-}
-
-func parseArray(header []byte, reader *bufio.Reader, ch chan<- *Payload) error {
-	nStrs, err := strconv.ParseInt(string(header[1:]), 10, 64)
-	if err != nil || nStrs < 0 {
-		protocolError(ch, "illegal array header: "+string(header[1:]))
-		return nil
-	} else if nStrs == 0 {
-		ch <- &Payload{
-			Data: protocol.MakeEmptyMultiBulkReply(),
-		}
-		return nil
-	}
-	lines := make([][]byte, 0, nStrs)
-	for i := int64(0); i < nStrs; i++ {
-		var line []byte
-		line, err = reader.ReadBytes('\n')
-		if err != nil {
-			return err
-		}
-		length := len(line)
-		if length < 4 || line[length-2] != '\r' || line[0] != '$' {
-			protocolError(ch, "illegal bulk string header: "+string(line))
-			break
-		}
-		strLen, err := strconv.ParseInt(string(line[1:length-2]), 10, 64)
-		if err != nil || strLen < -1 {
-			protocolError(ch, "illegal bulk string header: "+string(line))
-			break
-		} else if strLen == -1 {
-			lines = append(lines, []byte{})
-
-		} else {
-			body := make([]byte, strLen+2)
-			_, err = io.ReadFull(reader, body)
-			if err != nil {
-				return err
-			}
-			lines = append(lines, body[:len(body)-2])
+			close(ch)
+			return
 		}
+		ch <- &Payload{Data: reply}
 	}
-	ch <- &Payload{
-		Data: protocol.MakeMultiBulkReply(lines),
-	}
-	return nil
-}
-func protocolError(ch chan<- *Payload, msg string) {
-	err := errors.New("protocol error" + msg)
-	ch <- &Payload{Err: err}
 }
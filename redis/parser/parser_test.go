@@ -0,0 +1,380 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/atomwqh/MyGodis/interface/redis"
+	"github.com/atomwqh/MyGodis/redis/protocol"
+)
+
+func TestParseStream(t *testing.T) {
+	replies := []redis.Reply{
+		protocol.MakeIntReply(1),
+		protocol.MakeStatusReply("OK"),
+		protocol.MakeErrReply("ERR unknown"),
+		protocol.MakeBulkReply([]byte("a\r\nb")), // test binary safe
+		protocol.MakeNullBulkReply(),
+		protocol.MakeMultiBulkReply([][]byte{
+			[]byte("a"),
+			[]byte("\r\n"),
+		}),
+		protocol.MakeEmptyMultiBulkReply(),
+		protocol.MakeMultiRawReply([]redis.Reply{
+			protocol.MakeIntReply(1),
+			protocol.MakeBulkReply([]byte("a")),
+		}),
+	}
+	reqs := bytes.Buffer{}
+	for _, re := range replies {
+		reqs.Write(re.ToBytes())
+	}
+	reqs.Write([]byte("set a a" + protocol.CRLF)) // test text protocol
+	expected := make([]redis.Reply, len(replies))
+	copy(expected, replies)
+	expected = append(expected, protocol.MakeMultiBulkReply([][]byte{
+		[]byte("set"), []byte("a"), []byte("a"),
+	}))
+
+	ch := ParseStream(bytes.NewReader(reqs.Bytes()))
+	i := 0
+	for payload := range ch {
+		if payload.Err != nil {
+			if payload.Err.Error() == "EOF" {
+				break
+			}
+			t.Error(payload.Err)
+			return
+		}
+		if payload.Data == nil {
+			t.Error("empty data")
+			return
+		}
+		exp := expected[i]
+		i++
+		if !bytes.Equal(exp.ToBytes(), payload.Data.ToBytes()) {
+			t.Error("parse failed: " + string(exp.ToBytes()))
+		}
+	}
+}
+
+func TestParseResp3(t *testing.T) {
+	replies := []redis.Reply{
+		protocol.MakeMapReply(
+			[]redis.Reply{protocol.MakeBulkReply([]byte("proto"))},
+			[]redis.Reply{protocol.MakeIntReply(3)},
+		),
+		protocol.MakeSetReply([]redis.Reply{
+			protocol.MakeBulkReply([]byte("a")),
+			protocol.MakeBulkReply([]byte("b")),
+		}),
+		protocol.MakeDoubleReply(3.14),
+		protocol.MakeDoubleReply(math.Inf(-1)),
+		protocol.MakeBooleanReply(true),
+		protocol.MakeBooleanReply(false),
+		protocol.MakeNullReply(),
+		protocol.MakeBigNumberReply("3492890328409238509324850943850943825024385"),
+		protocol.MakeVerbatimReply("txt", []byte("Some string")),
+		protocol.MakePushReply([]redis.Reply{
+			protocol.MakeBulkReply([]byte("message")),
+			protocol.MakeBulkReply([]byte("channel")),
+			protocol.MakeBulkReply([]byte("payload")),
+		}),
+		protocol.MakeAttributeReply(
+			protocol.MakeMapReply(
+				[]redis.Reply{protocol.MakeBulkReply([]byte("ttl"))},
+				[]redis.Reply{protocol.MakeIntReply(100)},
+			),
+			protocol.MakeMultiRawReply([]redis.Reply{
+				protocol.MakeIntReply(2039123),
+				protocol.MakeSetReply([]redis.Reply{protocol.MakeBooleanReply(true)}),
+			}),
+		),
+	}
+	for _, reply := range replies {
+		result, err := ParseOne(reply.ToBytes())
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if !bytes.Equal(result.ToBytes(), reply.ToBytes()) {
+			t.Errorf("parse failed, expect %q, actual %q", reply.ToBytes(), result.ToBytes())
+		}
+	}
+}
+
+func TestToResp2(t *testing.T) {
+	reply := protocol.MakeMapReply(
+		[]redis.Reply{protocol.MakeBulkReply([]byte("f"))},
+		[]redis.Reply{protocol.MakeDoubleReply(1.5)},
+	)
+	expected := "*2\r\n$1\r\nf\r\n$3\r\n1.5\r\n"
+	if actual := string(protocol.Marshal(reply, protocol.RESP2)); actual != expected {
+		t.Errorf("expect %q, actual %q", expected, actual)
+	}
+	expected = "%1\r\n$1\r\nf\r\n,1.5\r\n"
+	if actual := string(protocol.Marshal(reply, protocol.RESP3)); actual != expected {
+		t.Errorf("expect %q, actual %q", expected, actual)
+	}
+}
+
+func TestReader(t *testing.T) {
+	long := bytes.Repeat([]byte("a"), 3*readBufSize)
+	cmds := [][][]byte{
+		{[]byte("set"), []byte("key"), long},
+		{[]byte("get"), []byte("key")},
+	}
+	buf := bytes.Buffer{}
+	for _, cmd := range cmds {
+		buf.Write(protocol.MakeMultiBulkReply(cmd).ToBytes())
+	}
+	buf.Write([]byte("*1\r\n+" + string(long) + "\r\n")) // status line longer than buffer
+
+	reader := NewReader(&buf)
+	for _, cmd := range cmds {
+		reply, err := reader.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := protocol.MakeMultiBulkReply(cmd).ToBytes()
+		if !bytes.Equal(reply.ToBytes(), expected) {
+			t.Errorf("expect %q, actual %q", expected, reply.ToBytes())
+		}
+	}
+	reply, err := reader.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, ok := reply.(*protocol.MultiRawReply)
+	if !ok || raw.Replies[0].(*protocol.StatusReply).Status != string(long) {
+		t.Error("parse long line failed")
+	}
+	if _, err = reader.Next(); err != io.EOF {
+		t.Errorf("expect EOF, actual %v", err)
+	}
+}
+
+func TestReaderOwnMemory(t *testing.T) {
+	data := protocol.MakeMultiBulkReply([][]byte{[]byte("set"), []byte("k"), []byte("v")}).ToBytes()
+	reader := NewReader(bytes.NewReader(bytes.Repeat(data, 2)))
+	reply, err := reader.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// stored values must not pin memory shared with other arguments
+	args := reply.(*protocol.MultiBulkReply).Args
+	for i, arg := range args {
+		full := arg[:cap(arg)]
+		for j := range full {
+			full[j] = 'x'
+		}
+		for j, other := range args[i+1:] {
+			if bytes.ContainsRune(other, 'x') {
+				t.Fatalf("argument %d shares memory with argument %d", i+1+j, i)
+			}
+		}
+	}
+	// bodies not released are owned by caller and never reused
+	if _, err = reader.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if string(args[0]) != "xxx" {
+		t.Errorf("bodies not released should not be reused, actual %q", args[0])
+	}
+}
+
+func TestReaderRelease(t *testing.T) {
+	data := protocol.MakeMultiBulkReply([][]byte{[]byte("get"), []byte("key")}).ToBytes()
+	reader := NewReader(bytes.NewReader(bytes.Repeat(data, 100)))
+	// warm up pool
+	if _, err := reader.Next(); err != nil {
+		t.Fatal(err)
+	}
+	reader.Release()
+	allocs := testing.AllocsPerRun(90, func() {
+		reply, err := reader.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if args := reply.(*protocol.MultiBulkReply).Args; string(args[1]) != "key" {
+			t.Fatalf("unexpected argument %q", args[1])
+		}
+		reader.Release()
+	})
+	// the reply and its args slice are allocated, bodies come from pool.
+	// sync.Pool drops some items randomly under race detector, so allocating both bodies is the failure
+	if allocs >= 4 {
+		t.Errorf("bodies should be taken from pool, %v allocations per request", allocs)
+	}
+}
+
+func TestBodyClass(t *testing.T) {
+	for n := 1; n <= largeBody; n++ {
+		size, index := bodyClass(n)
+		if size < n || (n > 16 && size > n+n/4) {
+			t.Fatalf("bad size %d for %d", size, n)
+		}
+		if s, i := bodyClass(size); s != size || i != index {
+			t.Fatalf("class of capacity %d should be itself", size)
+		}
+	}
+}
+
+func TestFramer(t *testing.T) {
+	requests := []string{
+		"*3\r\n$3\r\nset\r\n$1\r\nk\r\n$100\r\n" + strings.Repeat("v", 100) + "\r\n",
+		"ping\r\n",
+		"*2\r\n$3\r\nget\r\n$-1\r\n",
+		"*2\r\n$3\r\nget\r\n:1\r\n",
+	}
+	stream := ""
+	var ends []int
+	for _, req := range requests {
+		stream += req
+		ends = append(ends, len(stream))
+	}
+	// feed stream byte by byte, consume complete requests like event loop does
+	framer := NewFramer(DefaultLimits())
+	var data []byte
+	offset := 0
+	var actual []int
+	for i := 0; i < len(stream); i++ {
+		data = append(data, stream[i])
+		end, ok := framer.Scan(data)
+		if !ok {
+			t.Fatal("requests should be framed")
+		}
+		if end > 0 {
+			actual = append(actual, offset+end)
+			offset += end
+			data = data[end:]
+			framer.Discard(end)
+		}
+	}
+	if len(actual) != len(ends) {
+		t.Fatalf("expect ends %v, actual %v", ends, actual)
+	}
+	for i := range ends {
+		if actual[i] != ends[i] {
+			t.Errorf("expect ends %v, actual %v", ends, actual)
+		}
+	}
+
+	// nested aggregates can't be framed
+	framer = NewFramer(DefaultLimits())
+	if _, ok := framer.Scan([]byte("*1\r\n*1\r\n")); ok {
+		t.Error("nested array should not be framed")
+	}
+	// bulk exceeding limit is reported at once so Reader rejects it
+	framer = NewFramer(Limits{MaxBulkLen: 10, MaxMultiBulkLen: 10, MaxInlineSize: 10})
+	if end, _ := framer.Scan([]byte("*1\r\n$11\r\n")); end != 9 {
+		t.Errorf("bulk exceeding limit should end request, actual %d", end)
+	}
+}
+
+func BenchmarkReader(b *testing.B) {
+	cmd := protocol.MakeMultiBulkReply([][]byte{
+		[]byte("set"), []byte("key:000001"), bytes.Repeat([]byte("v"), 64),
+	}).ToBytes()
+	data := bytes.Repeat(cmd, 1000)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		reader := NewReader(bytes.NewReader(data))
+		for {
+			if _, err := reader.Next(); err != nil {
+				break
+			}
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	limits := Limits{MaxBulkLen: 16, MaxMultiBulkLen: 4, MaxInlineSize: 32}
+	fatals := []string{
+		"$9999999999\r\n",
+		"*3\r\n$3\r\nset\r\n$1\r\na\r\n$17\r\n",
+		"*5\r\n",
+		"%5\r\n",
+		"set " + strings.Repeat("a", readBufSize+1) + "\r\n",
+		"get " + strings.Repeat("a", 40) + "\r\n",
+		"$3\r\nabcde\r\n",
+		"*2\r\n:a\r\n:1\r\n",
+	}
+	for _, req := range fatals {
+		reader := NewReaderWithLimits(strings.NewReader(req), limits)
+		_, err := reader.Next()
+		var protoErr *ProtocolError
+		if !errors.As(err, &protoErr) || !protoErr.Fatal {
+			t.Errorf("expect fatal protocol error for %.40q, actual %v", req, err)
+		}
+	}
+
+	reader := NewReaderWithLimits(strings.NewReader(":a\r\n:1\r\n"), limits)
+	if _, err := reader.Next(); !IsRecoverable(err) {
+		t.Errorf("expect recoverable error, actual %v", err)
+	}
+	reply, err := reader.Next()
+	if err != nil || string(reply.ToBytes()) != ":1\r\n" {
+		t.Errorf("reader should go on after recoverable error, actual %v", err)
+	}
+}
+
+func TestInline(t *testing.T) {
+	cases := map[string][]string{
+		"set a a":                          {"set", "a", "a"},
+		"  set   a \t  b  ":                {"set", "a", "b"},
+		`set "hello world" 'a b'`:          {"set", "hello world", "a b"},
+		`set k "\x41\x4a\n\"\\"`:           {"set", "k", "AJ\n\"\\"},
+		`set k 'it\'s' ""`:                 {"set", "k", "it's", ""},
+		`set k\x41 "\xZZ"`:                 {"set", `k\x41`, "xZZ"},
+		`set foo"bar baz" x`:               {"set", "foobar baz", "x"},
+		"set \"\xe4\xb8\xad\xe6\x96\x87\"": {"set", "中文"},
+	}
+	for line, expected := range cases {
+		reply, err := ParseOne([]byte(line + "\r\n"))
+		if err != nil {
+			t.Errorf("parse %q failed: %v", line, err)
+			continue
+		}
+		args := reply.(*protocol.MultiBulkReply).Args
+		if len(args) != len(expected) {
+			t.Errorf("parse %q: expect %q, actual %q", line, expected, args)
+			continue
+		}
+		for i, arg := range args {
+			if string(arg) != expected[i] {
+				t.Errorf("parse %q: expect %q, actual %q", line, expected, args)
+				break
+			}
+		}
+	}
+
+	unbalanced := []string{`set "a`, `set 'a`, `set "a"b`, `set 'a'b`}
+	for _, line := range unbalanced {
+		reader := NewReader(strings.NewReader(line + "\r\nping\r\n"))
+		_, err := reader.Next()
+		if !IsRecoverable(err) || err.Error() != "Protocol error: unbalanced quotes in request" {
+			t.Errorf("parse %q: expect unbalanced quotes error, actual %v", line, err)
+			continue
+		}
+		reply, err := reader.Next()
+		if err != nil || string(reply.(*protocol.MultiBulkReply).Args[0]) != "ping" {
+			t.Errorf("reader should go on after %q", line)
+		}
+	}
+}
+
+func TestInlineLF(t *testing.T) {
+	replies, err := ParseBytes([]byte("\nset a \"b c\"\nget a\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replies) != 2 || string(replies[1].(*protocol.MultiBulkReply).Args[0]) != "get" {
+		t.Errorf("parse LF terminated lines failed: %v", replies)
+	}
+}
@@ -0,0 +1,59 @@
+package parser
+
+import (
+	"math/bits"
+	"sync"
+)
+
+// 不超过 largeBody 的 bulk body 从按大小分级的 sync.Pool 中分配, 每级之间相差不超过 25%, 所以保存下来的参数最多浪费 1/4 的内存.
+// Next 返回的 body 各自独立, 不与其他参数共享内存, 默认归调用者所有, Reader 不再引用它们.
+// 调用者确定上一个 reply 的参数不再被引用时可以调用 Reader.Release 归还这些 body, 之后的请求会复用它们的内存.
+// 没有归还的 body 由 GC 回收, 所以不调用 Release 也是安全的
+
+// bodyPools has 4 classes for each power of 2 up to largeBody, pools store *[]byte to avoid allocation in Put
+var bodyPools [(bits.UintSize - 3) * 4]sync.Pool
+
+// bodyClass returns the capacity allocated for n bytes and the index of its pool
+func bodyClass(n int) (size int, index int) {
+	if n < 16 {
+		n = 16
+	}
+	shift := bits.Len(uint(n-1)) - 3
+	q := (n-1)>>shift + 1 // 5 to 8
+	return q << shift, shift*4 + q - 5
+}
+
+// getBody returns a pooled slice of n bytes, 0 < n <= largeBody
+func getBody(n int) *[]byte {
+	size, index := bodyClass(n)
+	if p, ok := bodyPools[index].Get().(*[]byte); ok {
+		*p = (*p)[:n]
+		return p
+	}
+	body := make([]byte, n, size)
+	return &body
+}
+
+// putBody returns body allocated by getBody to pool
+func putBody(p *[]byte) {
+	_, index := bodyClass(cap(*p))
+	bodyPools[index].Put(p)
+}
+
+// Release returns bulk bodies of the reply returned by the last Next to pool.
+// The caller must not access arguments of that reply after Release, e.g. they must not be stored by db.
+func (r *Reader) Release() {
+	for i, p := range r.pooled {
+		putBody(p)
+		r.pooled[i] = nil
+	}
+	r.pooled = r.pooled[:0]
+}
+
+// forget hands bodies of the last reply to the caller, they are freed by GC
+func (r *Reader) forget() {
+	for i := range r.pooled {
+		r.pooled[i] = nil
+	}
+	r.pooled = r.pooled[:0]
+}
@@ -0,0 +1,445 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+
+	"github.com/atomwqh/MyGodis/interface/redis"
+	"github.com/atomwqh/MyGodis/redis/protocol"
+)
+
+// Reader 是同步的拉取式解析器，每调用一次 Next 返回一个完整的 reply
+// 不需要额外的 goroutine 和 channel，适合在连接的处理循环里直接使用
+// 每个 bulk string 都有独立的内存, 小的 body 来自内存池 (见 pool.go). 除非调用者用 Release 归还,
+// Reader 不会复用已返回的 reply 的内存, 存储引擎可以直接保存参数而无需复制.
+// inline 命令的参数共享一块与命令行等长的内存
+
+const (
+	readBufSize = 16 * 1024
+	// bodies larger than largeBody grow as data arrives instead of being allocated by the declared length
+	largeBody = 64 * 1024
+	// maxPrealloc limits the capacity preallocated by the declared length of aggregate types
+	maxPrealloc = 1024
+)
+
+// Limits protects server from malicious or broken clients, a request exceeding them causes a fatal ProtocolError
+type Limits struct {
+	// MaxBulkLen is the max length of a bulk string, aka proto-max-bulk-len
+	MaxBulkLen int64
+	// MaxMultiBulkLen is the max number of elements of an aggregate type
+	MaxMultiBulkLen int64
+	// MaxInlineSize is the max length of an inline command or a header line
+	MaxInlineSize int
+}
+
+// DefaultLimits returns the same limits as redis
+func DefaultLimits() Limits {
+	return Limits{
+		MaxBulkLen:      512 * 1024 * 1024,
+		MaxMultiBulkLen: 1024 * 1024,
+		MaxInlineSize:   64 * 1024,
+	}
+}
+
+// Reader reads RESP replies from io.Reader one by one, it is not thread safe
+type Reader struct {
+	reader *bufio.Reader
+	limits Limits
+	// line buffer reused for lines longer than bufio buffer
+	line []byte
+	// pooled are bodies of the last reply taken from pool, see Release
+	pooled []*[]byte
+}
+
+// NewReader creates a Reader on rd with DefaultLimits
+func NewReader(rd io.Reader) *Reader {
+	return NewReaderWithLimits(rd, DefaultLimits())
+}
+
+// NewReaderWithLimits creates a Reader on rd with the given limits
+func NewReaderWithLimits(rd io.Reader, limits Limits) *Reader {
+	return &Reader{
+		reader: bufio.NewReaderSize(rd, readBufSize),
+		limits: limits,
+	}
+}
+
+// Reset discards buffered data and switches to rd, it is used to parse data pushed by an event loop
+func (r *Reader) Reset(rd io.Reader) {
+	r.reader.Reset(rd)
+}
+
+// Buffered returns the number of bytes read from the underlying reader but not parsed yet
+func (r *Reader) Buffered() int {
+	return r.reader.Buffered()
+}
+
+// Next reads the next reply, it returns io.EOF when the stream is finished.
+// The caller may call Next again after an error if IsRecoverable(err), other errors are fatal.
+func (r *Reader) Next() (redis.Reply, error) {
+	r.forget()
+	for {
+		line, err := r.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 {
+			// there will be some empty lines within replication traffic, ignore it
+			continue
+		}
+		// RESP 协议使用第一个字符来表示格式
+		/*
+			+ 简单字符串
+			- 错误
+			: 整数
+			$ 字符串
+			* 数组
+			RESP3:
+			% map, ~ set, > push, | attribute
+			, double, # boolean, _ null, ( big number, = verbatim string
+		*/
+		switch line[0] {
+		case '+', '-', ':', '$', '*', '%', '~', '>', '|', ',', '#', '_', '(', '=':
+			reply, err := r.parseReply(line)
+			if err == io.EOF {
+				// stream ends after the header, the reply is truncated
+				err = io.ErrUnexpectedEOF
+			}
+			return reply, err
+		default:
+			// inline command, line is overwritten by next read so args are copied into a new buffer
+			args, err := splitArgs(line, make([]byte, len(line)))
+			if err != nil {
+				return nil, err
+			}
+			if len(args) == 0 {
+				continue
+			}
+			return protocol.MakeMultiBulkReply(args), nil
+		}
+	}
+}
+
+// readLine returns a line without CRLF, the result is only valid until next read.
+func (r *Reader) readLine() ([]byte, error) {
+	line, err := r.reader.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		// line is longer than buffer, collect it into r.line
+		r.line = append(r.line[:0], line...)
+		for err == bufio.ErrBufferFull {
+			if len(r.line) > r.limits.MaxInlineSize {
+				return nil, fatalErr("too big inline request")
+			}
+			line, err = r.reader.ReadSlice('\n')
+			r.line = append(r.line, line...)
+		}
+		line = r.line
+	}
+	if err != nil {
+		return nil, err
+	}
+	length := len(line)
+	if length > r.limits.MaxInlineSize {
+		return nil, fatalErr("too big inline request")
+	}
+	// nc and telnet may send inline commands ending with LF only
+	line = line[:length-1]
+	if length >= 2 && line[length-2] == '\r' {
+		line = line[:length-2]
+	}
+	return line, nil
+}
+
+// readReply reads a complete reply, used by elements of aggregate types
+func (r *Reader) readReply() (redis.Reply, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, fatalErr("unexpected empty line")
+	}
+	reply, err := r.parseReply(line)
+	if err != nil {
+		return nil, toFatal(err)
+	}
+	return reply, nil
+}
+
+// parseReply parses reply by the header line whose CRLF has been trimmed
+func (r *Reader) parseReply(header []byte) (redis.Reply, error) {
+	content := header[1:]
+	switch header[0] {
+	case '+':
+		return protocol.MakeStatusReply(string(content)), nil
+	case '-':
+		return protocol.MakeErrReply(string(content)), nil
+	case ':':
+		value, ok := parseInt(content)
+		if !ok {
+			return nil, recoverableErr("invalid number " + string(content))
+		}
+		return protocol.MakeIntReply(value), nil
+	case '$':
+		return r.parseBulkString(header)
+	case '*':
+		return r.parseArray(header)
+	case '%':
+		n, err := r.parseLength(header)
+		if err != nil {
+			return nil, err
+		}
+		keys := make([]redis.Reply, 0, prealloc(n))
+		values := make([]redis.Reply, 0, prealloc(n))
+		for i := int64(0); i < n; i++ {
+			key, err := r.readReply()
+			if err != nil {
+				return nil, err
+			}
+			value, err := r.readReply()
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+			values = append(values, value)
+		}
+		return protocol.MakeMapReply(keys, values), nil
+	case '~', '>':
+		kind := header[0]
+		n, err := r.parseLength(header)
+		if err != nil {
+			return nil, err
+		}
+		replies, err := r.readReplies(n)
+		if err != nil {
+			return nil, err
+		}
+		if kind == '~' {
+			return protocol.MakeSetReply(replies), nil
+		}
+		return protocol.MakePushReply(replies), nil
+	case '|':
+		// attribute is a map followed by the reply it describes
+		mapHeader := append([]byte{'%'}, content...)
+		attrs, err := r.parseReply(mapHeader)
+		if err != nil {
+			return nil, err
+		}
+		reply, err := r.readReply()
+		if err != nil {
+			return nil, err
+		}
+		return protocol.MakeAttributeReply(attrs.(*protocol.MapReply), reply), nil
+	case ',':
+		value, err := parseDouble(string(content))
+		if err != nil {
+			return nil, recoverableErr("invalid double " + string(content))
+		}
+		return protocol.MakeDoubleReply(value), nil
+	case '#':
+		switch string(content) {
+		case "t":
+			return protocol.MakeBooleanReply(true), nil
+		case "f":
+			return protocol.MakeBooleanReply(false), nil
+		}
+		return nil, recoverableErr("invalid boolean " + string(content))
+	case '_':
+		return protocol.MakeNullReply(), nil
+	case '(':
+		if _, ok := new(big.Int).SetString(string(content), 10); !ok {
+			return nil, recoverableErr("invalid big number " + string(content))
+		}
+		return protocol.MakeBigNumberReply(string(content)), nil
+	case '=':
+		n, err := r.parseLength(header)
+		if err != nil {
+			return nil, err
+		}
+		if n > r.limits.MaxBulkLen {
+			return nil, fatalErr("invalid bulk length")
+		}
+		body, err := r.readBody(n)
+		if err != nil {
+			return nil, err
+		}
+		if len(body) < 4 || body[3] != ':' {
+			return nil, recoverableErr("invalid verbatim string")
+		}
+		return protocol.MakeVerbatimReply(string(body[:3]), body[4:]), nil
+	}
+	return nil, fatalErr("unknown type '" + string(header[0]) + "'")
+}
+
+func (r *Reader) readReplies(n int64) ([]redis.Reply, error) {
+	replies := make([]redis.Reply, 0, prealloc(n))
+	for i := int64(0); i < n; i++ {
+		reply, err := r.readReply()
+		if err != nil {
+			return nil, err
+		}
+		replies = append(replies, reply)
+	}
+	return replies, nil
+}
+
+// readBody reads a string of n bytes followed by CRLF directly into a slice of its own, small ones are taken from pool
+func (r *Reader) readBody(n int64) ([]byte, error) {
+	var body []byte
+	if n == 0 {
+		body = []byte{}
+	} else if n <= largeBody {
+		p := getBody(int(n))
+		r.pooled = append(r.pooled, p)
+		body = *p
+		if _, err := io.ReadFull(r.reader, body); err != nil {
+			return nil, err
+		}
+	} else {
+		// don't trust the declared length, memory grows only as data actually arrives
+		buf := bytes.NewBuffer(make([]byte, 0, largeBody))
+		if _, err := io.CopyN(buf, r.reader, n); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		body = buf.Bytes()
+	}
+	crlf, err := r.reader.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+	if crlf[0] != '\r' || crlf[1] != '\n' {
+		return nil, fatalErr("expected CRLF after bulk string")
+	}
+	_, _ = r.reader.Discard(2)
+	return body, nil
+}
+
+// parseBulkString 解析字符串
+func (r *Reader) parseBulkString(header []byte) (redis.Reply, error) {
+	strlen, ok := parseInt(header[1:])
+	if !ok || strlen < -1 || strlen > r.limits.MaxBulkLen {
+		return nil, fatalErr("invalid bulk length")
+	} else if strlen == -1 {
+		return protocol.MakeNullBulkReply(), nil
+	}
+	body, err := r.readBody(strlen)
+	if err != nil {
+		return nil, err
+	}
+	return protocol.MakeBulkReply(body), nil
+}
+
+// parseArray returns MultiBulkReply if all elements are bulk strings (e.g. commands), otherwise MultiRawReply
+func (r *Reader) parseArray(header []byte) (redis.Reply, error) {
+	nStrs, ok := parseInt(header[1:])
+	if !ok || nStrs < -1 || nStrs > r.limits.MaxMultiBulkLen {
+		return nil, fatalErr("invalid multibulk length")
+	} else if nStrs == -1 {
+		return protocol.MakeNullBulkReply(), nil
+	} else if nStrs == 0 {
+		return protocol.MakeEmptyMultiBulkReply(), nil
+	}
+	lines := make([][]byte, 0, prealloc(nStrs))
+	var replies []redis.Reply // only used when there is a non bulk element
+	for i := int64(0); i < nStrs; i++ {
+		line, err := r.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 {
+			return nil, fatalErr("unexpected empty line")
+		}
+		if replies == nil && line[0] == '$' {
+			// fast path for commands, read body without wrapping it in BulkReply
+			strLen, ok := parseInt(line[1:])
+			if !ok || strLen < -1 || strLen > r.limits.MaxBulkLen {
+				return nil, fatalErr("invalid bulk length")
+			} else if strLen == -1 {
+				lines = append(lines, []byte{})
+				continue
+			}
+			body, err := r.readBody(strLen)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, body)
+			continue
+		}
+		reply, err := r.parseReply(line)
+		if err != nil {
+			return nil, toFatal(err)
+		}
+		if replies == nil {
+			replies = make([]redis.Reply, 0, prealloc(nStrs))
+			for _, line := range lines {
+				replies = append(replies, protocol.MakeBulkReply(line))
+			}
+		}
+		replies = append(replies, reply)
+	}
+	if replies != nil {
+		return protocol.MakeMultiRawReply(replies), nil
+	}
+	return protocol.MakeMultiBulkReply(lines), nil
+}
+
+// parseLength parses the length of map, set, push or verbatim string
+func (r *Reader) parseLength(header []byte) (int64, error) {
+	n, ok := parseInt(header[1:])
+	if !ok || n < 0 || (header[0] != '=' && n > r.limits.MaxMultiBulkLen) {
+		return 0, fatalErr("invalid length of '" + string(header[0]) + "'")
+	}
+	return n, nil
+}
+
+func prealloc(n int64) int64 {
+	if n > maxPrealloc {
+		return maxPrealloc
+	}
+	return n
+}
+
+// parseInt parses decimal integer without converting b to string
+func parseInt(b []byte) (int64, bool) {
+	if len(b) == 0 || len(b) > 18 {
+		// longer numbers may overflow, they are rare enough to use strconv
+		n, err := strconv.ParseInt(string(b), 10, 64)
+		return n, err == nil
+	}
+	neg := false
+	if b[0] == '-' {
+		neg = true
+		b = b[1:]
+		if len(b) == 0 {
+			return 0, false
+		}
+	}
+	var n int64
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + int64(c-'0')
+	}
+	if neg {
+		n = -n
+	}
+	return n, true
+}
+
+func parseDouble(s string) (float64, error) {
+	switch s {
+	case "inf":
+		return math.Inf(1), nil
+	case "-inf":
+		return math.Inf(-1), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
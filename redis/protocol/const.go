@@ -24,3 +24,31 @@ func MakeEmptyMultiBulkReply() *EmptyMultiBulkReply {
 func (r *EmptyMultiBulkReply) ToBytes() []byte {
 	return emptyMultiBulkBytes
 }
+
+var okBytes = []byte("+OK\r\n")
+
+// OkReply is +OK
+type OkReply struct{}
+
+var theOkReply = new(OkReply)
+
+func MakeOkReply() *OkReply {
+	return theOkReply
+}
+
+func (r *OkReply) ToBytes() []byte {
+	return okBytes
+}
+
+// NoReply is returned by commands which have sent replies themselves, such as SUBSCRIBE
+type NoReply struct{}
+
+var theNoReply = new(NoReply)
+
+func MakeNoReply() *NoReply {
+	return theNoReply
+}
+
+func (r *NoReply) ToBytes() []byte {
+	return nil
+}
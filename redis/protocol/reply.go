@@ -25,7 +25,7 @@ func (r *BulkReply) ToBytes() []byte {
 	if r.Arg == nil {
 		return nullBulkBytes
 	}
-	return []byte("&" + strconv.Itoa(len(r.Arg)) + CRLF + string(r.Arg) + CRLF)
+	return []byte("$" + strconv.Itoa(len(r.Arg)) + CRLF + string(r.Arg) + CRLF)
 }
 
 /* ---- Multi Bulk Reply ---- */
@@ -87,6 +87,23 @@ func MakeMultiRawReply(replies []redis.Reply) *MultiRawReply {
 	}
 }
 
+// ToBytes marshal redis.Reply
+func (r *MultiRawReply) ToBytes() []byte {
+	return marshalAggregate('*', r.Replies)
+}
+
+// marshalAggregate writes header with the number of elements then each element
+func marshalAggregate(prefix byte, replies []redis.Reply) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(prefix)
+	buf.WriteString(strconv.Itoa(len(replies)))
+	buf.WriteString(CRLF)
+	for _, reply := range replies {
+		buf.Write(reply.ToBytes())
+	}
+	return buf.Bytes()
+}
+
 /* ---- Status Reply ---- */
 
 // StatusReply stores a simple status string
@@ -120,6 +137,10 @@ func MakeErrReply(status string) *StandardErrReply {
 	return &StandardErrReply{Status: status}
 }
 
+func (r *StandardErrReply) Error() string {
+	return r.Status
+}
+
 // ToBytes marshal redis.Reply
 func (r *StandardErrReply) ToBytes() []byte {
 	return []byte("-" + r.Status + CRLF)
@@ -0,0 +1,267 @@
+package protocol
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+
+	"github.com/atomwqh/MyGodis/interface/redis"
+)
+
+// RESP3 新增的数据类型，只有通过 HELLO 3 协商后才会原样发送给客户端
+// RESP2 的连接会在写出之前通过 ToResp2 降级成等价的 RESP2 类型
+
+const (
+	// RESP2 is the default protocol version of a new connection
+	RESP2 = 2
+	// RESP3 is enabled by HELLO 3
+	RESP3 = 3
+)
+
+// resp2Convertible is implemented by replies which only exist in RESP3
+type resp2Convertible interface {
+	toResp2() redis.Reply
+}
+
+/* ---- Map Reply ---- */
+
+// MapReply is an ordered map, Keys[i] is mapped to Values[i]
+type MapReply struct {
+	Keys   []redis.Reply
+	Values []redis.Reply
+}
+
+func MakeMapReply(keys []redis.Reply, values []redis.Reply) *MapReply {
+	return &MapReply{Keys: keys, Values: values}
+}
+
+// ToBytes marshal redis.Reply
+func (r *MapReply) ToBytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%")
+	buf.WriteString(strconv.Itoa(len(r.Keys)))
+	buf.WriteString(CRLF)
+	for i, key := range r.Keys {
+		buf.Write(key.ToBytes())
+		buf.Write(r.Values[i].ToBytes())
+	}
+	return buf.Bytes()
+}
+
+// toResp2 flattens map into key value key value ...
+func (r *MapReply) toResp2() redis.Reply {
+	replies := make([]redis.Reply, 0, 2*len(r.Keys))
+	for i, key := range r.Keys {
+		replies = append(replies, key, r.Values[i])
+	}
+	return MakeMultiRawReply(replies)
+}
+
+/* ---- Set Reply ---- */
+
+// SetReply is an unordered collection of distinct elements
+type SetReply struct {
+	Members []redis.Reply
+}
+
+func MakeSetReply(members []redis.Reply) *SetReply {
+	return &SetReply{Members: members}
+}
+
+// ToBytes marshal redis.Reply
+func (r *SetReply) ToBytes() []byte {
+	return marshalAggregate('~', r.Members)
+}
+
+func (r *SetReply) toResp2() redis.Reply {
+	return MakeMultiRawReply(r.Members)
+}
+
+/* ---- Push Reply ---- */
+
+// PushReply is an out of band message, such as pub/sub messages
+type PushReply struct {
+	Replies []redis.Reply
+}
+
+func MakePushReply(replies []redis.Reply) *PushReply {
+	return &PushReply{Replies: replies}
+}
+
+// ToBytes marshal redis.Reply
+func (r *PushReply) ToBytes() []byte {
+	return marshalAggregate('>', r.Replies)
+}
+
+func (r *PushReply) toResp2() redis.Reply {
+	return MakeMultiRawReply(r.Replies)
+}
+
+/* ---- Attribute Reply ---- */
+
+// AttributeReply carries auxiliary data of Reply, it is sent right before Reply
+type AttributeReply struct {
+	Attributes *MapReply
+	Reply      redis.Reply
+}
+
+func MakeAttributeReply(attributes *MapReply, reply redis.Reply) *AttributeReply {
+	return &AttributeReply{Attributes: attributes, Reply: reply}
+}
+
+// ToBytes marshal redis.Reply
+func (r *AttributeReply) ToBytes() []byte {
+	attrs := r.Attributes.ToBytes()
+	attrs[0] = '|'
+	return append(attrs, r.Reply.ToBytes()...)
+}
+
+// toResp2 drops attributes, RESP2 cannot express them
+func (r *AttributeReply) toResp2() redis.Reply {
+	return r.Reply
+}
+
+/* ---- Double Reply ---- */
+
+type DoubleReply struct {
+	Value float64
+}
+
+func MakeDoubleReply(value float64) *DoubleReply {
+	return &DoubleReply{Value: value}
+}
+
+func (r *DoubleReply) String() string {
+	switch {
+	case math.IsInf(r.Value, 1):
+		return "inf"
+	case math.IsInf(r.Value, -1):
+		return "-inf"
+	case math.IsNaN(r.Value):
+		return "nan"
+	}
+	return strconv.FormatFloat(r.Value, 'g', -1, 64)
+}
+
+// ToBytes marshal redis.Reply
+func (r *DoubleReply) ToBytes() []byte {
+	return []byte("," + r.String() + CRLF)
+}
+
+func (r *DoubleReply) toResp2() redis.Reply {
+	return MakeBulkReply([]byte(r.String()))
+}
+
+/* ---- Boolean Reply ---- */
+
+type BooleanReply struct {
+	Value bool
+}
+
+func MakeBooleanReply(value bool) *BooleanReply {
+	return &BooleanReply{Value: value}
+}
+
+// ToBytes marshal redis.Reply
+func (r *BooleanReply) ToBytes() []byte {
+	if r.Value {
+		return []byte("#t" + CRLF)
+	}
+	return []byte("#f" + CRLF)
+}
+
+func (r *BooleanReply) toResp2() redis.Reply {
+	if r.Value {
+		return MakeIntReply(1)
+	}
+	return MakeIntReply(0)
+}
+
+/* ---- Big Number Reply ---- */
+
+// BigNumberReply stores an integer out of the range of int64 as decimal string
+type BigNumberReply struct {
+	Value string
+}
+
+func MakeBigNumberReply(value string) *BigNumberReply {
+	return &BigNumberReply{Value: value}
+}
+
+// ToBytes marshal redis.Reply
+func (r *BigNumberReply) ToBytes() []byte {
+	return []byte("(" + r.Value + CRLF)
+}
+
+func (r *BigNumberReply) toResp2() redis.Reply {
+	return MakeBulkReply([]byte(r.Value))
+}
+
+/* ---- Verbatim Reply ---- */
+
+// VerbatimReply is a string with format hint, e.g. txt or mkd
+type VerbatimReply struct {
+	Format string
+	Text   []byte
+}
+
+func MakeVerbatimReply(format string, text []byte) *VerbatimReply {
+	return &VerbatimReply{Format: format, Text: text}
+}
+
+// ToBytes marshal redis.Reply
+func (r *VerbatimReply) ToBytes() []byte {
+	return []byte("=" + strconv.Itoa(len(r.Format)+1+len(r.Text)) + CRLF + r.Format + ":" + string(r.Text) + CRLF)
+}
+
+func (r *VerbatimReply) toResp2() redis.Reply {
+	return MakeBulkReply(r.Text)
+}
+
+/* ---- Null Reply ---- */
+
+var nullBytes = []byte("_" + CRLF)
+
+// NullReply is the RESP3 null, it replaces both null bulk and null array
+type NullReply struct{}
+
+func MakeNullReply() *NullReply {
+	return &NullReply{}
+}
+
+// ToBytes marshal redis.Reply
+func (r *NullReply) ToBytes() []byte {
+	return nullBytes
+}
+
+func (r *NullReply) toResp2() redis.Reply {
+	return MakeNullBulkReply()
+}
+
+// ToResp2 converts RESP3 only replies to their RESP2 equivalent recursively
+func ToResp2(reply redis.Reply) redis.Reply {
+	// attribute wraps another reply which may need to be converted too
+	for {
+		r, ok := reply.(resp2Convertible)
+		if !ok {
+			break
+		}
+		reply = r.toResp2()
+	}
+	if r, ok := reply.(*MultiRawReply); ok {
+		replies := make([]redis.Reply, len(r.Replies))
+		for i, child := range r.Replies {
+			replies[i] = ToResp2(child)
+		}
+		return MakeMultiRawReply(replies)
+	}
+	return reply
+}
+
+// Marshal serializes reply in the given protocol version
+func Marshal(reply redis.Reply, version int) []byte {
+	if version < RESP3 {
+		reply = ToResp2(reply)
+	}
+	return reply.ToBytes()
+}
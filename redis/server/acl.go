@@ -0,0 +1,266 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atomwqh/MyGodis/config"
+	"github.com/atomwqh/MyGodis/interface/redis"
+	"github.com/atomwqh/MyGodis/redis/acl"
+	"github.com/atomwqh/MyGodis/redis/connection"
+	"github.com/atomwqh/MyGodis/redis/protocol"
+)
+
+var (
+	noAuthReply    = protocol.MakeErrReply("NOAUTH Authentication required.")
+	wrongPassReply = protocol.MakeErrReply("WRONGPASS invalid username-password pair or user is disabled.")
+)
+
+func init() {
+	registerCommand("auth", execAuth)
+	registerCommand("acl", execACL)
+}
+
+// clientInfo describes client in ACL LOG
+func clientInfo(c redis.Connection) string {
+	return "addr=" + c.RemoteAddr() + " user=" + c.GetUser()
+}
+
+// checkPermission returns error reply if the user of client can't run cmdLine
+func checkPermission(c redis.Connection, cmdName string, cmdLine [][]byte) redis.Reply {
+	if cmdName == "auth" || cmdName == "hello" {
+		// they authenticate connection themselves
+		return nil
+	}
+	user := acl.GetUser(c.GetUser())
+	if user == nil {
+		return noAuthReply
+	}
+	denied := user.Check(cmdLine)
+	if denied == nil {
+		return nil
+	}
+	acl.AddLog(denied.Reason, denied.Object, user.Name, clientInfo(c))
+	switch denied.Reason {
+	case "key":
+		return protocol.MakeErrReply("NOPERM this user has no permissions to access one of the keys used as arguments")
+	case "channel":
+		return protocol.MakeErrReply("NOPERM this user has no permissions to access one of the channels used as arguments")
+	}
+	return protocol.MakeErrReply("NOPERM this user has no permissions to run the '" + denied.Object + "' command")
+}
+
+// authenticate logs in client as username, failure is recorded in ACL LOG
+func authenticate(c redis.Connection, username string, password string) redis.Reply {
+	if !acl.Authenticate(username, password) {
+		acl.AddLog("auth", "AUTH", username, clientInfo(c))
+		return wrongPassReply
+	}
+	c.SetUser(username)
+	return nil
+}
+
+// execAuth handles AUTH [username] password
+func execAuth(h *Handler, c redis.Connection, args [][]byte) redis.Reply {
+	if len(args) < 1 || len(args) > 2 {
+		return protocol.MakeErrReply("ERR wrong number of arguments for 'auth' command")
+	}
+	username, password := acl.DefaultUser, string(args[0])
+	if len(args) == 2 {
+		username, password = string(args[0]), string(args[1])
+	} else if u := acl.GetUser(acl.DefaultUser); u != nil && u.NoPass {
+		return protocol.MakeErrReply("ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+	}
+	if errReply := authenticate(c, username, password); errReply != nil {
+		return errReply
+	}
+	return protocol.MakeOkReply()
+}
+
+// killUserClients closes clients authenticated as users which don't exist anymore
+func (h *Handler) killUserClients() {
+	h.activeConn.Range(func(key interface{}, val interface{}) bool {
+		client := key.(*connection.Connection)
+		if name := client.GetUser(); name != "" && acl.GetUser(name) == nil {
+			_ = client.Close()
+		}
+		return true
+	})
+}
+
+func toStrings(args [][]byte) []string {
+	result := make([]string, len(args))
+	for i, arg := range args {
+		result[i] = string(arg)
+	}
+	return result
+}
+
+func bulkStrings(strs []string) redis.Reply {
+	replies := make([]redis.Reply, len(strs))
+	for i, s := range strs {
+		replies[i] = protocol.MakeBulkReply([]byte(s))
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+func makeMap(pairs ...interface{}) redis.Reply {
+	keys := make([]redis.Reply, 0, len(pairs)/2)
+	values := make([]redis.Reply, 0, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		keys = append(keys, protocol.MakeBulkReply([]byte(pairs[i].(string))))
+		switch v := pairs[i+1].(type) {
+		case string:
+			values = append(values, protocol.MakeBulkReply([]byte(v)))
+		case int64:
+			values = append(values, protocol.MakeIntReply(v))
+		case []string:
+			values = append(values, bulkStrings(v))
+		case redis.Reply:
+			values = append(values, v)
+		}
+	}
+	return protocol.MakeMapReply(keys, values)
+}
+
+func aclFileNotConfigured() redis.Reply {
+	return protocol.MakeErrReply("ERR This Redis instance is not configured to use an ACL file. " +
+		"You may want to specify users via the ACL SETUSER command and then issue a CONFIG REWRITE " +
+		"(assuming you have a Redis configuration file set) in order to store users in the Redis configuration.")
+}
+
+// execACL handles ACL subcommands
+func execACL(h *Handler, c redis.Connection, args [][]byte) redis.Reply {
+	if len(args) == 0 {
+		return protocol.MakeErrReply("ERR wrong number of arguments for 'acl' command")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	args = args[1:]
+	wrongArgs := protocol.MakeErrReply("ERR wrong number of arguments for 'acl|" + subCmd + "' command")
+	switch subCmd {
+	case "setuser":
+		if len(args) < 1 {
+			return wrongArgs
+		}
+		if err := acl.SetUser(string(args[0]), toStrings(args[1:])); err != nil {
+			return protocol.MakeErrReply("ERR " + err.Error())
+		}
+		return protocol.MakeOkReply()
+	case "getuser":
+		if len(args) != 1 {
+			return wrongArgs
+		}
+		u := acl.GetUser(string(args[0]))
+		if u == nil {
+			return protocol.MakeNullReply()
+		}
+		return makeMap(
+			"flags", u.Flags(),
+			"passwords", u.Passwords(),
+			"commands", u.CommandsRule(),
+			"keys", u.KeysRule(),
+			"channels", u.ChannelsRule(),
+			"selectors", protocol.MakeEmptyMultiBulkReply(),
+		)
+	case "deluser":
+		if len(args) < 1 {
+			return wrongArgs
+		}
+		n, err := acl.DelUsers(toStrings(args))
+		if err != nil {
+			return protocol.MakeErrReply("ERR " + err.Error())
+		}
+		h.killUserClients()
+		return protocol.MakeIntReply(int64(n))
+	case "list", "users":
+		if len(args) != 0 {
+			return wrongArgs
+		}
+		var lines []string
+		for _, u := range acl.Users() {
+			if subCmd == "list" {
+				lines = append(lines, u.Describe())
+			} else {
+				lines = append(lines, u.Name)
+			}
+		}
+		return bulkStrings(lines)
+	case "whoami":
+		if len(args) != 0 {
+			return wrongArgs
+		}
+		return protocol.MakeBulkReply([]byte(c.GetUser()))
+	case "cat":
+		if len(args) > 1 {
+			return wrongArgs
+		}
+		if len(args) == 0 {
+			return bulkStrings(acl.Categories())
+		}
+		commands, ok := acl.CategoryCommands(string(args[0]))
+		if !ok {
+			return protocol.MakeErrReply("ERR Unknown category '" + string(args[0]) + "'")
+		}
+		return bulkStrings(commands)
+	case "log":
+		return aclLog(args)
+	case "load", "save":
+		if len(args) != 0 {
+			return wrongArgs
+		}
+		filename := config.Get().ACLFile
+		if filename == "" {
+			return aclFileNotConfigured()
+		}
+		if subCmd == "save" {
+			if err := acl.SaveFile(filename); err != nil {
+				return protocol.MakeErrReply("ERR There was an error trying to save the ACLs. Please check the server logs for more information")
+			}
+			return protocol.MakeOkReply()
+		}
+		if err := acl.LoadFile(filename); err != nil {
+			return protocol.MakeErrReply("ERR " + err.Error())
+		}
+		h.killUserClients()
+		return protocol.MakeOkReply()
+	}
+	return protocol.MakeErrReply("ERR unknown subcommand '" + subCmd + "'. Try ACL HELP.")
+}
+
+// aclLog handles ACL LOG [count | RESET]
+func aclLog(args [][]byte) redis.Reply {
+	if len(args) > 1 {
+		return protocol.MakeErrReply("ERR wrong number of arguments for 'acl|log' command")
+	}
+	count := 10
+	if len(args) == 1 {
+		if strings.EqualFold(string(args[0]), "reset") {
+			acl.ResetLog()
+			return protocol.MakeOkReply()
+		}
+		n, err := strconv.Atoi(string(args[0]))
+		if err != nil || n < 0 {
+			return protocol.MakeErrReply("ERR value is out of range, must be positive")
+		}
+		count = n
+	}
+	now := time.Now()
+	entries := acl.Logs(count)
+	replies := make([]redis.Reply, len(entries))
+	for i, e := range entries {
+		replies[i] = makeMap(
+			"count", int64(e.Count),
+			"reason", e.Reason,
+			"context", e.Context,
+			"object", e.Object,
+			"username", e.Username,
+			"age-seconds", protocol.MakeDoubleReply(now.Sub(e.Created).Seconds()),
+			"client-info", e.ClientInfo,
+			"entry-id", e.EntryID,
+			"timestamp-created", e.Created.UnixMilli(),
+			"timestamp-last-updated", e.Updated.UnixMilli(),
+		)
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
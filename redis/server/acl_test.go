@@ -0,0 +1,35 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/atomwqh/MyGodis/redis/acl"
+)
+
+func TestAuth(t *testing.T) {
+	acl.SetRequirePass("pw")
+	defer acl.SetRequirePass("")
+	defer func() { _, _ = acl.DelUsers([]string{"alice"}) }()
+
+	addr := startServer(t)
+	c := dial(t, addr)
+	c.expect("-NOAUTH Authentication required.", "PING")
+	c.expect("-WRONGPASS invalid username-password pair or user is disabled.", "AUTH", "wrong")
+	c.expect("+OK", "AUTH", "pw")
+	c.expect("+PONG", "PING")
+	c.expect("+OK", "ACL", "SETUSER", "alice", "on", ">secret", "~app:*", "+@all", "-@admin")
+	c.expect("+OK", "AUTH", "alice", "secret")
+	c.send("ACL", "WHOAMI")
+	if name := c.readBulk(); name != "alice" {
+		t.Errorf("unexpected user %q", name)
+	}
+	c.expect("-NOPERM this user has no permissions to run the 'config|set' command", "CONFIG", "SET", "timeout", "1")
+
+	// deleted user is disconnected
+	admin := dial(t, addr)
+	admin.expect("+OK", "AUTH", "pw")
+	admin.expect(":1", "ACL", "DELUSER", "alice")
+	if _, err := c.readLine(); err == nil {
+		t.Error("client of deleted user should be closed")
+	}
+}
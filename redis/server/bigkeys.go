@@ -0,0 +1,180 @@
+package server
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atomwqh/MyGodis/interface/database"
+	"github.com/atomwqh/MyGodis/interface/redis"
+	"github.com/atomwqh/MyGodis/redis/eviction"
+	"github.com/atomwqh/MyGodis/redis/protocol"
+)
+
+// BIGKEYS 类似 redis-cli --bigkeys, 但是在服务端遍历当前 db, 按类型报告元素最多和估算内存最大的 key.
+// 按 cursor 每次取出约 CHUNK 个 key, 逐个读取后休眠 INTERVAL 毫秒, 休眠时不持有存储引擎的锁, 避免长时间占用 CPU 和阻塞写入
+
+func init() {
+	registerCommand("bigkeys", execBigKeys)
+}
+
+// keyScanner is implemented by database.DBEngine
+type keyScanner interface {
+	ScanKeys(dbIndex int, cursor int, count int) ([]string, int)
+	GetEntity(dbIndex int, key string) (*database.DataEntity, bool)
+}
+
+type bigKey struct {
+	key   string
+	value int64
+}
+
+// topKeys are the biggest keys in descending order
+type topKeys []bigKey
+
+// add keeps key if it is one of the n biggest keys
+func (top *topKeys) add(key string, value int64, n int) {
+	i := sort.Search(len(*top), func(i int) bool {
+		return (*top)[i].value < value
+	})
+	if i >= n {
+		return
+	}
+	*top = append(*top, bigKey{})
+	copy((*top)[i+1:], (*top)[i:])
+	(*top)[i] = bigKey{key: key, value: value}
+	if len(*top) > n {
+		*top = (*top)[:n]
+	}
+}
+
+func (top topKeys) reply() redis.Reply {
+	replies := make([]redis.Reply, len(top))
+	for i, k := range top {
+		replies[i] = protocol.MakeMultiRawReply([]redis.Reply{
+			protocol.MakeBulkReply([]byte(k.key)),
+			protocol.MakeIntReply(k.value),
+		})
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+// typeReport is the summary of keys of a type
+type typeReport struct {
+	keys       int64
+	elements   int64
+	bytes      int64
+	byElements topKeys
+	byBytes    topKeys
+}
+
+// elementCount returns length of string or number of elements of container
+func elementCount(entity *database.DataEntity) int64 {
+	switch data := entity.Data.(type) {
+	case []byte:
+		return int64(len(data))
+	case interface{ Len() int }:
+		return int64(data.Len())
+	}
+	return 0
+}
+
+// bigKeysOptions are options of BIGKEYS
+type bigKeysOptions struct {
+	top      int
+	chunk    int
+	interval time.Duration
+}
+
+func parseBigKeysOptions(args [][]byte) (*bigKeysOptions, redis.Reply) {
+	opts := &bigKeysOptions{top: 3, chunk: 1000, interval: time.Millisecond}
+	if len(args)%2 != 0 {
+		return nil, protocol.MakeErrReply("ERR syntax error")
+	}
+	for i := 0; i < len(args); i += 2 {
+		n, err := strconv.Atoi(string(args[i+1]))
+		if err != nil || n < 0 {
+			return nil, protocol.MakeErrReply("ERR value is out of range, must be positive")
+		}
+		switch strings.ToLower(string(args[i])) {
+		case "top":
+			opts.top = n
+		case "chunk":
+			opts.chunk = n
+		case "interval":
+			opts.interval = time.Duration(n) * time.Millisecond
+		default:
+			return nil, protocol.MakeErrReply("ERR syntax error")
+		}
+	}
+	if opts.top == 0 || opts.chunk == 0 {
+		return nil, protocol.MakeErrReply("ERR value is out of range, must be positive")
+	}
+	return opts, nil
+}
+
+// execBigKeys handles BIGKEYS [TOP count] [CHUNK count] [INTERVAL milliseconds]
+func execBigKeys(h *Handler, c redis.Connection, args [][]byte) redis.Reply {
+	opts, errReply := parseBigKeysOptions(args)
+	if errReply != nil {
+		return errReply
+	}
+	scanner, ok := h.db.(keyScanner)
+	if !ok {
+		return protocol.MakeErrReply("ERR BIGKEYS is not supported by the storage engine")
+	}
+	dbIndex := c.GetDBIndex()
+	reports := make(map[string]*typeReport)
+	var scanned int64
+	cursor := 0
+	for {
+		keys, next := scanner.ScanKeys(dbIndex, cursor, opts.chunk)
+		for _, key := range keys {
+			entity, ok := scanner.GetEntity(dbIndex, key)
+			if !ok {
+				// deleted after scanned
+				continue
+			}
+			typ := entity.Type()
+			report := reports[typ]
+			if report == nil {
+				report = &typeReport{}
+				reports[typ] = report
+			}
+			elements := elementCount(entity)
+			bytes := eviction.EntitySize(key, entity, defaultMemorySamples)
+			report.keys++
+			report.elements += elements
+			report.bytes += bytes
+			report.byElements.add(key, elements, opts.top)
+			report.byBytes.add(key, bytes, opts.top)
+			scanned++
+		}
+		if next == 0 {
+			break
+		}
+		cursor = next
+		if opts.interval > 0 {
+			time.Sleep(opts.interval)
+		}
+	}
+
+	types := make([]string, 0, len(reports))
+	for typ := range reports {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	pairs := make([]interface{}, 0, len(types)*2)
+	for _, typ := range types {
+		report := reports[typ]
+		pairs = append(pairs, typ, makeMap(
+			"keys", report.keys,
+			"elements", report.elements,
+			"bytes", report.bytes,
+			"biggest_by_elements", report.byElements.reply(),
+			"biggest_by_bytes", report.byBytes.reply(),
+		))
+	}
+	return makeMap("scanned", scanned, "types", makeMap(pairs...))
+}
@@ -0,0 +1,32 @@
+package server
+
+import "testing"
+
+func TestBigKeys(t *testing.T) {
+	c := dial(t, startServerWithDB(t))
+	c.expect("+OK", "SET", "a", "1")
+	c.expect("+OK", "SET", "b", "12345")
+	c.expect("+OK", "SET", "c", "123")
+	c.expect("*4", "BIGKEYS", "TOP", "1", "CHUNK", "2")
+	c.expectLines("$7", "scanned", ":3", "$5", "types", "*2", "$6", "string", "*10",
+		"$4", "keys", ":3", "$8", "elements", ":9", "$5", "bytes", ":204",
+		"$19", "biggest_by_elements", "*1", "*2", "$1", "b", ":5",
+		"$16", "biggest_by_bytes", "*1", "*2", "$1", "b", ":70")
+	c.expect("-ERR value is out of range, must be positive", "BIGKEYS", "CHUNK", "0")
+	c.expect("-ERR syntax error", "BIGKEYS", "TOP")
+}
+
+func TestHotKeys(t *testing.T) {
+	c := dial(t, startServerWithDB(t))
+	c.expect("+OK", "SET", "a", "1")
+	c.expect("+OK", "SET", "b", "2")
+	for i := 0; i < 3; i++ {
+		c.expect("$1", "GET", "b")
+		c.expectLine("2")
+	}
+	c.expect("*4", "HOTKEYS", "COUNT", "1")
+	c.expectLines("$5", "total", ":5", "$4", "keys", "*1", "*2", "$1", "b", ":4")
+	c.expect("+OK", "HOTKEYS", "RESET")
+	c.expect("*4", "HOTKEYS")
+	c.expectLines("$5", "total", ":0", "$4", "keys", "*0")
+}
@@ -0,0 +1,391 @@
+package server
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atomwqh/MyGodis/interface/redis"
+	"github.com/atomwqh/MyGodis/redis/acl"
+	"github.com/atomwqh/MyGodis/redis/connection"
+	"github.com/atomwqh/MyGodis/redis/protocol"
+)
+
+func init() {
+	registerCommand("client", execClient)
+}
+
+// pauseState is the state of CLIENT PAUSE, paused clients wait in Handle or are parked by OnData
+type pauseState struct {
+	mu        sync.Mutex
+	end       time.Time
+	writeOnly bool
+	resumed   chan struct{} // closed by CLIENT UNPAUSE
+}
+
+// checkPause returns whether the command is paused, it may run after remaining or resumed is closed
+func (h *Handler) checkPause(cmdLine [][]byte) (paused bool, remaining time.Duration, resumed <-chan struct{}) {
+	if acl.CommandName(cmdLine) == "client|unpause" {
+		return false, 0, nil
+	}
+	h.pause.mu.Lock()
+	defer h.pause.mu.Unlock()
+	remaining = time.Until(h.pause.end)
+	paused = remaining > 0 && (!h.pause.writeOnly || acl.IsWrite(cmdLine))
+	return paused, remaining, h.pause.resumed
+}
+
+// waitPause blocks until the command is not paused
+func (h *Handler) waitPause(client *connection.Connection, cmdLine [][]byte) {
+	for {
+		paused, remaining, resumed := h.checkPause(cmdLine)
+		if !paused {
+			return
+		}
+		// client may be waiting for replies of commands before
+		_ = client.Flush()
+		waitResume(remaining, resumed)
+	}
+}
+
+// waitResume waits until pause ends or CLIENT UNPAUSE
+func waitResume(remaining time.Duration, resumed <-chan struct{}) {
+	timer := time.NewTimer(remaining)
+	select {
+	case <-timer.C:
+	case <-resumed:
+	}
+	timer.Stop()
+}
+
+// pauseClients pauses clients until end, ALL mode overrides WRITE mode like redis
+func (h *Handler) pauseClients(end time.Time, writeOnly bool) {
+	h.pause.mu.Lock()
+	defer h.pause.mu.Unlock()
+	if time.Now().After(h.pause.end) {
+		h.pause.writeOnly = writeOnly
+	} else if !writeOnly {
+		h.pause.writeOnly = false
+	}
+	if end.After(h.pause.end) {
+		h.pause.end = end
+	}
+	if h.pause.resumed == nil {
+		h.pause.resumed = make(chan struct{})
+	}
+}
+
+func (h *Handler) unpauseClients() {
+	h.pause.mu.Lock()
+	defer h.pause.mu.Unlock()
+	h.pause.end = time.Time{}
+	if h.pause.resumed != nil {
+		close(h.pause.resumed)
+		h.pause.resumed = nil
+	}
+}
+
+// validClientName checks name of CLIENT SETNAME and HELLO SETNAME
+func validClientName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] < '!' || name[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+var invalidNameReply = protocol.MakeErrReply("ERR Client names cannot contain spaces, newlines or special characters.")
+
+// clientFilter selects clients for CLIENT LIST and CLIENT KILL
+type clientFilter struct {
+	ids    map[uint64]struct{}
+	addr   string
+	laddr  string
+	user   string
+	typ    string
+	maxAge time.Duration
+	skip   *connection.Connection
+}
+
+func (f *clientFilter) match(client *connection.Connection) bool {
+	if client == f.skip {
+		return false
+	}
+	if f.ids != nil {
+		if _, ok := f.ids[client.ID()]; !ok {
+			return false
+		}
+	}
+	return (f.addr == "" || client.RemoteAddr() == f.addr) &&
+		(f.laddr == "" || client.LocalAddr() == f.laddr) &&
+		(f.user == "" || client.GetUser() == f.user) &&
+		(f.typ == "" || client.Type() == f.typ) &&
+		(f.maxAge == 0 || client.Age() >= f.maxAge)
+}
+
+// clientType converts type in command to the type of connection.Connection, it returns empty string if unknown
+func clientType(typ string) string {
+	switch strings.ToLower(typ) {
+	case "normal", "master", "pubsub":
+		return strings.ToLower(typ)
+	case "replica", "slave":
+		return "replica"
+	}
+	return ""
+}
+
+// clients returns clients matching filter sorted by id
+func (h *Handler) clients(filter *clientFilter) []*connection.Connection {
+	var result []*connection.Connection
+	h.activeConn.Range(func(key interface{}, val interface{}) bool {
+		client := key.(*connection.Connection)
+		if filter.match(client) {
+			result = append(result, client)
+		}
+		return true
+	})
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID() < result[j].ID()
+	})
+	return result
+}
+
+// parseID parses a client id, ok is false if s is not a positive integer
+func parseID(s []byte) (uint64, bool) {
+	id, err := strconv.ParseUint(string(s), 10, 64)
+	return id, err == nil && id > 0
+}
+
+// execClient handles CLIENT subcommands
+func execClient(h *Handler, c redis.Connection, args [][]byte) redis.Reply {
+	if len(args) == 0 {
+		return protocol.MakeErrReply("ERR wrong number of arguments for 'client' command")
+	}
+	client := c.(*connection.Connection)
+	subCmd := strings.ToLower(string(args[0]))
+	args = args[1:]
+	wrongArgs := protocol.MakeErrReply("ERR wrong number of arguments for 'client|" + subCmd + "' command")
+	switch subCmd {
+	case "id":
+		if len(args) != 0 {
+			return wrongArgs
+		}
+		return protocol.MakeIntReply(int64(client.ID()))
+	case "info":
+		if len(args) != 0 {
+			return wrongArgs
+		}
+		return protocol.MakeVerbatimReply("txt", []byte(client.Info()+"\n"))
+	case "list":
+		return clientList(h, args)
+	case "kill":
+		return clientKill(h, client, args)
+	case "setname":
+		if len(args) != 1 {
+			return wrongArgs
+		}
+		if !validClientName(string(args[0])) {
+			return invalidNameReply
+		}
+		client.SetName(string(args[0]))
+		return protocol.MakeOkReply()
+	case "getname":
+		if len(args) != 0 {
+			return wrongArgs
+		}
+		if name := client.GetName(); name != "" {
+			return protocol.MakeBulkReply([]byte(name))
+		}
+		return protocol.MakeNullBulkReply()
+	case "pause":
+		if len(args) != 1 && len(args) != 2 {
+			return wrongArgs
+		}
+		timeout, err := strconv.ParseInt(string(args[0]), 10, 64)
+		if err != nil || timeout < 0 {
+			return protocol.MakeErrReply("ERR timeout is not an integer or out of range")
+		}
+		writeOnly := false
+		if len(args) == 2 {
+			switch strings.ToLower(string(args[1])) {
+			case "write":
+				writeOnly = true
+			case "all":
+			default:
+				return protocol.MakeErrReply("ERR syntax error")
+			}
+		}
+		h.pauseClients(time.Now().Add(time.Duration(timeout)*time.Millisecond), writeOnly)
+		return protocol.MakeOkReply()
+	case "unpause":
+		if len(args) != 0 {
+			return wrongArgs
+		}
+		h.unpauseClients()
+		return protocol.MakeOkReply()
+	case "no-evict":
+		if len(args) != 1 {
+			return wrongArgs
+		}
+		switch strings.ToLower(string(args[0])) {
+		case "on":
+			client.SetNoEvict(true)
+		case "off":
+			client.SetNoEvict(false)
+		default:
+			return protocol.MakeErrReply("ERR syntax error")
+		}
+		return protocol.MakeOkReply()
+	case "reply":
+		if len(args) != 1 {
+			return wrongArgs
+		}
+		switch strings.ToLower(string(args[0])) {
+		case "on":
+			client.SetReplyMode(connection.ReplyOn)
+		case "off":
+			client.SetReplyMode(connection.ReplyOff)
+		case "skip":
+			client.SetReplyMode(connection.ReplySkip)
+		default:
+			return protocol.MakeErrReply("ERR syntax error")
+		}
+		return protocol.MakeOkReply()
+	case "tracking":
+		return clientTracking(h, client, args)
+	case "caching":
+		if len(args) != 1 {
+			return wrongArgs
+		}
+		switch strings.ToLower(string(args[0])) {
+		case "yes":
+			return h.tracker.setCaching(client, true)
+		case "no":
+			return h.tracker.setCaching(client, false)
+		}
+		return protocol.MakeErrReply("ERR syntax error")
+	case "getredir":
+		if len(args) != 0 {
+			return wrongArgs
+		}
+		return clientGetRedir(h, client)
+	case "trackinginfo":
+		if len(args) != 0 {
+			return wrongArgs
+		}
+		return clientTrackingInfo(h, client)
+	}
+	return protocol.MakeErrReply("ERR unknown subcommand '" + subCmd + "'. Try CLIENT HELP.")
+}
+
+// clientList handles CLIENT LIST [TYPE type] [ID id [id ...]]
+func clientList(h *Handler, args [][]byte) redis.Reply {
+	filter := &clientFilter{}
+	if len(args) > 0 {
+		switch strings.ToLower(string(args[0])) {
+		case "type":
+			if len(args) != 2 {
+				return protocol.MakeErrReply("ERR syntax error")
+			}
+			if filter.typ = clientType(string(args[1])); filter.typ == "" {
+				return protocol.MakeErrReply("ERR Unknown client type '" + string(args[1]) + "'")
+			}
+		case "id":
+			if len(args) < 2 {
+				return protocol.MakeErrReply("ERR syntax error")
+			}
+			filter.ids = make(map[uint64]struct{})
+			for _, arg := range args[1:] {
+				id, ok := parseID(arg)
+				if !ok {
+					return protocol.MakeErrReply("ERR Invalid client ID")
+				}
+				filter.ids[id] = struct{}{}
+			}
+		default:
+			return protocol.MakeErrReply("ERR syntax error")
+		}
+	}
+	var buf strings.Builder
+	for _, client := range h.clients(filter) {
+		buf.WriteString(client.Info())
+		buf.WriteByte('\n')
+	}
+	return protocol.MakeVerbatimReply("txt", []byte(buf.String()))
+}
+
+// clientKill handles CLIENT KILL addr:port and CLIENT KILL <filter> <value> [<filter> <value> ...]
+func clientKill(h *Handler, self *connection.Connection, args [][]byte) redis.Reply {
+	if len(args) == 0 {
+		return protocol.MakeErrReply("ERR wrong number of arguments for 'client|kill' command")
+	}
+	if len(args) == 1 {
+		// old style returns error if there is no such client
+		killed := h.killClients(self, &clientFilter{addr: string(args[0])})
+		if killed == 0 {
+			return protocol.MakeErrReply("ERR No such client")
+		}
+		return protocol.MakeOkReply()
+	}
+	if len(args)%2 != 0 {
+		return protocol.MakeErrReply("ERR syntax error")
+	}
+	filter := &clientFilter{skip: self}
+	for i := 0; i < len(args); i += 2 {
+		value := string(args[i+1])
+		switch strings.ToLower(string(args[i])) {
+		case "id":
+			id, ok := parseID(args[i+1])
+			if !ok {
+				return protocol.MakeErrReply("ERR client-id should be greater than 0")
+			}
+			filter.ids = map[uint64]struct{}{id: {}}
+		case "addr":
+			filter.addr = value
+		case "laddr":
+			filter.laddr = value
+		case "user":
+			filter.user = value
+		case "type":
+			if filter.typ = clientType(value); filter.typ == "" {
+				return protocol.MakeErrReply("ERR Unknown client type '" + value + "'")
+			}
+		case "maxage":
+			seconds, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || seconds <= 0 {
+				return protocol.MakeErrReply("ERR syntax error")
+			}
+			filter.maxAge = time.Duration(seconds) * time.Second
+		case "skipme":
+			switch strings.ToLower(value) {
+			case "yes":
+				filter.skip = self
+			case "no":
+				filter.skip = nil
+			default:
+				return protocol.MakeErrReply("ERR syntax error")
+			}
+		default:
+			return protocol.MakeErrReply("ERR syntax error")
+		}
+	}
+	return protocol.MakeIntReply(int64(h.killClients(self, filter)))
+}
+
+// killClients closes clients matching filter, self is closed after the reply is sent
+func (h *Handler) killClients(self *connection.Connection, filter *clientFilter) int {
+	killed := 0
+	for _, client := range h.clients(filter) {
+		if client == self {
+			self.CloseAfterReply()
+		} else {
+			// don't wait for the client to finish sending like Close, a slow client would block CLIENT KILL
+			_ = client.Kill()
+		}
+		killed++
+	}
+	return killed
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientCommands(t *testing.T) {
+	addr := startServer(t)
+	c := dial(t, addr)
+	c.expect("+OK", "CLIENT", "SETNAME", "worker-1")
+	c.expect("-ERR Client names cannot contain spaces, newlines or special characters.", "CLIENT", "SETNAME", "a b")
+	c.send("CLIENT", "GETNAME")
+	if name := c.readBulk(); name != "worker-1" {
+		t.Errorf("unexpected name %q", name)
+	}
+	c.send("CLIENT", "ID")
+	line, _ := c.readLine()
+	id, err := strconv.Atoi(strings.TrimPrefix(line, ":"))
+	if err != nil {
+		t.Fatalf("unexpected reply of CLIENT ID %q", line)
+	}
+
+	other := dial(t, addr)
+	other.send("CLIENT", "LIST")
+	list := other.readBulk()
+	if !strings.Contains(list, "id="+strconv.Itoa(id)+" ") || !strings.Contains(list, "name=worker-1") ||
+		!strings.Contains(list, "cmd=client|id") {
+		t.Errorf("unexpected CLIENT LIST %q", list)
+	}
+
+	// no reply for SKIP and the next command
+	c.send("CLIENT", "REPLY", "SKIP")
+	c.send("PING", "skipped")
+	c.expect("+PONG", "PING")
+
+	// commands wait until pause ends
+	other.expect("+OK", "CLIENT", "PAUSE", "200", "ALL")
+	start := time.Now()
+	c.expect("+PONG", "PING")
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("command should be paused, elapsed %v", elapsed)
+	}
+
+	other.expect(":1", "CLIENT", "KILL", "ID", strconv.Itoa(id))
+	if _, err = c.readLine(); err == nil {
+		t.Error("killed client should be closed")
+	}
+	other.expect(":1", "CLIENT", "KILL", "SKIPME", "no")
+	if _, err = other.readLine(); err == nil {
+		t.Error("client killing itself should be closed after reply")
+	}
+
+	// a client killing itself is closed even if replies are off
+	quiet := dial(t, startServer(t))
+	quiet.send("CLIENT", "REPLY", "OFF")
+	quiet.send("CLIENT", "KILL", "SKIPME", "no")
+	_ = quiet.conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err = quiet.readLine(); err != io.EOF {
+		t.Errorf("client killing itself under reply off should be closed, actual %v", err)
+	}
+}
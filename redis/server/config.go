@@ -0,0 +1,62 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/atomwqh/MyGodis/config"
+	"github.com/atomwqh/MyGodis/interface/redis"
+	"github.com/atomwqh/MyGodis/redis/protocol"
+)
+
+func init() {
+	registerCommand("config", execConfig)
+}
+
+// execConfig handles CONFIG GET pattern [pattern ...], CONFIG SET name value [name value ...] and CONFIG REWRITE
+func execConfig(h *Handler, c redis.Connection, args [][]byte) redis.Reply {
+	if len(args) == 0 {
+		return protocol.MakeErrReply("ERR wrong number of arguments for 'config' command")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	switch subCmd {
+	case "get":
+		if len(args) < 2 {
+			return protocol.MakeErrReply("ERR wrong number of arguments for 'config|get' command")
+		}
+		var keys, values []redis.Reply
+		seen := make(map[string]struct{})
+		for _, pattern := range args[1:] {
+			names, vals := config.GetParams(string(pattern))
+			for i, name := range names {
+				if _, ok := seen[name]; ok {
+					continue
+				}
+				seen[name] = struct{}{}
+				keys = append(keys, protocol.MakeBulkReply([]byte(name)))
+				values = append(values, protocol.MakeBulkReply([]byte(vals[i])))
+			}
+		}
+		return protocol.MakeMapReply(keys, values)
+	case "set":
+		if len(args) < 3 || len(args)%2 != 1 {
+			return protocol.MakeErrReply("ERR wrong number of arguments for 'config|set' command")
+		}
+		pairs := make([]string, len(args)-1)
+		for i, arg := range args[1:] {
+			pairs[i] = string(arg)
+		}
+		if err := config.Set(pairs); err != nil {
+			return protocol.MakeErrReply("ERR " + err.Error())
+		}
+		return protocol.MakeOkReply()
+	case "rewrite":
+		if len(args) != 1 {
+			return protocol.MakeErrReply("ERR wrong number of arguments for 'config|rewrite' command")
+		}
+		if err := config.Rewrite(); err != nil {
+			return protocol.MakeErrReply("ERR " + err.Error())
+		}
+		return protocol.MakeOkReply()
+	}
+	return protocol.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try CONFIG HELP.")
+}
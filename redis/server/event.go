@@ -0,0 +1,131 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+
+	"github.com/atomwqh/MyGodis/config"
+	"github.com/atomwqh/MyGodis/interface/redis"
+	"github.com/atomwqh/MyGodis/interface/tcp"
+	"github.com/atomwqh/MyGodis/redis/connection"
+	"github.com/atomwqh/MyGodis/redis/parser"
+	"github.com/atomwqh/MyGodis/redis/protocol"
+)
+
+// Handler 同时实现了 tcp.EventHandler, 由 netpoll 的事件循环推送数据, 连接不需要独占 goroutine.
+// Framer 记录了未完整到达的请求的扫描进度, 只有完整的请求才会被解析, 超大的 bulk 分多次到达时不会被重复扫描.
+// 被 CLIENT PAUSE 暂停的命令不会阻塞 worker, 连接被挂起, 暂停结束后由 tcp.ResumableConn 重新处理剩余的数据
+
+var errClosing = errors.New("handler is closing")
+
+// session is the state of a connection driven by event loop
+type session struct {
+	conn   net.Conn
+	client *connection.Connection
+	input  *bytes.Reader
+	reader *parser.Reader
+	framer *parser.Framer
+	parked int32 // 1 means waiting for pause to end, accessed atomically
+}
+
+// OnOpen implements tcp.EventHandler
+func (h *Handler) OnOpen(conn net.Conn) interface{} {
+	client := connection.NewConn(conn)
+	if h.closing.Get() {
+		// closing handler refuse new connection
+		_ = client.Close()
+	}
+	h.addClient(client)
+	input := bytes.NewReader(nil)
+	// limits changed by CONFIG SET take effect on new connections
+	limits := config.Get().ProtoLimits()
+	return &session{
+		conn:   conn,
+		client: client,
+		input:  input,
+		reader: parser.NewReaderWithLimits(input, limits),
+		framer: parser.NewFramer(limits),
+	}
+}
+
+// OnData executes complete commands in data and returns the length of them
+func (h *Handler) OnData(s interface{}, data []byte) (int, error) {
+	sess := s.(*session)
+	if h.closing.Get() {
+		return 0, errClosing
+	}
+	end, ok := sess.framer.Scan(data)
+	if !ok {
+		// requests can't be framed, parse all data
+		end = len(data)
+	}
+	consumed, err := h.execRequests(sess, data, end)
+	sess.framer.Discard(consumed)
+	return consumed, err
+}
+
+// execRequests executes requests in data[:end] and returns the length of executed ones
+func (h *Handler) execRequests(sess *session, data []byte, end int) (int, error) {
+	sess.input.Reset(data[:end])
+	sess.reader.Reset(sess.input)
+	consumed := 0
+	for {
+		reply, err := sess.reader.Next()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// the rest is an incomplete command, send replies of this batch
+			return consumed, sess.client.Flush()
+		}
+		next := end - sess.input.Len() - sess.reader.Buffered()
+		if err != nil {
+			consumed = next
+			var protoErr *parser.ProtocolError
+			if errors.As(err, &protoErr) {
+				h.replyProtocolError(sess.client, protoErr)
+			}
+			_ = sess.client.Flush()
+			return consumed, err
+		}
+		if h.park(sess, reply) {
+			// the command is parsed again after pause ends
+			sess.reader.Release()
+			return consumed, sess.client.Flush()
+		}
+		consumed = next
+		if h.handleRequest(sess.client, reply, len(data)-consumed) {
+			sess.reader.Release()
+		}
+	}
+}
+
+// park returns true if the command is paused by CLIENT PAUSE, the connection is resumed after pause ends
+func (h *Handler) park(sess *session, reply redis.Reply) bool {
+	r, ok := reply.(*protocol.MultiBulkReply)
+	if !ok || len(r.Args) == 0 {
+		return false
+	}
+	paused, remaining, resumed := h.checkPause(r.Args)
+	if !paused {
+		return false
+	}
+	resumable, ok := sess.conn.(tcp.ResumableConn)
+	if !ok {
+		h.waitPause(sess.client, r.Args)
+		return false
+	}
+	if atomic.CompareAndSwapInt32(&sess.parked, 0, 1) {
+		go func() {
+			waitResume(remaining, resumed)
+			atomic.StoreInt32(&sess.parked, 0)
+			resumable.Resume()
+		}()
+	}
+	return true
+}
+
+// OnClose implements tcp.EventHandler
+func (h *Handler) OnClose(s interface{}) {
+	h.closeClient(s.(*session).client)
+}
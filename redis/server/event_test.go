@@ -0,0 +1,134 @@
+package server
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atomwqh/MyGodis/config"
+)
+
+// bufConn records data written by handler
+type bufConn struct {
+	net.Conn
+	buf    bytes.Buffer
+	writes int
+	closed bool
+}
+
+func (c *bufConn) Write(b []byte) (int, error) { c.writes++; return c.buf.Write(b) }
+func (c *bufConn) Close() error                { c.closed = true; return nil }
+func (c *bufConn) RemoteAddr() net.Addr        { return &net.TCPAddr{} }
+
+func TestOnData(t *testing.T) {
+	h := MakeHandler(nil)
+	conn := &bufConn{}
+	s := h.OnOpen(conn)
+	defer h.OnClose(s)
+
+	data := []byte("*1\r\n$4\r\nPING\r\nPING\r\n*2\r\n$4\r\nPI")
+	consumed, err := h.OnData(s, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the last command is incomplete
+	if consumed != len(data)-len("*2\r\n$4\r\nPI") {
+		t.Errorf("wrong consumed %d", consumed)
+	}
+	if conn.buf.String() != "+PONG\r\n+PONG\r\n" {
+		t.Errorf("unexpected replies %q", conn.buf.String())
+	}
+
+	conn.buf.Reset()
+	data = append(data[consumed:], "NG\r\n$2\r\nhi\r\n"...)
+	consumed, err = h.OnData(s, data)
+	if err != nil || consumed != len(data) {
+		t.Errorf("expect all consumed, actual %d %v", consumed, err)
+	}
+	if conn.buf.String() != "$2\r\nhi\r\n" {
+		t.Errorf("unexpected reply %q", conn.buf.String())
+	}
+
+	// fatal protocol error closes connection
+	if _, err = h.OnData(s, []byte("*1\r\n$abc\r\n")); err == nil {
+		t.Error("expect protocol error")
+	}
+}
+
+func TestReplyBatching(t *testing.T) {
+	h := MakeHandler(nil)
+	conn := &bufConn{}
+	s := h.OnOpen(conn)
+	defer h.OnClose(s)
+
+	data := []byte(strings.Repeat("*1\r\n$4\r\nPING\r\n", 10))
+	if _, err := h.OnData(s, data); err != nil {
+		t.Fatal(err)
+	}
+	if conn.buf.String() != strings.Repeat("+PONG\r\n", 10) {
+		t.Errorf("unexpected replies %q", conn.buf.String())
+	}
+	if conn.writes != 1 {
+		t.Errorf("expect replies sent in 1 write, actual %d", conn.writes)
+	}
+}
+
+func TestOutputBufferLimit(t *testing.T) {
+	config.Update(func(props *config.ServerProperties) {
+		props.ClientOutputBufferLimit[config.ClassNormal] = config.OutputBufferLimit{Hard: 64}
+	})
+	defer config.Update(func(props *config.ServerProperties) {
+		props.ClientOutputBufferLimit[config.ClassNormal] = config.OutputBufferLimit{}
+	})
+	h := MakeHandler(nil)
+	conn := &bufConn{}
+	s := h.OnOpen(conn)
+	defer h.OnClose(s)
+
+	data := []byte(strings.Repeat("*1\r\n$4\r\nPING\r\n", 20))
+	if _, err := h.OnData(s, data); err != nil {
+		t.Fatal(err)
+	}
+	if !conn.closed {
+		t.Error("client over hard limit should be closed")
+	}
+	if conn.writes != 0 {
+		t.Errorf("replies should be dropped, actual %q", conn.buf.String())
+	}
+}
+
+// resumableConn is a bufConn driven by event loop
+type resumableConn struct {
+	bufConn
+	resumed chan struct{}
+}
+
+func (c *resumableConn) Resume() { c.resumed <- struct{}{} }
+
+func TestOnDataPause(t *testing.T) {
+	h := MakeHandler(nil)
+	conn := &resumableConn{resumed: make(chan struct{}, 1)}
+	s := h.OnOpen(conn)
+	defer h.OnClose(s)
+
+	h.pauseClients(time.Now().Add(time.Hour), false)
+	data := []byte("*1\r\n$4\r\nPING\r\n")
+	// paused command doesn't block the worker
+	if consumed, err := h.OnData(s, data); err != nil || consumed != 0 {
+		t.Fatalf("paused command should not be consumed, actual %d %v", consumed, err)
+	}
+	h.unpauseClients()
+	select {
+	case <-conn.resumed:
+	case <-time.After(time.Second):
+		t.Fatal("connection is not resumed after unpause")
+	}
+	if consumed, err := h.OnData(s, data); err != nil || consumed != len(data) {
+		t.Errorf("expect all consumed, actual %d %v", consumed, err)
+	}
+	if conn.buf.String() != "+PONG\r\n" {
+		t.Errorf("unexpected reply %q", conn.buf.String())
+	}
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/atomwqh/MyGodis/interface/redis"
+	"github.com/atomwqh/MyGodis/redis/acl"
+	"github.com/atomwqh/MyGodis/redis/connection"
+	"github.com/atomwqh/MyGodis/redis/protocol"
+)
+
+// Version is reported by HELLO, clients compare it with redis versions to detect features
+const Version = "7.0.0"
+
+func init() {
+	registerCommand("hello", execHello)
+}
+
+// execHello handles HELLO [protover [AUTH username password] [SETNAME clientname]], it switches the RESP version of connection
+func execHello(h *Handler, c redis.Connection, args [][]byte) redis.Reply {
+	version := c.GetProtocol()
+	if len(args) > 0 {
+		v, err := strconv.Atoi(string(args[0]))
+		if err != nil {
+			return protocol.MakeErrReply("ERR Protocol version is not an integer or out of range")
+		}
+		if v != protocol.RESP2 && v != protocol.RESP3 {
+			return protocol.MakeErrReply("NOPROTO unsupported protocol version")
+		}
+		version = v
+	}
+	var username, password, name string
+	auth, setName := false, false
+	for i := 1; i < len(args); i++ {
+		if strings.EqualFold(string(args[i]), "auth") && i+2 < len(args) {
+			username, password = string(args[i+1]), string(args[i+2])
+			auth = true
+			i += 2
+			continue
+		}
+		if strings.EqualFold(string(args[i]), "setname") && i+1 < len(args) {
+			name = string(args[i+1])
+			setName = true
+			i++
+			continue
+		}
+		return protocol.MakeErrReply("ERR Syntax error in HELLO option '" + string(args[i]) + "'")
+	}
+	if setName && !validClientName(name) {
+		return invalidNameReply
+	}
+	if auth {
+		if errReply := authenticate(c, username, password); errReply != nil {
+			return errReply
+		}
+	} else if acl.GetUser(c.GetUser()) == nil {
+		return protocol.MakeErrReply("NOAUTH HELLO must be called with the client already authenticated, " +
+			"otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client " +
+			"and select the RESP protocol version at the same time")
+	}
+	client := c.(*connection.Connection)
+	if setName {
+		client.SetName(name)
+	}
+	client.SetProtocol(version)
+	return protocol.MakeMapReply(
+		[]redis.Reply{
+			protocol.MakeBulkReply([]byte("server")),
+			protocol.MakeBulkReply([]byte("version")),
+			protocol.MakeBulkReply([]byte("proto")),
+			protocol.MakeBulkReply([]byte("id")),
+			protocol.MakeBulkReply([]byte("mode")),
+			protocol.MakeBulkReply([]byte("role")),
+			protocol.MakeBulkReply([]byte("modules")),
+		},
+		[]redis.Reply{
+			protocol.MakeBulkReply([]byte("redis")),
+			protocol.MakeBulkReply([]byte(Version)),
+			protocol.MakeIntReply(int64(version)),
+			protocol.MakeIntReply(int64(client.ID())),
+			protocol.MakeBulkReply([]byte("standalone")),
+			protocol.MakeBulkReply([]byte("master")),
+			protocol.MakeEmptyMultiBulkReply(),
+		},
+	)
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/atomwqh/MyGodis/config"
+	"github.com/atomwqh/MyGodis/datastruct/topk"
+	"github.com/atomwqh/MyGodis/interface/redis"
+	"github.com/atomwqh/MyGodis/redis/acl"
+	"github.com/atomwqh/MyGodis/redis/protocol"
+)
+
+// HOTKEYS 报告最近访问次数最多的 key. 发给 db 的命令的每个 key 都会计入 top-k sketch,
+// 次数是估算值, total 是同一时间窗口内所有 key 的访问次数, 两者之比即该 key 占的流量.
+// 不同 db 中同名的 key 合并计数
+
+func init() {
+	registerCommand("hotkeys", execHotKeys)
+}
+
+type hotKeys struct {
+	mu     sync.Mutex
+	sketch atomic.Value // *topk.TopK, replaced after hotkeys-top-k is changed
+}
+
+// get returns sketch keeping k keys
+func (hk *hotKeys) get(k int) *topk.TopK {
+	sketch, _ := hk.sketch.Load().(*topk.TopK)
+	if sketch != nil && sketch.K() == k {
+		return sketch
+	}
+	hk.mu.Lock()
+	defer hk.mu.Unlock()
+	sketch, _ = hk.sketch.Load().(*topk.TopK)
+	if sketch == nil || sketch.K() != k {
+		sketch = topk.New(k)
+		hk.sketch.Store(sketch)
+	}
+	return sketch
+}
+
+// record counts accesses of keys in cmdLine
+func (hk *hotKeys) record(cmdLine [][]byte) {
+	k := config.Get().HotkeysTopK
+	if k <= 0 {
+		return
+	}
+	keys := acl.CommandKeys(cmdLine)
+	if len(keys) == 0 {
+		return
+	}
+	sketch := hk.get(k)
+	for _, key := range keys {
+		sketch.Add(key)
+	}
+}
+
+// execHotKeys handles HOTKEYS [COUNT count] and HOTKEYS RESET
+func execHotKeys(h *Handler, c redis.Connection, args [][]byte) redis.Reply {
+	k := config.Get().HotkeysTopK
+	if k <= 0 {
+		return protocol.MakeErrReply("ERR hot keys are not counted, use CONFIG SET hotkeys-top-k <count> to enable it")
+	}
+	sketch := h.hotKeys.get(k)
+	if len(args) == 1 && strings.EqualFold(string(args[0]), "reset") {
+		sketch.Reset()
+		return protocol.MakeOkReply()
+	}
+	count := k
+	if len(args) == 2 && strings.EqualFold(string(args[0]), "count") {
+		n, err := strconv.Atoi(string(args[1]))
+		if err != nil || n <= 0 {
+			return protocol.MakeErrReply("ERR value is out of range, must be positive")
+		}
+		count = n
+	} else if len(args) != 0 {
+		return protocol.MakeErrReply("ERR syntax error")
+	}
+	items := sketch.List()
+	if count < len(items) {
+		items = items[:count]
+	}
+	replies := make([]redis.Reply, len(items))
+	for i, item := range items {
+		replies[i] = protocol.MakeMultiRawReply([]redis.Reply{
+			protocol.MakeBulkReply([]byte(item.Key)),
+			protocol.MakeIntReply(int64(item.Count)),
+		})
+	}
+	return makeMap("total", int64(sketch.Total()), "keys", protocol.MakeMultiRawReply(replies))
+}
@@ -0,0 +1,284 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/atomwqh/MyGodis/config"
+	"github.com/atomwqh/MyGodis/interface/database"
+	"github.com/atomwqh/MyGodis/interface/redis"
+	"github.com/atomwqh/MyGodis/redis/eviction"
+	"github.com/atomwqh/MyGodis/redis/lazyfree"
+	"github.com/atomwqh/MyGodis/redis/protocol"
+	"github.com/atomwqh/MyGodis/tcp"
+)
+
+// INFO 的字段名与 redis 保持一致, 方便已有的监控脚本解析, metricTypes 中的数值字段同时由 /metrics 导出.
+// 存储引擎的统计 (命中率, 过期的 key) 由实现了 database.StatsReporter 的 db 提供, 持久化的状态由 database.PersistenceReporter 提供,
+// 服务端无法得知的字段不输出. keyspace 没有 avg_ttl, 因为计算它需要存储引擎采样 TTL
+
+func init() {
+	registerCommand("info", execInfo)
+}
+
+// infoField is a line of INFO
+type infoField struct {
+	name  string
+	value string
+}
+
+type infoSection struct {
+	name   string
+	fields func(h *Handler) []infoField
+	// extra sections are only printed by INFO ALL or by name
+	extra bool
+}
+
+// infoSections are printed in order
+var infoSections = []infoSection{
+	{"server", (*Handler).serverInfo, false},
+	{"clients", (*Handler).clientsInfo, false},
+	{"memory", (*Handler).memoryInfo, false},
+	{"persistence", (*Handler).persistenceInfo, false},
+	{"stats", (*Handler).statsInfo, false},
+	{"replication", (*Handler).replicationInfo, false},
+	{"commandstats", (*Handler).commandStatsInfo, true},
+	{"keyspace", (*Handler).keyspaceInfo, false},
+}
+
+// randomID generates 40 hex characters like run_id of redis
+func randomID() string {
+	buf := make([]byte, 20)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func itoa(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
+
+// humanBytes formats memory like used_memory_human
+func humanBytes(n uint64) string {
+	units := []string{"B", "K", "M", "G", "T"}
+	v := float64(n)
+	i := 0
+	for v >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	if i == 0 {
+		return strconv.FormatUint(n, 10) + "B"
+	}
+	return fmt.Sprintf("%.2f%s", v, units[i])
+}
+
+func (h *Handler) serverInfo() []infoField {
+	uptime := int64(time.Since(h.startTime) / time.Second)
+	executable, _ := os.Executable()
+	return []infoField{
+		{"redis_version", Version},
+		{"redis_mode", "standalone"},
+		{"os", runtime.GOOS + " " + runtime.GOARCH},
+		{"arch_bits", strconv.Itoa(strconv.IntSize)},
+		{"go_version", runtime.Version()},
+		{"process_id", strconv.Itoa(os.Getpid())},
+		{"run_id", h.runID},
+		{"tcp_port", strconv.Itoa(config.Get().Port)},
+		{"server_time_usec", itoa(time.Now().UnixNano() / int64(time.Microsecond))},
+		{"uptime_in_seconds", itoa(uptime)},
+		{"uptime_in_days", itoa(uptime / 86400)},
+		{"executable", executable},
+		{"config_file", config.File()},
+	}
+}
+
+func (h *Handler) clientsInfo() []infoField {
+	h.pubsub.mu.RLock()
+	pubsubClients := len(h.pubsub.clients)
+	h.pubsub.mu.RUnlock()
+	return []infoField{
+		{"connected_clients", strconv.Itoa(tcp.ClientCount())},
+		{"maxclients", strconv.Itoa(config.Get().MaxClients)},
+		{"pubsub_clients", strconv.Itoa(pubsubClients)},
+		{"tracking_clients", itoa(int64(atomic.LoadInt32(&h.tracker.count)))},
+	}
+}
+
+// memStats reads runtime.MemStats and updates the peak of used memory
+func (h *Handler) memStats() (used uint64, rss uint64, peak uint64) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	used = m.HeapAlloc
+	rss = m.Sys - m.HeapReleased
+	for {
+		peak = atomic.LoadUint64(&h.memPeak)
+		if used <= peak || atomic.CompareAndSwapUint64(&h.memPeak, peak, used) {
+			break
+		}
+	}
+	if used > peak {
+		peak = used
+	}
+	return used, rss, peak
+}
+
+func (h *Handler) memoryInfo() []infoField {
+	used, rss, peak := h.memStats()
+	ratio := 0.0
+	if used > 0 {
+		ratio = float64(rss) / float64(used)
+	}
+	props := config.Get()
+	return []infoField{
+		{"used_memory", strconv.FormatUint(used, 10)},
+		{"used_memory_human", humanBytes(used)},
+		{"used_memory_rss", strconv.FormatUint(rss, 10)},
+		{"used_memory_rss_human", humanBytes(rss)},
+		{"used_memory_peak", strconv.FormatUint(peak, 10)},
+		{"used_memory_peak_human", humanBytes(peak)},
+		{"used_memory_dataset", itoa(eviction.Used())},
+		{"maxmemory", itoa(props.MaxMemory)},
+		{"maxmemory_human", humanBytes(uint64(props.MaxMemory))},
+		{"maxmemory_policy", props.MaxMemoryPolicy.String()},
+		{"lazyfree_pending_objects", itoa(lazyfree.Pending())},
+		{"mem_fragmentation_ratio", strconv.FormatFloat(ratio, 'f', 2, 64)},
+		{"mem_allocator", "go"},
+	}
+}
+
+// persistenceInfo reports aof_enabled from config, the rest are only known by db implementing database.PersistenceReporter
+func (h *Handler) persistenceInfo() []infoField {
+	aofEnabled := "0"
+	if config.Get().AppendOnly {
+		aofEnabled = "1"
+	}
+	reporter, ok := h.db.(database.PersistenceReporter)
+	if !ok {
+		return []infoField{{"aof_enabled", aofEnabled}}
+	}
+	stats := reporter.GetPersistenceStats()
+	lastSave := int64(0)
+	if !stats.RDBLastSaveTime.IsZero() {
+		lastSave = stats.RDBLastSaveTime.Unix()
+	}
+	return []infoField{
+		{"loading", boolInfo(stats.Loading)},
+		{"rdb_bgsave_in_progress", boolInfo(stats.RDBSaveInProgress)},
+		{"rdb_last_save_time", itoa(lastSave)},
+		{"aof_enabled", aofEnabled},
+		{"aof_rewrite_in_progress", boolInfo(stats.AOFRewriteInProgress)},
+	}
+}
+
+func boolInfo(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+func (h *Handler) statsInfo() []infoField {
+	var stats database.Stats
+	if reporter, ok := h.db.(database.StatsReporter); ok {
+		stats = reporter.GetStats()
+	}
+	h.pubsub.mu.RLock()
+	channels, patterns := len(h.pubsub.channels), len(h.pubsub.patterns)
+	h.pubsub.mu.RUnlock()
+	h.tracker.mu.Lock()
+	trackedKeys, prefixes := len(h.tracker.keys), len(h.tracker.prefixes)
+	h.tracker.mu.Unlock()
+	return []infoField{
+		{"total_connections_received", itoa(atomic.LoadInt64(&tcp.TotalConnections))},
+		{"total_commands_processed", itoa(atomic.LoadInt64(&h.commandsProcessed))},
+		{"rejected_connections", itoa(atomic.LoadInt64(&tcp.RejectedConnections))},
+		{"expired_keys", itoa(stats.ExpiredKeys)},
+		{"evicted_keys", itoa(eviction.EvictedKeys())},
+		{"lazyfreed_objects", itoa(lazyfree.Freed())},
+		{"keyspace_hits", itoa(stats.KeyspaceHits)},
+		{"keyspace_misses", itoa(stats.KeyspaceMisses)},
+		{"pubsub_channels", strconv.Itoa(channels)},
+		{"pubsub_patterns", strconv.Itoa(patterns)},
+		{"tracking_total_keys", strconv.Itoa(trackedKeys)},
+		{"tracking_total_prefixes", strconv.Itoa(prefixes)},
+	}
+}
+
+func (h *Handler) replicationInfo() []infoField {
+	return []infoField{
+		{"role", "master"},
+		{"connected_slaves", "0"},
+		{"master_replid", h.replID},
+		{"master_repl_offset", "0"},
+	}
+}
+
+// dbSizer is implemented by database.DBEngine
+type dbSizer interface {
+	GetDBSize(dbIndex int) (int, int)
+}
+
+func (h *Handler) keyspaceInfo() []infoField {
+	sizer, ok := h.db.(dbSizer)
+	if !ok {
+		return nil
+	}
+	var fields []infoField
+	for i := 0; i < config.Get().Databases; i++ {
+		keys, expires := sizer.GetDBSize(i)
+		if keys == 0 {
+			continue
+		}
+		fields = append(fields, infoField{
+			name:  "db" + strconv.Itoa(i),
+			value: "keys=" + strconv.Itoa(keys) + ",expires=" + strconv.Itoa(expires),
+		})
+	}
+	return fields
+}
+
+// Info returns the text of INFO, sections are names in lower case, empty means default sections
+func (h *Handler) Info(sections ...string) string {
+	defaults := len(sections) == 0
+	all := false
+	wanted := make(map[string]bool)
+	for _, name := range sections {
+		switch name {
+		case "all", "everything":
+			all = true
+		case "default":
+			defaults = true
+		}
+		wanted[name] = true
+	}
+	var buf strings.Builder
+	for _, section := range infoSections {
+		if !all && !wanted[section.name] && (!defaults || section.extra) {
+			continue
+		}
+		if buf.Len() > 0 {
+			buf.WriteString("\r\n")
+		}
+		buf.WriteString("# " + strings.ToUpper(section.name[:1]) + section.name[1:] + "\r\n")
+		for _, field := range section.fields(h) {
+			buf.WriteString(field.name + ":" + field.value + "\r\n")
+		}
+	}
+	return buf.String()
+}
+
+// execInfo handles INFO [section [section ...]]
+func execInfo(h *Handler, c redis.Connection, args [][]byte) redis.Reply {
+	sections := make([]string, len(args))
+	for i, arg := range args {
+		sections[i] = strings.ToLower(string(arg))
+	}
+	return protocol.MakeVerbatimReply("txt", []byte(h.Info(sections...)))
+}
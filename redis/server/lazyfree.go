@@ -0,0 +1,101 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/atomwqh/MyGodis/config"
+	"github.com/atomwqh/MyGodis/interface/database"
+	"github.com/atomwqh/MyGodis/interface/redis"
+	"github.com/atomwqh/MyGodis/redis/eviction"
+	"github.com/atomwqh/MyGodis/redis/lazyfree"
+	"github.com/atomwqh/MyGodis/redis/protocol"
+)
+
+// UNLINK 先通过 eviction.Keyspace 取出 value, 交给存储引擎按 DEL 删除 key 后, 由 lazyfree 在后台释放大的 value.
+// FLUSHDB ASYNC 和 FLUSHALL ASYNC 先摘下 db 的 dict 交给 lazyfree, 再把不带 ASYNC 的命令交给存储引擎清空已经为空的 db.
+// 这样 AOF 和 WATCH 仍由存储引擎处理, 命令的耗时与 key 的数量和 value 的大小无关
+
+func init() {
+	registerCommand("unlink", execUnlink)
+	registerCommand("flushdb", execFlushDB)
+	registerCommand("flushall", execFlushAll)
+}
+
+// execDB sends cmdLine to db like exec
+func (h *Handler) execDB(c redis.Connection, cmdLine [][]byte) redis.Reply {
+	if h.db == nil {
+		return protocol.MakeErrReply("ERR unknown command '" + strings.ToLower(string(cmdLine[0])) + "'")
+	}
+	return h.db.Exec(c, cmdLine)
+}
+
+// execUnlink handles UNLINK key [key ...]
+func execUnlink(h *Handler, c redis.Connection, args [][]byte) redis.Reply {
+	if len(args) == 0 {
+		return protocol.MakeErrReply("ERR wrong number of arguments for 'unlink' command")
+	}
+	cmdLine := append([][]byte{[]byte("DEL")}, args...)
+	ks, ok := h.db.(eviction.Keyspace)
+	if !ok {
+		return h.execDB(c, cmdLine)
+	}
+	dbIndex := c.GetDBIndex()
+	data, _ := ks.Dicts(dbIndex)
+	entities := make(map[string]*database.DataEntity, len(args))
+	for _, key := range args {
+		if val, exists := data.Get(string(key)); exists {
+			entities[string(key)] = val.(*database.DataEntity)
+		}
+	}
+	reply := h.execDB(c, cmdLine)
+	if _, deleted := reply.(*protocol.IntReply); !deleted {
+		return reply
+	}
+	for key, entity := range entities {
+		// the key may be set again by other clients after DEL
+		if val, exists := data.Get(key); exists && val == entity {
+			continue
+		}
+		// accounting is usually released by the deleted callback of engine already, Release is a no-op then
+		lazyfree.FreeEntity(dbIndex, entity)
+	}
+	return reply
+}
+
+// execFlushDB handles FLUSHDB [ASYNC|SYNC]
+func execFlushDB(h *Handler, c redis.Connection, args [][]byte) redis.Reply {
+	return h.flush(c, "FLUSHDB", args, func(ks eviction.Keyspace) {
+		dbIndex := c.GetDBIndex()
+		data, ttl := ks.Dicts(dbIndex)
+		lazyfree.FlushAsync(dbIndex, data, ttl)
+	})
+}
+
+// execFlushAll handles FLUSHALL [ASYNC|SYNC]
+func execFlushAll(h *Handler, c redis.Connection, args [][]byte) redis.Reply {
+	return h.flush(c, "FLUSHALL", args, func(ks eviction.Keyspace) {
+		for i := 0; i < config.Get().Databases; i++ {
+			data, ttl := ks.Dicts(i)
+			lazyfree.FlushAsync(i, data, ttl)
+		}
+	})
+}
+
+// flush detaches keys by detach if ASYNC is given and db supports it, then lets db flush
+func (h *Handler) flush(c redis.Connection, name string, args [][]byte, detach func(ks eviction.Keyspace)) redis.Reply {
+	if len(args) > 1 {
+		return protocol.MakeErrReply("ERR syntax error")
+	}
+	if len(args) == 1 {
+		switch strings.ToLower(string(args[0])) {
+		case "async":
+			if ks, ok := h.db.(eviction.Keyspace); ok {
+				detach(ks)
+			}
+		case "sync":
+		default:
+			return protocol.MakeErrReply("ERR syntax error")
+		}
+	}
+	return h.execDB(c, [][]byte{[]byte(name)})
+}
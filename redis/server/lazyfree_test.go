@@ -0,0 +1,65 @@
+package server
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/atomwqh/MyGodis/datastruct/set"
+	"github.com/atomwqh/MyGodis/interface/database"
+	"github.com/atomwqh/MyGodis/redis/lazyfree"
+)
+
+func TestLazyFree(t *testing.T) {
+	db := makeMemDB()
+	c := dial(t, serve(t, db))
+
+	// block the background goroutine, so that commands can only reply before values are freed
+	block := make(chan struct{})
+	lazyfree.Submit(0, func() {
+		<-block
+	})
+	released := false
+	release := func() {
+		if !released {
+			released = true
+			close(block)
+		}
+	}
+	defer release()
+	base := lazyfree.Pending()
+
+	big := set.Make()
+	for i := 0; i <= lazyfree.Threshold; i++ {
+		big.Add(strconv.Itoa(i))
+	}
+	db.data.Put("big", &database.DataEntity{Data: big})
+	c.expect("+OK", "SET", "a", "1")
+	c.expect("+OK", "SET", "b", "1")
+	c.expect(":2", "UNLINK", "a", "big", "c")
+	if n := lazyfree.Pending() - base; n != 1 {
+		t.Errorf("big value should be freed in background, pending %d", n)
+	}
+	c.expect("-ERR syntax error", "FLUSHDB", "LAZY")
+	c.expect("+OK", "FLUSHDB", "ASYNC")
+	if db.data.Len() != 0 {
+		t.Error("keys should be removed by FLUSHDB ASYNC")
+	}
+	if n := lazyfree.Pending() - base; n != 2 {
+		t.Errorf("flushed keys should be freed in background, pending %d", n)
+	}
+
+	release()
+	deadline := time.Now().Add(time.Second)
+	for lazyfree.Pending() != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if lazyfree.Pending() != 0 {
+		t.Error("background goroutine should free all values")
+	}
+	c.expect("+OK", "SET", "a", "1")
+	c.expect("+OK", "FLUSHALL", "SYNC")
+	if db.data.Len() != 0 {
+		t.Error("keys should be removed by FLUSHALL")
+	}
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"sync/atomic"
+
+	"github.com/atomwqh/MyGodis/config"
+	"github.com/atomwqh/MyGodis/interface/redis"
+	"github.com/atomwqh/MyGodis/redis/acl"
+	"github.com/atomwqh/MyGodis/redis/eviction"
+	"github.com/atomwqh/MyGodis/redis/protocol"
+)
+
+// 超过 maxmemory 时, 发给 db 的命令执行前先淘汰 key, 淘汰的 key 会通知 tracking 客户端.
+// 仍然无法释放足够内存时, 可能使用更多内存的写命令返回 OOM 错误, 读命令和删除类的命令照常执行
+
+// freeMemory evicts keys before cmdLine is executed, it returns error reply if cmdLine is rejected
+func (h *Handler) freeMemory(cmdLine [][]byte) redis.Reply {
+	if config.Get().MaxMemory <= 0 {
+		return nil
+	}
+	ks, ok := h.db.(eviction.Keyspace)
+	if !ok {
+		return nil
+	}
+	keys, err := eviction.FreeMemory(ks)
+	if len(keys) > 0 && atomic.LoadInt32(&h.tracker.count) > 0 {
+		h.sendInvalidations(h.tracker.invalidate(nil, keys))
+	}
+	if err != nil && acl.DenyOOM(cmdLine) {
+		return protocol.MakeErrReply(err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atomwqh/MyGodis/config"
+)
+
+// /metrics 以 Prometheus 文本格式导出 INFO 中的数值字段, 以及每个命令的调用次数和耗时直方图.
+// 指标名是 godis_ 加上 INFO 字段名, counter 类型去掉 total_ 前缀并加上 _total 后缀
+
+const (
+	gauge   = "gauge"
+	counter = "counter"
+)
+
+// metricTypes are INFO fields exported by /metrics.
+// 持久化的字段只有 db 实现了 database.PersistenceReporter 时才出现在 INFO 中, 所以导出的都是真实值.
+// 服务端没有实现主从复制, connected_slaves 和 master_repl_offset 恒为 0, 不导出, 也没有复制延迟可导出
+var metricTypes = map[string]string{
+	"uptime_in_seconds":          gauge,
+	"connected_clients":          gauge,
+	"maxclients":                 gauge,
+	"pubsub_clients":             gauge,
+	"tracking_clients":           gauge,
+	"used_memory":                gauge,
+	"used_memory_rss":            gauge,
+	"used_memory_peak":           gauge,
+	"used_memory_dataset":        gauge,
+	"maxmemory":                  gauge,
+	"lazyfree_pending_objects":   gauge,
+	"mem_fragmentation_ratio":    gauge,
+	"loading":                    gauge,
+	"rdb_bgsave_in_progress":     gauge,
+	"rdb_last_save_time":         gauge,
+	"aof_enabled":                gauge,
+	"aof_rewrite_in_progress":    gauge,
+	"total_connections_received": counter,
+	"total_commands_processed":   counter,
+	"rejected_connections":       counter,
+	"expired_keys":               counter,
+	"evicted_keys":               counter,
+	"lazyfreed_objects":          counter,
+	"keyspace_hits":              counter,
+	"keyspace_misses":            counter,
+	"pubsub_channels":            gauge,
+	"pubsub_patterns":            gauge,
+	"tracking_total_keys":        gauge,
+	"tracking_total_prefixes":    gauge,
+}
+
+// metricName converts INFO field to metric name
+func metricName(field string, typ string) string {
+	if typ == counter {
+		return "godis_" + strings.TrimPrefix(field, "total_") + "_total"
+	}
+	return "godis_" + field
+}
+
+func writeType(buf *strings.Builder, name string, typ string) {
+	buf.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'g', -1, 64)
+}
+
+// Metrics returns metrics in Prometheus text format
+func (h *Handler) Metrics() string {
+	var buf strings.Builder
+	for _, section := range infoSections {
+		if section.extra {
+			continue
+		}
+		for _, field := range section.fields(h) {
+			typ, ok := metricTypes[field.name]
+			if !ok {
+				continue
+			}
+			name := metricName(field.name, typ)
+			writeType(&buf, name, typ)
+			buf.WriteString(name + " " + field.value + "\n")
+		}
+	}
+
+	if sizer, ok := h.db.(dbSizer); ok {
+		var keys, expires strings.Builder
+		for i := 0; i < config.Get().Databases; i++ {
+			n, expiring := sizer.GetDBSize(i)
+			label := "{db=\"" + strconv.Itoa(i) + "\"} "
+			keys.WriteString("godis_db_keys" + label + strconv.Itoa(n) + "\n")
+			expires.WriteString("godis_db_keys_expiring" + label + strconv.Itoa(expiring) + "\n")
+		}
+		writeType(&buf, "godis_db_keys", gauge)
+		buf.WriteString(keys.String())
+		writeType(&buf, "godis_db_keys_expiring", gauge)
+		buf.WriteString(expires.String())
+	}
+
+	stats := h.cmdStats.snapshot()
+	writeType(&buf, "godis_command_calls_total", counter)
+	for _, stat := range stats {
+		buf.WriteString("godis_command_calls_total{cmd=\"" + stat.name + "\"} " + itoa(stat.calls) + "\n")
+	}
+	writeType(&buf, "godis_command_failed_calls_total", counter)
+	for _, stat := range stats {
+		buf.WriteString("godis_command_failed_calls_total{cmd=\"" + stat.name + "\"} " + itoa(stat.failed) + "\n")
+	}
+	writeType(&buf, "godis_command_duration_seconds", "histogram")
+	for _, stat := range stats {
+		label := "cmd=\"" + stat.name + "\""
+		var cumulative int64
+		for i, bound := range latencyBuckets {
+			cumulative += stat.buckets[i]
+			buf.WriteString("godis_command_duration_seconds_bucket{" + label + ",le=\"" + seconds(bound) + "\"} " +
+				itoa(cumulative) + "\n")
+		}
+		// calls may change while buckets are loaded, count by buckets to keep histogram consistent
+		cumulative += stat.buckets[len(latencyBuckets)]
+		buf.WriteString("godis_command_duration_seconds_bucket{" + label + ",le=\"+Inf\"} " + itoa(cumulative) + "\n")
+		buf.WriteString("godis_command_duration_seconds_sum{" + label + "} " +
+			seconds(time.Duration(stat.usec)*time.Microsecond) + "\n")
+		buf.WriteString("godis_command_duration_seconds_count{" + label + "} " + itoa(cumulative) + "\n")
+	}
+	return buf.String()
+}
+
+// ServeMetrics is the http handler of /metrics
+func (h *Handler) ServeMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = w.Write([]byte(h.Metrics()))
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/atomwqh/MyGodis/interface/database"
+)
+
+func TestMetrics(t *testing.T) {
+	db := makeMemDB()
+	db.data.Put("a", &database.DataEntity{Data: []byte("1")})
+	h := MakeHandler(db)
+	h.cmdStats.record([][]byte{[]byte("GET"), []byte("a")}, 0, false)
+	h.cmdStats.record([][]byte{[]byte("nosuchcmd")}, 0, true)
+
+	recorder := httptest.NewRecorder()
+	h.ServeMetrics(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body := recorder.Body.String()
+	for _, line := range []string{
+		"# TYPE godis_connected_clients gauge\n",
+		"# TYPE godis_commands_processed_total counter\n",
+		"godis_keyspace_hits_total 0\n",
+		"godis_db_keys{db=\"0\"} 1\n",
+		"godis_command_calls_total{cmd=\"get\"} 1\n",
+		"godis_command_duration_seconds_bucket{cmd=\"get\",le=\"1e-05\"} 1\n",
+		"godis_command_duration_seconds_count{cmd=\"get\"} 1\n",
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("metrics should contain %q", line)
+		}
+	}
+	if strings.Contains(body, "nosuchcmd") {
+		t.Error("unknown commands should not be counted")
+	}
+	for _, name := range []string{"godis_connected_slaves", "godis_master_repl_offset", "godis_rdb_last_save_time"} {
+		if strings.Contains(body, name) {
+			t.Errorf("metrics should not export %s which server doesn't know", name)
+		}
+	}
+}
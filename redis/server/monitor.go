@@ -0,0 +1,134 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/atomwqh/MyGodis/interface/redis"
+	"github.com/atomwqh/MyGodis/redis/connection"
+	"github.com/atomwqh/MyGodis/redis/protocol"
+)
+
+// MONITOR: 执行的命令格式化后通过 Connection.Push 追加到每个 monitor 的输出缓冲, 由连接的推送 goroutine 发送,
+// 执行命令的 goroutine 不会等待网络. 跟不上的 monitor 会因为 client-output-buffer-limit 被断开
+
+func init() {
+	registerCommand("monitor", execMonitor)
+}
+
+type monitorHub struct {
+	count    int32 // number of monitors, commands skip feeding without lock if it is 0
+	mu       sync.RWMutex
+	monitors map[*connection.Connection]struct{}
+}
+
+func makeMonitorHub() *monitorHub {
+	return &monitorHub{monitors: make(map[*connection.Connection]struct{})}
+}
+
+func (hub *monitorHub) add(client *connection.Connection) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if _, ok := hub.monitors[client]; ok {
+		return
+	}
+	hub.monitors[client] = struct{}{}
+	atomic.AddInt32(&hub.count, 1)
+	client.SetMonitor()
+}
+
+func (hub *monitorHub) remove(client *connection.Connection) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if _, ok := hub.monitors[client]; !ok {
+		return
+	}
+	delete(hub.monitors, client)
+	atomic.AddInt32(&hub.count, -1)
+}
+
+// feed sends command executed by client to monitors
+func (hub *monitorHub) feed(client *connection.Connection, dbIndex int, cmdLine [][]byte) {
+	if atomic.LoadInt32(&hub.count) == 0 {
+		return
+	}
+	line := []byte(formatMonitorLine(time.Now(), dbIndex, client, redactArgs(cmdLine)))
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	for c := range hub.monitors {
+		if c == client {
+			continue
+		}
+		// error means closed for output buffer limit, it will be removed by closeClient
+		_ = c.Push(line)
+	}
+}
+
+// formatMonitorLine formats a command like +1339518083.107412 [0 127.0.0.1:60866] "keys" "*"
+func formatMonitorLine(now time.Time, dbIndex int, client *connection.Connection, args [][]byte) string {
+	addr := client.RemoteAddr()
+	if addr == "" {
+		addr = "unix:" + client.LocalAddr()
+	}
+	var buf strings.Builder
+	buf.WriteByte('+')
+	buf.WriteString(strconv.FormatInt(now.Unix(), 10))
+	buf.WriteByte('.')
+	usec := strconv.Itoa(now.Nanosecond() / 1000)
+	buf.WriteString(strings.Repeat("0", 6-len(usec)) + usec)
+	buf.WriteString(" [" + strconv.Itoa(dbIndex) + " " + addr + "]")
+	for _, arg := range args {
+		buf.WriteByte(' ')
+		buf.WriteString(quoteArg(arg))
+	}
+	buf.WriteString("\r\n")
+	return buf.String()
+}
+
+// quoteArg quotes arg like sdscatrepr of redis
+func quoteArg(arg []byte) string {
+	var buf strings.Builder
+	buf.WriteByte('"')
+	for _, b := range arg {
+		switch b {
+		case '\\', '"':
+			buf.WriteByte('\\')
+			buf.WriteByte(b)
+		case '\n':
+			buf.WriteString("\\n")
+		case '\r':
+			buf.WriteString("\\r")
+		case '\t':
+			buf.WriteString("\\t")
+		case '\a':
+			buf.WriteString("\\a")
+		case '\b':
+			buf.WriteString("\\b")
+		default:
+			if b < ' ' || b > '~' {
+				buf.WriteString("\\x")
+				buf.WriteString(strconv.FormatUint(uint64(b)>>4, 16))
+				buf.WriteString(strconv.FormatUint(uint64(b)&0xf, 16))
+			} else {
+				buf.WriteByte(b)
+			}
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// execMonitor handles MONITOR
+func execMonitor(h *Handler, c redis.Connection, args [][]byte) redis.Reply {
+	if len(args) != 0 {
+		return protocol.MakeErrReply("ERR wrong number of arguments for 'monitor' command")
+	}
+	client := c.(*connection.Connection)
+	// send OK before any command fed
+	_ = client.Buffer(protocol.MakeOkReply().ToBytes())
+	h.monitors.add(client)
+	return protocol.MakeNoReply()
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestMonitor(t *testing.T) {
+	addr := startServerWithDB(t)
+	m := dial(t, addr)
+	m.expect("+OK", "MONITOR")
+
+	c := dial(t, addr)
+	c.expect("+OK", "SET", "a", "b \"c\"\n")
+	c.expect("-ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?", "AUTH", "secret")
+	pattern := regexp.MustCompile(`^\+\d+\.\d{6} \[0 127\.0\.0\.1:\d+\] "SET" "a" "b \\"c\\"\\n"$`)
+	if line, _ := m.readLine(); !pattern.MatchString(line) {
+		t.Errorf("unexpected monitor line %q", line)
+	}
+	if line, _ := m.readLine(); !regexp.MustCompile(`"AUTH" "\(redacted\)"$`).MatchString(line) {
+		t.Errorf("password should be redacted, actual %q", line)
+	}
+	c.send("CLIENT", "LIST", "TYPE", "normal")
+	if list := c.readBulk(); !regexp.MustCompile(`flags=O `).MatchString(list) {
+		t.Errorf("monitor should be listed with flag O, actual %q", list)
+	}
+}
+
+func TestQuoteArg(t *testing.T) {
+	if s := quoteArg([]byte("a\x00\xff\t\\")); s != `"a\x00\xff\t\\"` {
+		t.Errorf("unexpected quoted arg %s", s)
+	}
+}
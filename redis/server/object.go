@@ -0,0 +1,152 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/atomwqh/MyGodis/config"
+	"github.com/atomwqh/MyGodis/interface/database"
+	"github.com/atomwqh/MyGodis/interface/redis"
+	"github.com/atomwqh/MyGodis/redis/eviction"
+	"github.com/atomwqh/MyGodis/redis/protocol"
+)
+
+// OBJECT 和 MEMORY USAGE 查看 key 的编码, 访问信息和估算的内存, 用于在线上排查热 key 和大 key.
+// 它们只读取 DataEntity, 不会更新 key 的访问信息
+
+func init() {
+	registerCommand("object", execObject)
+	registerCommand("memory", execMemory)
+}
+
+// entityGetter is implemented by database.DBEngine
+type entityGetter interface {
+	GetEntity(dbIndex int, key string) (*database.DataEntity, bool)
+}
+
+// getEntity returns entity of key in the db selected by c, it returns nil if key doesn't exist
+func (h *Handler) getEntity(c redis.Connection, key []byte) *database.DataEntity {
+	getter, ok := h.db.(entityGetter)
+	if !ok {
+		return nil
+	}
+	entity, ok := getter.GetEntity(c.GetDBIndex(), string(key))
+	if !ok {
+		return nil
+	}
+	return entity
+}
+
+func helpReply(lines ...string) redis.Reply {
+	replies := make([]redis.Reply, len(lines))
+	for i, line := range lines {
+		replies[i] = protocol.MakeStatusReply(line)
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+func isLFU(policy config.EvictionPolicy) bool {
+	return policy == config.AllKeysLFU || policy == config.VolatileLFU
+}
+
+// execObject handles OBJECT ENCODING|IDLETIME|FREQ|REFCOUNT key and OBJECT HELP
+func execObject(h *Handler, c redis.Connection, args [][]byte) redis.Reply {
+	if len(args) == 0 {
+		return protocol.MakeErrReply("ERR wrong number of arguments for 'object' command")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	if subCmd == "help" {
+		return helpReply(
+			"OBJECT <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"ENCODING <key>",
+			"    Return the kind of internal representation used in order to store the value",
+			"    associated with a <key>.",
+			"FREQ <key>",
+			"    Return the access frequency index of the <key>. The returned integer is",
+			"    proportional to the logarithm of the recent access frequency of the key.",
+			"IDLETIME <key>",
+			"    Return the idle time of the <key>, that is the approximated number of",
+			"    seconds elapsed since the last access to the key.",
+			"REFCOUNT <key>",
+			"    Return the number of references of the value associated with the specified",
+			"    <key>.",
+			"HELP",
+			"    Print this help.",
+		)
+	}
+	switch subCmd {
+	case "encoding", "idletime", "freq", "refcount":
+	default:
+		return protocol.MakeErrReply("ERR unknown subcommand '" + subCmd + "'. Try OBJECT HELP.")
+	}
+	if len(args) != 2 {
+		return protocol.MakeErrReply("ERR wrong number of arguments for 'object|" + subCmd + "' command")
+	}
+	entity := h.getEntity(c, args[1])
+	if entity == nil {
+		return protocol.MakeNullBulkReply()
+	}
+	policy := config.Get().MaxMemoryPolicy
+	switch subCmd {
+	case "encoding":
+		return protocol.MakeBulkReply([]byte(entity.Encoding()))
+	case "idletime":
+		if isLFU(policy) {
+			return protocol.MakeErrReply("ERR An LFU maxmemory policy is selected, idle time not tracked. " +
+				"Please note that when switching between policies at runtime LRU and LFU data will take some time to adjust.")
+		}
+		return protocol.MakeIntReply(int64(entity.Idle().Seconds()))
+	case "freq":
+		if !isLFU(policy) {
+			return protocol.MakeErrReply("ERR An LFU maxmemory policy is not selected, access frequency not tracked. " +
+				"Please note that when switching between policies at runtime LRU and LFU data will take some time to adjust.")
+		}
+		return protocol.MakeIntReply(int64(entity.Freq()))
+	default:
+		// values are never shared between keys
+		return protocol.MakeIntReply(1)
+	}
+}
+
+// defaultMemorySamples is the number of elements sampled by MEMORY USAGE like redis
+const defaultMemorySamples = 5
+
+// execMemory handles MEMORY USAGE key [SAMPLES count] and MEMORY HELP
+func execMemory(h *Handler, c redis.Connection, args [][]byte) redis.Reply {
+	if len(args) == 0 {
+		return protocol.MakeErrReply("ERR wrong number of arguments for 'memory' command")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	switch subCmd {
+	case "help":
+		return helpReply(
+			"MEMORY <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"USAGE <key> [SAMPLES <count>]",
+			"    Return memory in bytes used by <key> and its value. Nested values are",
+			"    sampled up to <count> times (default: 5, 0 means sample all).",
+			"HELP",
+			"    Print this help.",
+		)
+	case "usage":
+		if len(args) != 2 && len(args) != 4 {
+			return protocol.MakeErrReply("ERR wrong number of arguments for 'memory|usage' command")
+		}
+		samples := defaultMemorySamples
+		if len(args) == 4 {
+			if !strings.EqualFold(string(args[2]), "samples") {
+				return protocol.MakeErrReply("ERR syntax error")
+			}
+			n, err := strconv.Atoi(string(args[3]))
+			if err != nil || n < 0 {
+				return protocol.MakeErrReply("ERR value is out of range, must be positive")
+			}
+			samples = n
+		}
+		entity := h.getEntity(c, args[1])
+		if entity == nil {
+			return protocol.MakeNullBulkReply()
+		}
+		return protocol.MakeIntReply(eviction.EntitySize(string(args[1]), entity, samples))
+	}
+	return protocol.MakeErrReply("ERR unknown subcommand '" + subCmd + "'. Try MEMORY HELP.")
+}
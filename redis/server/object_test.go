@@ -0,0 +1,38 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/atomwqh/MyGodis/config"
+)
+
+func TestObject(t *testing.T) {
+	c := dial(t, startServerWithDB(t))
+	c.expect("+OK", "SET", "a", "12345")
+	c.expect("+OK", "SET", "b", "a string longer than forty four bytes, so it is raw")
+	c.expect("$3", "OBJECT", "ENCODING", "a")
+	c.expectLine("int")
+	c.expect("$3", "OBJECT", "ENCODING", "b")
+	c.expectLine("raw")
+	c.expect("$-1", "OBJECT", "ENCODING", "nosuchkey")
+	c.expect(":0", "OBJECT", "IDLETIME", "a")
+	c.expect(":1", "OBJECT", "REFCOUNT", "a")
+	c.expect("-ERR An LFU maxmemory policy is not selected, access frequency not tracked. "+
+		"Please note that when switching between policies at runtime LRU and LFU data will take some time to adjust.",
+		"OBJECT", "FREQ", "a")
+	c.expect("-ERR unknown subcommand 'nosuchcmd'. Try OBJECT HELP.", "OBJECT", "nosuchcmd", "a")
+
+	config.Update(func(props *config.ServerProperties) {
+		props.MaxMemoryPolicy = config.AllKeysLFU
+	})
+	defer config.Update(func(props *config.ServerProperties) {
+		props.MaxMemoryPolicy = config.NoEviction
+	})
+	c.expect(":5", "OBJECT", "FREQ", "a")
+
+	// key overhead 64 + key 1 + value 5
+	c.expect(":70", "MEMORY", "USAGE", "a")
+	c.expect(":70", "MEMORY", "USAGE", "a", "SAMPLES", "0")
+	c.expect("-ERR value is out of range, must be positive", "MEMORY", "USAGE", "a", "SAMPLES", "-1")
+	c.expect("$-1", "MEMORY", "USAGE", "nosuchkey")
+}
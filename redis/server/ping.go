@@ -0,0 +1,31 @@
+package server
+
+import (
+	"github.com/atomwqh/MyGodis/interface/redis"
+	"github.com/atomwqh/MyGodis/redis/connection"
+	"github.com/atomwqh/MyGodis/redis/protocol"
+)
+
+var pongReply = protocol.MakeStatusReply("PONG")
+
+func init() {
+	registerCommand("ping", execPing)
+}
+
+// execPing handles PING [message], clients use it as health check
+func execPing(h *Handler, c redis.Connection, args [][]byte) redis.Reply {
+	if len(args) <= 1 && c.GetProtocol() < protocol.RESP3 && h.pubsub.count(c.(*connection.Connection)) > 0 {
+		// subscribed RESP2 client can't tell replies from messages, so PING replies like a message
+		msg := []byte{}
+		if len(args) == 1 {
+			msg = args[0]
+		}
+		return protocol.MakeMultiBulkReply([][]byte{[]byte("pong"), msg})
+	}
+	if len(args) == 0 {
+		return pongReply
+	} else if len(args) == 1 {
+		return protocol.MakeBulkReply(args[0])
+	}
+	return protocol.MakeErrReply("ERR wrong number of arguments for 'ping' command")
+}
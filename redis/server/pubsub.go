@@ -0,0 +1,321 @@
+package server
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/atomwqh/MyGodis/config"
+	"github.com/atomwqh/MyGodis/interface/redis"
+	"github.com/atomwqh/MyGodis/lib/wildcard"
+	"github.com/atomwqh/MyGodis/redis/connection"
+	"github.com/atomwqh/MyGodis/redis/protocol"
+)
+
+// 发布订阅: 订阅关系保存在 pubsubHub 中, 消息由执行 PUBLISH 的协程通过 Connection.Push 发给订阅者.
+// RESP2 的连接订阅后只能执行订阅相关的命令, RESP3 的连接收到的是 push 类型, 可以继续执行普通命令
+
+func init() {
+	registerCommand("subscribe", execSubscribe)
+	registerCommand("unsubscribe", execUnsubscribe)
+	registerCommand("psubscribe", execPSubscribe)
+	registerCommand("punsubscribe", execPUnsubscribe)
+	registerCommand("publish", execPublish)
+	registerCommand("pubsub", execPubSub)
+}
+
+// subscriptions of a client
+type subscriptions struct {
+	channels map[string]struct{}
+	patterns map[string]struct{}
+}
+
+func (s *subscriptions) count() int {
+	return len(s.channels) + len(s.patterns)
+}
+
+type pubsubHub struct {
+	mu       sync.RWMutex
+	channels map[string]map[*connection.Connection]struct{}
+	patterns map[string]map[*connection.Connection]struct{}
+	clients  map[*connection.Connection]*subscriptions
+}
+
+func makePubsubHub() *pubsubHub {
+	return &pubsubHub{
+		channels: make(map[string]map[*connection.Connection]struct{}),
+		patterns: make(map[string]map[*connection.Connection]struct{}),
+		clients:  make(map[*connection.Connection]*subscriptions),
+	}
+}
+
+// table returns the subscribers table of channels or patterns, it must be called with mu held
+func (hub *pubsubHub) table(pattern bool) map[string]map[*connection.Connection]struct{} {
+	if pattern {
+		return hub.patterns
+	}
+	return hub.channels
+}
+
+// subscribe adds a subscription and returns the number of subscriptions of client
+func (hub *pubsubHub) subscribe(client *connection.Connection, name string, pattern bool) int {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	subs := hub.clients[client]
+	if subs == nil {
+		subs = &subscriptions{channels: make(map[string]struct{}), patterns: make(map[string]struct{})}
+		hub.clients[client] = subs
+		client.SetClass(config.ClassPubSub)
+	}
+	own := subs.channels
+	if pattern {
+		own = subs.patterns
+	}
+	own[name] = struct{}{}
+	table := hub.table(pattern)
+	if table[name] == nil {
+		table[name] = make(map[*connection.Connection]struct{})
+	}
+	table[name][client] = struct{}{}
+	return subs.count()
+}
+
+// unsubscribe removes a subscription and returns the number of subscriptions left
+func (hub *pubsubHub) unsubscribe(client *connection.Connection, name string, pattern bool) int {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	subs := hub.clients[client]
+	if subs == nil {
+		return 0
+	}
+	hub.removeLocked(client, subs, name, pattern)
+	return subs.count()
+}
+
+func (hub *pubsubHub) removeLocked(client *connection.Connection, subs *subscriptions, name string, pattern bool) {
+	own := subs.channels
+	if pattern {
+		own = subs.patterns
+	}
+	delete(own, name)
+	table := hub.table(pattern)
+	delete(table[name], client)
+	if len(table[name]) == 0 {
+		delete(table, name)
+	}
+	if subs.count() == 0 {
+		delete(hub.clients, client)
+		client.SetClass(config.ClassNormal)
+	}
+}
+
+// subscribed returns channels or patterns subscribed by client, sorted by name
+func (hub *pubsubHub) subscribed(client *connection.Connection, pattern bool) []string {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	subs := hub.clients[client]
+	if subs == nil {
+		return nil
+	}
+	own := subs.channels
+	if pattern {
+		own = subs.patterns
+	}
+	names := make([]string, 0, len(own))
+	for name := range own {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// count returns the number of subscriptions of client
+func (hub *pubsubHub) count(client *connection.Connection) int {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	if subs := hub.clients[client]; subs != nil {
+		return subs.count()
+	}
+	return 0
+}
+
+// isSubscribed returns whether client subscribes channel exactly
+func (hub *pubsubHub) isSubscribed(client *connection.Connection, channel string) bool {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	_, ok := hub.channels[channel][client]
+	return ok
+}
+
+// removeClient removes all subscriptions of a closed client
+func (hub *pubsubHub) removeClient(client *connection.Connection) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	subs := hub.clients[client]
+	if subs == nil {
+		return
+	}
+	for name := range subs.channels {
+		hub.removeLocked(client, subs, name, false)
+	}
+	for name := range subs.patterns {
+		hub.removeLocked(client, subs, name, true)
+	}
+}
+
+// publish sends message to subscribers and returns the number of receivers
+func (hub *pubsubHub) publish(channel string, message []byte) int {
+	type delivery struct {
+		client *connection.Connection
+		msg    []redis.Reply
+	}
+	var deliveries []delivery
+	hub.mu.RLock()
+	for client := range hub.channels[channel] {
+		deliveries = append(deliveries, delivery{client, []redis.Reply{
+			protocol.MakeBulkReply([]byte("message")),
+			protocol.MakeBulkReply([]byte(channel)),
+			protocol.MakeBulkReply(message),
+		}})
+	}
+	for pattern, clients := range hub.patterns {
+		if !wildcard.Match(pattern, channel) {
+			continue
+		}
+		for client := range clients {
+			deliveries = append(deliveries, delivery{client, []redis.Reply{
+				protocol.MakeBulkReply([]byte("pmessage")),
+				protocol.MakeBulkReply([]byte(pattern)),
+				protocol.MakeBulkReply([]byte(channel)),
+				protocol.MakeBulkReply(message),
+			}})
+		}
+	}
+	hub.mu.RUnlock()
+	// send messages without lock, subscribers may be slow
+	for _, d := range deliveries {
+		_ = d.client.Push(protocol.Marshal(protocol.MakePushReply(d.msg), d.client.GetProtocol()))
+	}
+	return len(deliveries)
+}
+
+// pubsubAllowed are commands allowed after a RESP2 client subscribed
+var pubsubAllowed = map[string]struct{}{
+	"subscribe": {}, "unsubscribe": {}, "psubscribe": {}, "punsubscribe": {}, "ping": {}, "quit": {}, "reset": {},
+}
+
+// confirm sends the reply of (P)SUBSCRIBE or (P)UNSUBSCRIBE for a channel, channel is nil if there is none
+func confirm(client *connection.Connection, kind string, channel []byte, count int) {
+	var name redis.Reply = protocol.MakeNullBulkReply()
+	if channel != nil {
+		name = protocol.MakeBulkReply(channel)
+	}
+	reply := protocol.MakePushReply([]redis.Reply{
+		protocol.MakeBulkReply([]byte(kind)),
+		name,
+		protocol.MakeIntReply(int64(count)),
+	})
+	_ = client.Buffer(protocol.Marshal(reply, client.GetProtocol()))
+}
+
+func subscribe(h *Handler, c redis.Connection, args [][]byte, pattern bool) redis.Reply {
+	kind := "subscribe"
+	if pattern {
+		kind = "psubscribe"
+	}
+	if len(args) == 0 {
+		return protocol.MakeErrReply("ERR wrong number of arguments for '" + kind + "' command")
+	}
+	client := c.(*connection.Connection)
+	for _, name := range args {
+		confirm(client, kind, name, h.pubsub.subscribe(client, string(name), pattern))
+	}
+	return protocol.MakeNoReply()
+}
+
+func unsubscribe(h *Handler, c redis.Connection, args [][]byte, pattern bool) redis.Reply {
+	kind := "unsubscribe"
+	if pattern {
+		kind = "punsubscribe"
+	}
+	client := c.(*connection.Connection)
+	if len(args) == 0 {
+		// unsubscribe all
+		for _, name := range h.pubsub.subscribed(client, pattern) {
+			args = append(args, []byte(name))
+		}
+		if len(args) == 0 {
+			confirm(client, kind, nil, h.pubsub.count(client))
+			return protocol.MakeNoReply()
+		}
+	}
+	for _, name := range args {
+		confirm(client, kind, name, h.pubsub.unsubscribe(client, string(name), pattern))
+	}
+	return protocol.MakeNoReply()
+}
+
+// execSubscribe handles SUBSCRIBE channel [channel ...]
+func execSubscribe(h *Handler, c redis.Connection, args [][]byte) redis.Reply {
+	return subscribe(h, c, args, false)
+}
+
+// execUnsubscribe handles UNSUBSCRIBE [channel [channel ...]]
+func execUnsubscribe(h *Handler, c redis.Connection, args [][]byte) redis.Reply {
+	return unsubscribe(h, c, args, false)
+}
+
+// execPSubscribe handles PSUBSCRIBE pattern [pattern ...]
+func execPSubscribe(h *Handler, c redis.Connection, args [][]byte) redis.Reply {
+	return subscribe(h, c, args, true)
+}
+
+// execPUnsubscribe handles PUNSUBSCRIBE [pattern [pattern ...]]
+func execPUnsubscribe(h *Handler, c redis.Connection, args [][]byte) redis.Reply {
+	return unsubscribe(h, c, args, true)
+}
+
+// execPublish handles PUBLISH channel message
+func execPublish(h *Handler, c redis.Connection, args [][]byte) redis.Reply {
+	if len(args) != 2 {
+		return protocol.MakeErrReply("ERR wrong number of arguments for 'publish' command")
+	}
+	return protocol.MakeIntReply(int64(h.pubsub.publish(string(args[0]), args[1])))
+}
+
+// execPubSub handles PUBSUB CHANNELS [pattern], PUBSUB NUMSUB [channel ...] and PUBSUB NUMPAT
+func execPubSub(h *Handler, c redis.Connection, args [][]byte) redis.Reply {
+	if len(args) == 0 {
+		return protocol.MakeErrReply("ERR wrong number of arguments for 'pubsub' command")
+	}
+	hub := h.pubsub
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	switch strings.ToLower(string(args[0])) {
+	case "channels":
+		if len(args) > 2 {
+			return protocol.MakeErrReply("ERR wrong number of arguments for 'pubsub|channels' command")
+		}
+		var channels []string
+		for channel := range hub.channels {
+			if len(args) == 1 || wildcard.Match(string(args[1]), channel) {
+				channels = append(channels, channel)
+			}
+		}
+		sort.Strings(channels)
+		return bulkStrings(channels)
+	case "numsub":
+		replies := make([]redis.Reply, 0, 2*(len(args)-1))
+		for _, channel := range args[1:] {
+			replies = append(replies, protocol.MakeBulkReply(channel),
+				protocol.MakeIntReply(int64(len(hub.channels[string(channel)]))))
+		}
+		return protocol.MakeMultiRawReply(replies)
+	case "numpat":
+		if len(args) != 1 {
+			return protocol.MakeErrReply("ERR wrong number of arguments for 'pubsub|numpat' command")
+		}
+		return protocol.MakeIntReply(int64(len(hub.patterns)))
+	}
+	return protocol.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try PUBSUB HELP.")
+}
@@ -0,0 +1,14 @@
+package server
+
+import "github.com/atomwqh/MyGodis/interface/redis"
+
+// ExecFunc is interface for connection level command executor
+// args don't include cmd line
+type ExecFunc func(h *Handler, c redis.Connection, args [][]byte) redis.Reply
+
+var cmdTable = make(map[string]ExecFunc)
+
+// registerCommand registers a connection level command, name is lower case
+func registerCommand(name string, executor ExecFunc) {
+	cmdTable[name] = executor
+}
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atomwqh/MyGodis/config"
+	"github.com/atomwqh/MyGodis/interface/database"
+	"github.com/atomwqh/MyGodis/interface/redis"
+	"github.com/atomwqh/MyGodis/lib/logger"
+	"github.com/atomwqh/MyGodis/lib/sync/atomic"
+	"github.com/atomwqh/MyGodis/redis/acl"
+	"github.com/atomwqh/MyGodis/redis/connection"
+	"github.com/atomwqh/MyGodis/redis/parser"
+	"github.com/atomwqh/MyGodis/redis/protocol"
+)
+
+/*
+ * A tcp.Handler implements redis protocol
+ */
+
+var unknownErrReplyBytes = []byte("-ERR unknown\r\n")
+
+// Handler implements tcp.Handler and serves as a redis server
+type Handler struct {
+	// counters are accessed by sync/atomic, they are placed first to be 64-bit aligned
+	commandsProcessed int64
+	memPeak           uint64
+
+	activeConn  sync.Map // *connection.Connection -> placeholder
+	clientsByID sync.Map // id -> *connection.Connection
+	db          database.DB
+	closing     atomic.Boolean // refusing new client and new request
+
+	pause    pauseState // set by CLIENT PAUSE
+	pubsub   *pubsubHub
+	tracker  *tracker
+	cmdStats *commandStats
+	slowLog  *slowLog
+	monitors *monitorHub
+	hotKeys  *hotKeys
+
+	startTime time.Time
+	runID     string // reported by INFO, changed every time server starts
+	replID    string
+}
+
+// MakeHandler creates a Handler instance, commands which are not handled by server are sent to db
+func MakeHandler(db database.DB) *Handler {
+	return &Handler{
+		db:       db,
+		pubsub:   makePubsubHub(),
+		tracker:  makeTracker(),
+		cmdStats: makeCommandStats(),
+		slowLog:  &slowLog{},
+		monitors: makeMonitorHub(),
+		hotKeys:  &hotKeys{},
+
+		startTime: time.Now(),
+		runID:     randomID(),
+		replID:    randomID(),
+	}
+}
+
+func (h *Handler) addClient(client *connection.Connection) {
+	client.SetUser(acl.AutoLogin())
+	h.activeConn.Store(client, struct{}{})
+	h.clientsByID.Store(client.ID(), client)
+}
+
+func (h *Handler) closeClient(client *connection.Connection) {
+	_ = client.Close()
+	if h.db != nil {
+		h.db.AfterClientClose(client)
+	}
+	h.pubsub.removeClient(client)
+	h.tracker.disable(client)
+	h.monitors.remove(client)
+	h.activeConn.Delete(client)
+	h.clientsByID.Delete(client.ID())
+}
+
+// Handle receives and executes redis commands
+func (h *Handler) Handle(ctx context.Context, conn net.Conn) {
+	if h.closing.Get() {
+		// closing handler refuse new connection
+		_ = conn.Close()
+		return
+	}
+
+	client := connection.NewConn(conn)
+	h.addClient(client)
+
+	// limits changed by CONFIG SET take effect on new connections
+	reader := parser.NewReaderWithLimits(conn, config.Get().ProtoLimits())
+	for {
+		reply, err := reader.Next()
+		if err != nil {
+			var protoErr *parser.ProtocolError
+			if errors.As(err, &protoErr) {
+				h.replyProtocolError(client, protoErr)
+			} else if errors.Is(err, os.ErrDeadlineExceeded) {
+				logger.Info("closing idle client " + client.RemoteAddr())
+			} else if err != io.EOF && err != io.ErrUnexpectedEOF &&
+				!strings.Contains(err.Error(), "use of closed network connection") {
+				logger.Warn(err)
+			}
+			// connection closed or broken
+			h.closeClient(client)
+			logger.Info("connection closed: " + client.RemoteAddr())
+			return
+		}
+		if r, ok := reply.(*protocol.MultiBulkReply); ok && len(r.Args) > 0 {
+			h.waitPause(client, r.Args)
+		}
+		if h.handleRequest(client, reply, reader.Buffered()) {
+			reader.Release()
+		}
+		if reader.Buffered() == 0 {
+			// all pipelined commands read have been executed, send replies in one write
+			if err = client.Flush(); err != nil {
+				h.closeClient(client)
+				logger.Info("connection closed: " + client.RemoteAddr())
+				return
+			}
+		}
+	}
+}
+
+// replyProtocolError sends protocol error to client, the caller closes the connection after it like redis,
+// even if parser could go on, since the client and server no longer agree on the stream
+func (h *Handler) replyProtocolError(client *connection.Connection, protoErr *parser.ProtocolError) {
+	errReply := protocol.MakeErrReply("ERR " + protoErr.Error())
+	_ = client.Buffer(errReply.ToBytes())
+	_ = client.Flush()
+	logger.Info("protocol error from " + client.RemoteAddr() + ": " + protoErr.Msg)
+}
+
+// handleRequest executes a request and sends the result, queryBufSize is the size of data received but not parsed.
+// It returns true if arguments are no longer referenced and can be returned by parser.Reader.Release
+func (h *Handler) handleRequest(client *connection.Connection, reply redis.Reply, queryBufSize int) bool {
+	r, ok := reply.(*protocol.MultiBulkReply)
+	if !ok {
+		// other top level types such as RESP3 null are not commands, close connection like redis
+		errReply := protocol.MakeErrReply("ERR Protocol error: expected '*', got '" + string(reply.ToBytes()[:1]) + "'")
+		_ = client.Buffer(errReply.ToBytes())
+		_ = client.Flush()
+		_ = client.Close()
+		logger.Info("protocol error from " + client.RemoteAddr() + ": require multi bulk protocol")
+		return false
+	}
+	if len(r.Args) > 0 {
+		client.StartCommand(acl.CommandName(r.Args), queryBufSize)
+	}
+	start := time.Now()
+	result := h.exec(client, r.Args)
+	if len(r.Args) > 0 {
+		h.recordCommand(client, r.Args, result, time.Since(start))
+		h.track(client, r.Args, result)
+	}
+	// replies are buffered until the batch is done, see Handle and OnData
+	if client.ShouldReply() {
+		if result != nil {
+			_ = client.Buffer(protocol.Marshal(result, client.GetProtocol()))
+		} else {
+			_ = client.Buffer(unknownErrReplyBytes)
+		}
+	}
+	// checked even if reply is off, e.g. CLIENT KILL of itself under CLIENT REPLY OFF
+	if client.ClosingAfterReply() {
+		_ = client.Flush()
+		_ = client.Close()
+	}
+	// reply has been marshaled, read only commands don't keep arguments, see database.DB
+	return len(r.Args) > 0 && acl.IsReadOnly(r.Args)
+}
+
+// exec runs connection level commands itself and sends the others to db
+func (h *Handler) exec(client redis.Connection, cmdLine [][]byte) redis.Reply {
+	if len(cmdLine) == 0 {
+		return protocol.MakeErrReply("ERR empty command")
+	}
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	if errReply := checkPermission(client, cmdName, cmdLine); errReply != nil {
+		return errReply
+	}
+	if client.GetProtocol() < protocol.RESP3 && h.pubsub.count(client.(*connection.Connection)) > 0 {
+		if _, ok := pubsubAllowed[cmdName]; !ok {
+			return protocol.MakeErrReply("ERR Can't execute '" + cmdName +
+				"': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context")
+		}
+	}
+	if cmd, ok := cmdTable[cmdName]; ok {
+		return cmd(h, client, cmdLine[1:])
+	}
+	if h.db == nil {
+		return protocol.MakeErrReply("ERR unknown command '" + cmdName + "'")
+	}
+	if errReply := h.freeMemory(cmdLine); errReply != nil {
+		return errReply
+	}
+	h.hotKeys.record(cmdLine)
+	return h.db.Exec(client, cmdLine)
+}
+
+// Close stops handler
+func (h *Handler) Close() error {
+	logger.Info("handler shutting down...")
+	h.closing.Set(true)
+	h.activeConn.Range(func(key interface{}, val interface{}) bool {
+		client := key.(*connection.Connection)
+		_ = client.Close()
+		return true
+	})
+	if h.db != nil {
+		h.db.Close()
+	}
+	return nil
+}
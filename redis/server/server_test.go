@@ -0,0 +1,323 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/atomwqh/MyGodis/datastruct/dict"
+	"github.com/atomwqh/MyGodis/interface/database"
+	"github.com/atomwqh/MyGodis/interface/redis"
+	"github.com/atomwqh/MyGodis/lib/utils"
+	"github.com/atomwqh/MyGodis/redis/protocol"
+	"github.com/atomwqh/MyGodis/tcp"
+)
+
+// serve starts a server of db which is closed after test
+func serve(t *testing.T, db database.DB) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closeChan := make(chan struct{})
+	go tcp.ListenAndServe(listener, MakeHandler(db), closeChan)
+	t.Cleanup(func() {
+		closeChan <- struct{}{}
+	})
+	return listener.Addr().String()
+}
+
+func startServer(t *testing.T) string {
+	return serve(t, nil)
+}
+
+// memDB supports GET, SET, DEL and FLUSHDB, it is enough for testing commands handled by server.
+// It keeps db 0 in dicts like storage engine, so that it is an eviction.Keyspace
+type memDB struct {
+	mu     sync.Mutex
+	data   *dict.ConcurrentDict
+	ttl    *dict.ConcurrentDict
+	hits   int64
+	misses int64
+}
+
+func makeMemDB() *memDB {
+	return &memDB{data: dict.MakeConcurrent(16), ttl: dict.MakeConcurrent(16)}
+}
+
+func (db *memDB) Exec(client redis.Connection, cmdLine [][]byte) redis.Reply {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	switch strings.ToLower(string(cmdLine[0])) {
+	case "get":
+		if val, ok := db.data.Get(string(cmdLine[1])); ok {
+			db.hits++
+			entity := val.(*database.DataEntity)
+			entity.Touch()
+			return protocol.MakeBulkReply(entity.Data.([]byte))
+		}
+		db.misses++
+		return protocol.MakeNullBulkReply()
+	case "set":
+		entity := &database.DataEntity{Data: cmdLine[2]}
+		entity.Touch()
+		db.data.Put(string(cmdLine[1]), entity)
+		return protocol.MakeOkReply()
+	case "del":
+		deleted := 0
+		for _, key := range cmdLine[1:] {
+			_, result := db.data.Remove(string(key))
+			db.ttl.Remove(string(key))
+			deleted += result
+		}
+		return protocol.MakeIntReply(int64(deleted))
+	case "flushdb", "flushall":
+		db.data.Clear()
+		db.ttl.Clear()
+		return protocol.MakeOkReply()
+	}
+	return protocol.MakeErrReply("ERR unknown command")
+}
+
+func (db *memDB) AfterClientClose(c redis.Connection) {}
+
+func (db *memDB) Close() {}
+
+func (db *memDB) GetDBSize(dbIndex int) (int, int) {
+	if dbIndex != 0 {
+		return 0, 0
+	}
+	return db.data.Len(), db.ttl.Len()
+}
+
+func (db *memDB) GetEntity(dbIndex int, key string) (*database.DataEntity, bool) {
+	if dbIndex != 0 {
+		return nil, false
+	}
+	val, ok := db.data.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return val.(*database.DataEntity), true
+}
+
+// ScanKeys uses the index in sorted keys as cursor
+func (db *memDB) ScanKeys(dbIndex int, cursor int, count int) ([]string, int) {
+	if dbIndex != 0 {
+		return nil, 0
+	}
+	keys := db.data.Keys()
+	sort.Strings(keys)
+	if cursor+count >= len(keys) {
+		return keys[cursor:], 0
+	}
+	return keys[cursor : cursor+count], cursor + count
+}
+
+func (db *memDB) GetStats() database.Stats {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return database.Stats{KeyspaceHits: db.hits, KeyspaceMisses: db.misses}
+}
+
+// Dicts returns empty dicts for dbs other than 0
+func (db *memDB) Dicts(dbIndex int) (*dict.ConcurrentDict, *dict.ConcurrentDict) {
+	if dbIndex != 0 {
+		return dict.MakeConcurrent(1), dict.MakeConcurrent(1)
+	}
+	return db.data, db.ttl
+}
+
+func (db *memDB) Evict(dbIndex int, key string) {
+	db.Exec(nil, [][]byte{[]byte("DEL"), []byte(key)})
+}
+
+func startServerWithDB(t *testing.T) string {
+	return serve(t, makeMemDB())
+}
+
+// testConn sends commands and reads replies line by line
+type testConn struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func dial(t *testing.T, addr string) *testConn {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return &testConn{t: t, conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// send writes a command without reading reply
+func (c *testConn) send(args ...string) {
+	_, _ = c.conn.Write(protocol.MakeMultiBulkReply(utils.ToCmdLine(args...)).ToBytes())
+}
+
+// readLine returns the next line without CRLF
+func (c *testConn) readLine() (string, error) {
+	line, err := c.reader.ReadString('\n')
+	return strings.TrimSuffix(line, "\r\n"), err
+}
+
+// expect sends a command and checks the first line of reply
+func (c *testConn) expect(expected string, args ...string) {
+	c.t.Helper()
+	c.send(args...)
+	c.expectLine(expected)
+}
+
+// expectLine checks the next line of reply
+func (c *testConn) expectLine(expected string) {
+	c.t.Helper()
+	line, err := c.readLine()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if line != expected {
+		c.t.Errorf("expect %q, actual %q", expected, line)
+	}
+}
+
+// readBulk reads a bulk string reply
+func (c *testConn) readBulk() string {
+	c.t.Helper()
+	line, err := c.readLine()
+	if err != nil || !strings.HasPrefix(line, "$") {
+		c.t.Fatalf("expect bulk string, actual %q %v", line, err)
+	}
+	size, _ := strconv.Atoi(line[1:])
+	buf := make([]byte, size+2)
+	if _, err = io.ReadFull(c.reader, buf); err != nil {
+		c.t.Fatal(err)
+	}
+	return string(buf[:size])
+}
+
+func TestHello(t *testing.T) {
+	conn, err := net.Dial("tcp", startServer(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	_, _ = conn.Write([]byte("*2\r\n$5\r\nHELLO\r\n$1\r\n3\r\n"))
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "%7\r\n" {
+		t.Errorf("expect map reply, actual %q", line)
+	}
+}
+
+func TestProtocolError(t *testing.T) {
+	conn, err := net.Dial("tcp", startServer(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	_, _ = conn.Write([]byte("*1\r\n$9999999999\r\n"))
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "-ERR Protocol error: invalid bulk length\r\n" {
+		t.Errorf("unexpected reply %q", line)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err = reader.ReadByte(); err != io.EOF {
+		t.Errorf("connection should be closed, actual %v", err)
+	}
+
+	// parser could go on after unbalanced quotes, but connection is closed like redis
+	c := dial(t, startServer(t))
+	_, _ = c.conn.Write([]byte("set \"a b\r\nping\r\n"))
+	c.expectLine("-ERR Protocol error: unbalanced quotes in request")
+	_ = c.conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := c.readLine(); err != io.EOF {
+		t.Errorf("connection should be closed, actual %v", err)
+	}
+}
+
+func TestNotCommand(t *testing.T) {
+	c := dial(t, startServer(t))
+	_, _ = c.conn.Write([]byte("_\r\n"))
+	c.expectLine("-ERR Protocol error: expected '*', got '_'")
+	_ = c.conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := c.readLine(); err != io.EOF {
+		t.Errorf("connection should be closed, actual %v", err)
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closeChan := make(chan struct{})
+	go tcp.Serve(listener, &tcp.Config{Timeout: 200 * time.Millisecond}, MakeHandler(nil), closeChan)
+	t.Cleanup(func() {
+		closeChan <- struct{}{}
+	})
+	addr := listener.Addr().String()
+	idle, subscriber, monitor := dial(t, addr), dial(t, addr), dial(t, addr)
+	idle.expect("+PONG", "ping")
+	subscriber.send("subscribe", "ch")
+	subscriber.expectLines("*3", "$9", "subscribe", "$2", "ch", ":1")
+	monitor.expect("+OK", "monitor")
+
+	time.Sleep(500 * time.Millisecond)
+	_ = idle.conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := idle.readLine(); err != io.EOF {
+		t.Errorf("idle client should be closed, actual %v", err)
+	}
+	publisher := dial(t, addr)
+	publisher.expect(":1", "publish", "ch", "hi")
+	subscriber.expectLines("*3", "$7", "message", "$2", "ch", "$2", "hi")
+	if line, err := monitor.readLine(); err != nil || !strings.Contains(line, `"publish"`) {
+		t.Errorf("monitor should be kept, actual %q %v", line, err)
+	}
+}
+
+func TestInfo(t *testing.T) {
+	c := dial(t, startServerWithDB(t))
+	c.expect("+OK", "SET", "a", "1")
+	c.expect("$1", "GET", "a")
+	c.expectLine("1")
+	c.expect("$-1", "GET", "b")
+
+	c.send("INFO")
+	info := c.readBulk()
+	for _, field := range []string{"# Server\r\n", "redis_version:" + Version, "connected_clients:",
+		"used_memory:", "# Persistence\r\n", "total_commands_processed:3\r\n", "keyspace_hits:1\r\n",
+		"keyspace_misses:1\r\n", "role:master\r\n", "db0:keys=1,expires=0\r\n"} {
+		if !strings.Contains(info, field) {
+			t.Errorf("INFO should contain %q", field)
+		}
+	}
+	// memDB doesn't persist, fields unknown to server are omitted
+	if strings.Contains(info, "rdb_last_save_time") || strings.Contains(info, "loading:") {
+		t.Errorf("INFO should omit persistence state without database.PersistenceReporter")
+	}
+	c.send("INFO", "clients", "KEYSPACE")
+	info = c.readBulk()
+	if !strings.HasPrefix(info, "# Clients\r\n") || !strings.Contains(info, "\r\n\r\n# Keyspace\r\n") ||
+		strings.Contains(info, "# Server") {
+		t.Errorf("unexpected INFO clients keyspace %q", info)
+	}
+}
@@ -0,0 +1,295 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atomwqh/MyGodis/config"
+	"github.com/atomwqh/MyGodis/interface/redis"
+	"github.com/atomwqh/MyGodis/redis/acl"
+	"github.com/atomwqh/MyGodis/redis/connection"
+	"github.com/atomwqh/MyGodis/redis/latency"
+	"github.com/atomwqh/MyGodis/redis/protocol"
+)
+
+// SLOWLOG 记录执行时间超过 slowlog-log-slower-than 微秒的命令, 保存在容量为 slowlog-max-len 的环形缓冲中, 新的在前.
+// 参数过多或过长时会截断, 密码等敏感参数会被替换为 (redacted)
+
+func init() {
+	registerCommand("slowlog", execSlowLog)
+	registerCommand("latency", execLatency)
+}
+
+// limits of arguments kept in slow log like redis
+const (
+	slowLogMaxArgc   = 32
+	slowLogMaxString = 128
+)
+
+type slowLogEntry struct {
+	id       int64
+	time     time.Time
+	duration time.Duration
+	args     [][]byte
+	addr     string
+	name     string
+}
+
+// slowLog is a ring buffer whose capacity follows slowlog-max-len
+type slowLog struct {
+	mu      sync.Mutex
+	entries []*slowLogEntry // len(entries) is the capacity
+	next    int             // index where the next entry is written
+	size    int
+	nextID  int64
+}
+
+// resize changes capacity keeping the newest entries, it is called only when slowlog-max-len changed
+func (l *slowLog) resize(capacity int) {
+	if l.size > capacity {
+		l.size = capacity
+	}
+	entries := make([]*slowLogEntry, capacity)
+	for i := 0; i < l.size; i++ {
+		// newest at the end
+		entries[l.size-1-i] = l.get(i)
+	}
+	l.entries = entries
+	l.next = l.size
+	if capacity > 0 {
+		l.next %= capacity
+	}
+}
+
+// get returns the i-th newest entry, i must be less than size
+func (l *slowLog) get(i int) *slowLogEntry {
+	n := len(l.entries)
+	return l.entries[((l.next-1-i)%n+n)%n]
+}
+
+func (l *slowLog) push(entry *slowLogEntry) {
+	if len(l.entries) == 0 {
+		return
+	}
+	l.entries[l.next] = entry
+	l.next = (l.next + 1) % len(l.entries)
+	if l.size < len(l.entries) {
+		l.size++
+	}
+}
+
+func (l *slowLog) reset() {
+	for i := range l.entries {
+		l.entries[i] = nil
+	}
+	l.next = 0
+	l.size = 0
+}
+
+var redacted = []byte("(redacted)")
+
+// redactArgs returns a copy of cmdLine with passwords replaced
+func redactArgs(cmdLine [][]byte) [][]byte {
+	args := make([][]byte, len(cmdLine))
+	copy(args, cmdLine)
+	switch acl.CommandName(cmdLine) {
+	case "auth", "acl|setuser":
+		// ACL SETUSER keeps username
+		from := 1
+		if len(args) > 2 && strings.EqualFold(string(args[0]), "acl") {
+			from = 3
+		}
+		for i := from; i < len(args); i++ {
+			args[i] = redacted
+		}
+	case "hello":
+		for i := 1; i < len(args); i++ {
+			if strings.EqualFold(string(args[i]), "auth") {
+				for j := i + 1; j < len(args) && j <= i+2; j++ {
+					args[j] = redacted
+				}
+			}
+		}
+	case "config|set":
+		for i := 2; i+1 < len(args); i += 2 {
+			if strings.EqualFold(string(args[i]), "requirepass") {
+				args[i+1] = redacted
+			}
+		}
+	}
+	return args
+}
+
+// add records the command if it is slower than slowlog-log-slower-than
+func (l *slowLog) add(client *connection.Connection, cmdLine [][]byte, elapsed time.Duration) {
+	props := config.Get()
+	if props.SlowlogLogSlowerThan < 0 || elapsed < time.Duration(props.SlowlogLogSlowerThan)*time.Microsecond {
+		return
+	}
+	args := redactArgs(cmdLine)
+	argc := len(args)
+	if argc > slowLogMaxArgc {
+		args = args[:slowLogMaxArgc-1]
+		args = append(args, []byte("... ("+strconv.Itoa(argc-slowLogMaxArgc+1)+" more arguments)"))
+	}
+	for i, arg := range args {
+		// arguments of read only commands are reused by parser after the command, see parser.Reader.Release
+		if len(arg) > slowLogMaxString {
+			args[i] = []byte(string(arg[:slowLogMaxString]) + "... (" + strconv.Itoa(len(arg)-slowLogMaxString) + " more bytes)")
+		} else {
+			args[i] = append([]byte(nil), arg...)
+		}
+	}
+	entry := &slowLogEntry{
+		time:     time.Now(),
+		duration: elapsed,
+		args:     args,
+		addr:     client.RemoteAddr(),
+		name:     client.GetName(),
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry.id = l.nextID
+	l.nextID++
+	if len(l.entries) != props.SlowlogMaxLen {
+		l.resize(props.SlowlogMaxLen)
+	}
+	l.push(entry)
+}
+
+// execSlowLog handles SLOWLOG GET [count], SLOWLOG LEN, SLOWLOG RESET and SLOWLOG HELP
+func execSlowLog(h *Handler, c redis.Connection, args [][]byte) redis.Reply {
+	if len(args) == 0 {
+		return protocol.MakeErrReply("ERR wrong number of arguments for 'slowlog' command")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	args = args[1:]
+	l := h.slowLog
+	switch subCmd {
+	case "get":
+		if len(args) > 1 {
+			return protocol.MakeErrReply("ERR wrong number of arguments for 'slowlog|get' command")
+		}
+		count := 10
+		if len(args) == 1 {
+			n, err := strconv.Atoi(string(args[0]))
+			if err != nil || n < -1 {
+				return protocol.MakeErrReply("ERR count should be greater than or equal to -1")
+			}
+			count = n
+		}
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if count < 0 || count > l.size {
+			count = l.size
+		}
+		replies := make([]redis.Reply, count)
+		for i := range replies {
+			e := l.get(i)
+			replies[i] = protocol.MakeMultiRawReply([]redis.Reply{
+				protocol.MakeIntReply(e.id),
+				protocol.MakeIntReply(e.time.Unix()),
+				protocol.MakeIntReply(int64(e.duration / time.Microsecond)),
+				protocol.MakeMultiBulkReply(e.args),
+				protocol.MakeBulkReply([]byte(e.addr)),
+				protocol.MakeBulkReply([]byte(e.name)),
+			})
+		}
+		return protocol.MakeMultiRawReply(replies)
+	case "len":
+		if len(args) != 0 {
+			return protocol.MakeErrReply("ERR wrong number of arguments for 'slowlog|len' command")
+		}
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return protocol.MakeIntReply(int64(l.size))
+	case "reset":
+		if len(args) != 0 {
+			return protocol.MakeErrReply("ERR wrong number of arguments for 'slowlog|reset' command")
+		}
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.reset()
+		return protocol.MakeOkReply()
+	case "help":
+		return helpReply(
+			"SLOWLOG <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"GET [<count>]",
+			"    Return top <count> entries from the slowlog (default: 10, -1 mean all).",
+			"    Entries are made of:",
+			"    id, timestamp, time in microseconds, arguments array, client IP and port,",
+			"    client name",
+			"LEN",
+			"    Return the length of the slowlog.",
+			"RESET",
+			"    Reset the slowlog.",
+			"HELP",
+			"    Print this help.",
+		)
+	}
+	return protocol.MakeErrReply("ERR unknown subcommand '" + subCmd + "'. Try SLOWLOG HELP.")
+}
+
+// execLatency handles LATENCY LATEST, LATENCY HISTORY event, LATENCY RESET [event ...], LATENCY DOCTOR and LATENCY HELP
+func execLatency(h *Handler, c redis.Connection, args [][]byte) redis.Reply {
+	if len(args) == 0 {
+		return protocol.MakeErrReply("ERR wrong number of arguments for 'latency' command")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	args = args[1:]
+	switch subCmd {
+	case "latest":
+		if len(args) != 0 {
+			return protocol.MakeErrReply("ERR wrong number of arguments for 'latency|latest' command")
+		}
+		latest := latency.LatestSamples()
+		replies := make([]redis.Reply, len(latest))
+		for i, l := range latest {
+			replies[i] = protocol.MakeMultiRawReply([]redis.Reply{
+				protocol.MakeBulkReply([]byte(l.Event)),
+				protocol.MakeIntReply(l.Time.Unix()),
+				protocol.MakeIntReply(l.Latency.Milliseconds()),
+				protocol.MakeIntReply(l.Max.Milliseconds()),
+			})
+		}
+		return protocol.MakeMultiRawReply(replies)
+	case "history":
+		if len(args) != 1 {
+			return protocol.MakeErrReply("ERR wrong number of arguments for 'latency|history' command")
+		}
+		samples := latency.History(string(args[0]))
+		replies := make([]redis.Reply, len(samples))
+		for i, s := range samples {
+			replies[i] = protocol.MakeMultiRawReply([]redis.Reply{
+				protocol.MakeIntReply(s.Time.Unix()),
+				protocol.MakeIntReply(s.Latency.Milliseconds()),
+			})
+		}
+		return protocol.MakeMultiRawReply(replies)
+	case "reset":
+		return protocol.MakeIntReply(int64(latency.Reset(toStrings(args)...)))
+	case "doctor":
+		if len(args) != 0 {
+			return protocol.MakeErrReply("ERR wrong number of arguments for 'latency|doctor' command")
+		}
+		return protocol.MakeVerbatimReply("txt", []byte(latency.Doctor()))
+	case "help":
+		return helpReply(
+			"LATENCY <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"DOCTOR",
+			"    Return a human readable latency analysis report.",
+			"HISTORY <event>",
+			"    Return time-latency samples for the <event> class.",
+			"LATEST",
+			"    Return the latest latency samples for all events.",
+			"RESET [<event> ...]",
+			"    Reset latency data of one or more <event> classes.",
+			"    (default: reset all data for all event classes)",
+			"HELP",
+			"    Print this help.",
+		)
+	}
+	return protocol.MakeErrReply("ERR unknown subcommand '" + subCmd + "'. Try LATENCY HELP.")
+}
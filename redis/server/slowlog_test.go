@@ -0,0 +1,127 @@
+package server
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/atomwqh/MyGodis/config"
+	"github.com/atomwqh/MyGodis/lib/utils"
+	"github.com/atomwqh/MyGodis/redis/connection"
+)
+
+func TestSlowLog(t *testing.T) {
+	config.Update(func(props *config.ServerProperties) {
+		props.SlowlogLogSlowerThan = 0
+		props.SlowlogMaxLen = 2
+	})
+	defer config.Update(func(props *config.ServerProperties) {
+		props.SlowlogLogSlowerThan = 10000
+		props.SlowlogMaxLen = 128
+	})
+	c := dial(t, startServer(t))
+	c.expect("+OK", "SLOWLOG", "RESET")
+	c.expect("+PONG", "PING")
+	c.expect("+PONG", "PING")
+	c.expect(":2", "SLOWLOG", "LEN")
+
+	// newest first, the entry of SLOWLOG LEN has been added
+	c.send("SLOWLOG", "GET", "1")
+	c.expectLines("*1", "*6", ":3")
+	if line, _ := c.readLine(); line[0] != ':' {
+		t.Errorf("expect timestamp, actual %q", line)
+	}
+	_, _ = c.readLine() // duration
+	c.expectLines("*2", "$7", "SLOWLOG", "$3", "LEN")
+	_ = c.readBulk() // client address
+	c.expectLines("$0", "")
+
+	config.Update(func(props *config.ServerProperties) {
+		props.SlowlogLogSlowerThan = -1
+	})
+	c.expect("+OK", "SLOWLOG", "RESET")
+	c.expect(":0", "SLOWLOG", "LEN")
+
+	c.send("SLOWLOG", "HELP")
+	if line, _ := c.readLine(); !strings.HasPrefix(line, "*") {
+		t.Errorf("expect help lines, actual %q", line)
+	}
+	c.expectLine("+SLOWLOG <subcommand> [<arg> [value] [opt] ...]. Subcommands are:")
+	for i := 0; i < 11; i++ {
+		_, _ = c.readLine()
+	}
+	c.send("LATENCY", "HELP")
+	_, _ = c.readLine()
+	c.expectLine("+LATENCY <subcommand> [<arg> [value] [opt] ...]. Subcommands are:")
+}
+
+func TestSlowLogRing(t *testing.T) {
+	l := &slowLog{}
+	ids := func() []int64 {
+		result := make([]int64, l.size)
+		for i := range result {
+			result[i] = l.get(i).id
+		}
+		return result
+	}
+	l.resize(3)
+	for i := 0; i < 5; i++ {
+		l.push(&slowLogEntry{id: int64(i)})
+	}
+	if actual := ids(); len(actual) != 3 || actual[0] != 4 || actual[2] != 2 {
+		t.Errorf("expect newest 3 entries, actual %v", actual)
+	}
+	l.resize(2)
+	if actual := ids(); len(actual) != 2 || actual[0] != 4 || actual[1] != 3 {
+		t.Errorf("shrinking should keep newest entries, actual %v", actual)
+	}
+	l.resize(4)
+	l.push(&slowLogEntry{id: 5})
+	if actual := ids(); len(actual) != 3 || actual[0] != 5 || actual[2] != 3 {
+		t.Errorf("growing should keep entries, actual %v", actual)
+	}
+	l.resize(0)
+	l.push(&slowLogEntry{id: 6})
+	if l.size != 0 {
+		t.Errorf("slowlog-max-len 0 should keep nothing")
+	}
+}
+
+func TestRedactArgs(t *testing.T) {
+	tests := []struct {
+		cmdLine string
+		expect  string
+	}{
+		{"AUTH alice secret", "AUTH (redacted) (redacted)"},
+		{"HELLO 3 AUTH alice secret SETNAME a", "HELLO 3 AUTH (redacted) (redacted) SETNAME a"},
+		{"ACL SETUSER alice on >secret", "ACL SETUSER alice (redacted) (redacted)"},
+		{"CONFIG SET timeout 1 requirepass pw", "CONFIG SET timeout 1 requirepass (redacted)"},
+		{"GET a", "GET a"},
+	}
+	for _, tt := range tests {
+		args := redactArgs(utils.ToCmdLine(strings.Fields(tt.cmdLine)...))
+		if actual := strings.Join(toStrings(args), " "); actual != tt.expect {
+			t.Errorf("expect %q, actual %q", tt.expect, actual)
+		}
+	}
+}
+
+func TestSlowLogCopyArgs(t *testing.T) {
+	config.Update(func(props *config.ServerProperties) {
+		props.SlowlogLogSlowerThan = 0
+	})
+	defer config.Update(func(props *config.ServerProperties) {
+		props.SlowlogLogSlowerThan = 10000
+	})
+	server, peer := net.Pipe()
+	defer server.Close()
+	defer peer.Close()
+	l := &slowLog{}
+	cmdLine := utils.ToCmdLine("GET", "key")
+	l.add(connection.NewConn(server), cmdLine, 0)
+	// parser reuses arguments of read only commands after they are executed
+	copy(cmdLine[1], "xxx")
+	if actual := string(l.get(0).args[1]); actual != "key" {
+		t.Errorf("slow log should keep a copy of arguments, actual %q", actual)
+	}
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/atomwqh/MyGodis/interface/redis"
+	"github.com/atomwqh/MyGodis/redis/acl"
+	"github.com/atomwqh/MyGodis/redis/connection"
+	"github.com/atomwqh/MyGodis/redis/latency"
+	"github.com/atomwqh/MyGodis/redis/protocol"
+)
+
+// 每个命令的调用次数和耗时, 用于 INFO commandstats 和 /metrics 的直方图.
+// 只统计命令表中存在的命令, 未知命令不会产生新的统计项
+
+// latencyBuckets are upper bounds of latency histogram
+var latencyBuckets = []time.Duration{
+	10 * time.Microsecond, 50 * time.Microsecond, 100 * time.Microsecond, 500 * time.Microsecond,
+	time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 500 * time.Millisecond, time.Second,
+}
+
+// commandStat must be accessed by sync/atomic
+type commandStat struct {
+	calls  int64
+	failed int64
+	usec   int64
+	// buckets counts calls of each latency bucket, not cumulative
+	buckets []int64
+}
+
+type commandStats struct {
+	mu    sync.RWMutex
+	stats map[string]*commandStat
+}
+
+func makeCommandStats() *commandStats {
+	return &commandStats{stats: make(map[string]*commandStat)}
+}
+
+func (s *commandStats) get(name string) *commandStat {
+	s.mu.RLock()
+	stat := s.stats[name]
+	s.mu.RUnlock()
+	if stat != nil {
+		return stat
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stat = s.stats[name]; stat == nil {
+		stat = &commandStat{buckets: make([]int64, len(latencyBuckets)+1)}
+		s.stats[name] = stat
+	}
+	return stat
+}
+
+// record adds a call of command
+func (s *commandStats) record(cmdLine [][]byte, elapsed time.Duration, failed bool) {
+	name, ok := acl.KnownCommandName(cmdLine)
+	if !ok {
+		return
+	}
+	stat := s.get(name)
+	atomic.AddInt64(&stat.calls, 1)
+	atomic.AddInt64(&stat.usec, int64(elapsed/time.Microsecond))
+	if failed {
+		atomic.AddInt64(&stat.failed, 1)
+	}
+	i := sort.Search(len(latencyBuckets), func(i int) bool {
+		return elapsed <= latencyBuckets[i]
+	})
+	atomic.AddInt64(&stat.buckets[i], 1)
+}
+
+// commandStatSnapshot is a copy of commandStat
+type commandStatSnapshot struct {
+	name    string
+	calls   int64
+	failed  int64
+	usec    int64
+	buckets []int64
+}
+
+// snapshot returns stats sorted by command name
+func (s *commandStats) snapshot() []commandStatSnapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]commandStatSnapshot, 0, len(s.stats))
+	for name, stat := range s.stats {
+		snap := commandStatSnapshot{
+			name:    name,
+			calls:   atomic.LoadInt64(&stat.calls),
+			failed:  atomic.LoadInt64(&stat.failed),
+			usec:    atomic.LoadInt64(&stat.usec),
+			buckets: make([]int64, len(stat.buckets)),
+		}
+		for i := range stat.buckets {
+			snap.buckets[i] = atomic.LoadInt64(&stat.buckets[i])
+		}
+		result = append(result, snap)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].name < result[j].name
+	})
+	return result
+}
+
+// recordCommand updates total_commands_processed, command stats, slow log and latency monitor, then feeds monitors
+func (h *Handler) recordCommand(client *connection.Connection, cmdLine [][]byte, result redis.Reply, elapsed time.Duration) {
+	atomic.AddInt64(&h.commandsProcessed, 1)
+	_, failed := result.(protocol.ErrorReply)
+	h.cmdStats.record(cmdLine, elapsed, failed)
+	h.slowLog.add(client, cmdLine, elapsed)
+	latency.Record(latency.Command, elapsed)
+	h.monitors.feed(client, client.GetDBIndex(), cmdLine)
+}
+
+func (h *Handler) commandStatsInfo() []infoField {
+	var fields []infoField
+	for _, stat := range h.cmdStats.snapshot() {
+		perCall := 0.0
+		if stat.calls > 0 {
+			perCall = float64(stat.usec) / float64(stat.calls)
+		}
+		fields = append(fields, infoField{
+			name: "cmdstat_" + stat.name,
+			value: "calls=" + itoa(stat.calls) + ",usec=" + itoa(stat.usec) +
+				",usec_per_call=" + strconv.FormatFloat(perCall, 'f', 2, 64) + ",failed_calls=" + itoa(stat.failed),
+		})
+	}
+	return fields
+}
@@ -0,0 +1,440 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/atomwqh/MyGodis/interface/redis"
+	"github.com/atomwqh/MyGodis/redis/acl"
+	"github.com/atomwqh/MyGodis/redis/connection"
+	"github.com/atomwqh/MyGodis/redis/protocol"
+)
+
+// 客户端缓存 (CLIENT TRACKING): 默认模式记住客户端读过的 key, BCAST 模式按前缀广播.
+// key 被修改后向客户端推送失效消息, RESP3 直接推送 invalidate, RESP2 需要重定向到订阅了 __redis__:invalidate 的连接
+
+const invalidateChannel = "__redis__:invalidate"
+
+// caching states of OPTIN and OPTOUT mode, set by CLIENT CACHING for next command
+const (
+	cachingDefault = iota
+	cachingYes
+	cachingNo
+)
+
+type trackingOptions struct {
+	bcast    bool
+	optIn    bool
+	optOut   bool
+	noLoop   bool
+	redirect uint64
+	prefixes []string
+	caching  int
+	keys     map[string]struct{} // keys remembered in default mode
+}
+
+type tracker struct {
+	count    int32 // number of tracking clients, commands skip tracking without lock if it is 0
+	mu       sync.Mutex
+	clients  map[*connection.Connection]*trackingOptions
+	keys     map[string]map[*connection.Connection]struct{}
+	prefixes map[string]map[*connection.Connection]struct{} // prefixes of BCAST mode, empty prefix matches all keys
+}
+
+func makeTracker() *tracker {
+	return &tracker{
+		clients:  make(map[*connection.Connection]*trackingOptions),
+		keys:     make(map[string]map[*connection.Connection]struct{}),
+		prefixes: make(map[string]map[*connection.Connection]struct{}),
+	}
+}
+
+// options returns a copy of tracking options of client, it returns nil if tracking is off
+func (t *tracker) options(client *connection.Connection) *trackingOptions {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	opts := t.clients[client]
+	if opts == nil {
+		return nil
+	}
+	cp := *opts
+	cp.prefixes = append([]string(nil), opts.prefixes...)
+	cp.keys = nil
+	return &cp
+}
+
+// enable turns on tracking or changes options of a tracking client
+func (t *tracker) enable(client *connection.Connection, opts *trackingOptions) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if old := t.clients[client]; old != nil {
+		// prefixes are accumulated by CLIENT TRACKING ON BCAST PREFIX ...
+		for _, prefix := range old.prefixes {
+			if !containsString(opts.prefixes, prefix) {
+				opts.prefixes = append(opts.prefixes, prefix)
+			}
+		}
+		opts.keys = old.keys
+	}
+	if opts.keys == nil {
+		opts.keys = make(map[string]struct{})
+	}
+	if opts.bcast {
+		if len(opts.prefixes) == 0 {
+			opts.prefixes = []string{""}
+		}
+		for _, prefix := range opts.prefixes {
+			if t.prefixes[prefix] == nil {
+				t.prefixes[prefix] = make(map[*connection.Connection]struct{})
+			}
+			t.prefixes[prefix][client] = struct{}{}
+		}
+	}
+	if t.clients[client] == nil {
+		atomic.AddInt32(&t.count, 1)
+	}
+	t.clients[client] = opts
+	client.SetTracking(true, opts.redirect)
+}
+
+// disable turns off tracking and forgets keys read by client
+func (t *tracker) disable(client *connection.Connection) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	opts := t.clients[client]
+	if opts == nil {
+		return
+	}
+	for key := range opts.keys {
+		deleteClient(t.keys, key, client)
+	}
+	for _, prefix := range opts.prefixes {
+		deleteClient(t.prefixes, prefix, client)
+	}
+	delete(t.clients, client)
+	atomic.AddInt32(&t.count, -1)
+	client.SetTracking(false, 0)
+}
+
+func deleteClient(table map[string]map[*connection.Connection]struct{}, name string, client *connection.Connection) {
+	delete(table[name], client)
+	if len(table[name]) == 0 {
+		delete(table, name)
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// setCaching handles CLIENT CACHING YES|NO
+func (t *tracker) setCaching(client *connection.Connection, yes bool) redis.Reply {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	opts := t.clients[client]
+	if opts == nil || (!opts.optIn && !opts.optOut) {
+		return protocol.MakeErrReply("ERR CLIENT CACHING can be called only when the client is in tracking mode with OPTIN or OPTOUT mode enabled")
+	}
+	if yes && !opts.optIn {
+		return protocol.MakeErrReply("ERR CLIENT CACHING YES is only valid when tracking is enabled in OPTIN mode.")
+	}
+	if !yes && !opts.optOut {
+		return protocol.MakeErrReply("ERR CLIENT CACHING NO is only valid when tracking is enabled in OPTOUT mode.")
+	}
+	if yes {
+		opts.caching = cachingYes
+	} else {
+		opts.caching = cachingNo
+	}
+	return protocol.MakeOkReply()
+}
+
+// remember records keys read by client in default mode, it is called after each command.
+// The state of CLIENT CACHING only applies to the next command.
+func (t *tracker) remember(client *connection.Connection, keys []string, read bool, isCaching bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	opts := t.clients[client]
+	if opts == nil {
+		return
+	}
+	caching := opts.caching
+	if !isCaching {
+		opts.caching = cachingDefault
+	}
+	if !read || opts.bcast || (opts.optIn && caching != cachingYes) || (opts.optOut && caching == cachingNo) {
+		return
+	}
+	for _, key := range keys {
+		if t.keys[key] == nil {
+			t.keys[key] = make(map[*connection.Connection]struct{})
+		}
+		t.keys[key][client] = struct{}{}
+		opts.keys[key] = struct{}{}
+	}
+}
+
+// invalidation is a message to be sent to a tracking client, keys is nil for flushing all keys
+type invalidation struct {
+	client   *connection.Connection
+	redirect uint64
+	keys     []string
+}
+
+// invalidate collects messages for keys modified by writer
+func (t *tracker) invalidate(writer *connection.Connection, keys []string) []*invalidation {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var result []*invalidation
+	index := make(map[*connection.Connection]*invalidation)
+	add := func(client *connection.Connection, key string) {
+		opts := t.clients[client]
+		if client == writer && opts.noLoop {
+			return
+		}
+		msg := index[client]
+		if msg == nil {
+			msg = &invalidation{client: client, redirect: opts.redirect}
+			index[client] = msg
+			result = append(result, msg)
+		}
+		if !containsString(msg.keys, key) {
+			msg.keys = append(msg.keys, key)
+		}
+	}
+	for _, key := range keys {
+		// keys are forgotten after invalidated, clients will read them again
+		for client := range t.keys[key] {
+			delete(t.clients[client].keys, key)
+			add(client, key)
+		}
+		delete(t.keys, key)
+		for prefix, clients := range t.prefixes {
+			if !strings.HasPrefix(key, prefix) {
+				continue
+			}
+			for client := range clients {
+				add(client, key)
+			}
+		}
+	}
+	return result
+}
+
+// invalidateAll forgets all keys and collects messages for all tracking clients, it is used by FLUSHDB and FLUSHALL
+func (t *tracker) invalidateAll() []*invalidation {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	result := make([]*invalidation, 0, len(t.clients))
+	for client, opts := range t.clients {
+		opts.keys = make(map[string]struct{})
+		result = append(result, &invalidation{client: client, redirect: opts.redirect})
+	}
+	t.keys = make(map[string]map[*connection.Connection]struct{})
+	return result
+}
+
+// track is called after each command, it sends invalidation messages for keys modified
+// and remembers keys read by client
+func (h *Handler) track(client *connection.Connection, cmdLine [][]byte, result redis.Reply) {
+	if atomic.LoadInt32(&h.tracker.count) == 0 {
+		return
+	}
+	_, failed := result.(protocol.ErrorReply)
+	name := acl.CommandName(cmdLine)
+	switch {
+	case failed:
+	case name == "flushdb" || name == "flushall":
+		h.sendInvalidations(h.tracker.invalidateAll())
+	case acl.IsWrite(cmdLine):
+		h.sendInvalidations(h.tracker.invalidate(client, acl.CommandKeys(cmdLine)))
+	}
+	if client.Tracking() {
+		read := !failed && acl.IsReadOnly(cmdLine)
+		var keys []string
+		if read {
+			keys = acl.CommandKeys(cmdLine)
+		}
+		h.tracker.remember(client, keys, read, name == "client|caching")
+	}
+}
+
+// sendInvalidations sends messages without holding lock of tracker
+func (h *Handler) sendInvalidations(messages []*invalidation) {
+	for _, msg := range messages {
+		target := msg.client
+		if msg.redirect != 0 {
+			val, ok := h.clientsByID.Load(msg.redirect)
+			if !ok {
+				if msg.client.GetProtocol() >= protocol.RESP3 {
+					push(msg.client, protocol.MakeBulkReply([]byte("tracking-redir-broken")),
+						protocol.MakeIntReply(int64(msg.redirect)))
+				}
+				continue
+			}
+			target = val.(*connection.Connection)
+		}
+		var keys redis.Reply = protocol.MakeNullReply()
+		if msg.keys != nil {
+			keys = bulkStrings(msg.keys)
+		}
+		if target.GetProtocol() >= protocol.RESP3 {
+			push(target, protocol.MakeBulkReply([]byte("invalidate")), keys)
+		} else if h.pubsub.isSubscribed(target, invalidateChannel) {
+			push(target, protocol.MakeBulkReply([]byte("message")), protocol.MakeBulkReply([]byte(invalidateChannel)), keys)
+		}
+		// RESP2 clients without redirection can't receive invalidation messages
+	}
+}
+
+func push(client *connection.Connection, replies ...redis.Reply) {
+	_ = client.Push(protocol.Marshal(protocol.MakePushReply(replies), client.GetProtocol()))
+}
+
+// clientTracking handles CLIENT TRACKING ON|OFF [REDIRECT id] [PREFIX prefix [PREFIX prefix ...]] [BCAST] [OPTIN] [OPTOUT] [NOLOOP]
+func clientTracking(h *Handler, client *connection.Connection, args [][]byte) redis.Reply {
+	if len(args) == 0 {
+		return protocol.MakeErrReply("ERR wrong number of arguments for 'client|tracking' command")
+	}
+	var on bool
+	switch strings.ToLower(string(args[0])) {
+	case "on":
+		on = true
+	case "off":
+	default:
+		return protocol.MakeErrReply("ERR syntax error")
+	}
+	opts := &trackingOptions{}
+	for i := 1; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "redirect":
+			if i+1 >= len(args) {
+				return protocol.MakeErrReply("ERR syntax error")
+			}
+			i++
+			id, err := strconv.ParseUint(string(args[i]), 10, 64)
+			if err != nil {
+				return protocol.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			if id == client.ID() {
+				// redirecting to itself means no redirection like redis
+				id = 0
+			} else if _, ok := h.clientsByID.Load(id); !ok {
+				return protocol.MakeErrReply("ERR The client ID you want redirect to does not exist")
+			}
+			opts.redirect = id
+		case "prefix":
+			if i+1 >= len(args) {
+				return protocol.MakeErrReply("ERR syntax error")
+			}
+			i++
+			opts.prefixes = append(opts.prefixes, string(args[i]))
+		case "bcast":
+			opts.bcast = true
+		case "optin":
+			opts.optIn = true
+		case "optout":
+			opts.optOut = true
+		case "noloop":
+			opts.noLoop = true
+		default:
+			return protocol.MakeErrReply("ERR syntax error")
+		}
+	}
+	if !on {
+		h.tracker.disable(client)
+		return protocol.MakeOkReply()
+	}
+	old := h.tracker.options(client)
+	if old != nil && old.bcast != opts.bcast {
+		return protocol.MakeErrReply("ERR You can't switch BCAST mode on/off before disabling tracking for this client, and then re-enabling it with a different mode.")
+	}
+	if len(opts.prefixes) > 0 && !opts.bcast {
+		return protocol.MakeErrReply("ERR PREFIX option requires BCAST mode to be enabled")
+	}
+	if opts.optIn && opts.optOut {
+		return protocol.MakeErrReply("ERR You can't use both OPTIN and OPTOUT.")
+	}
+	if (opts.optIn || opts.optOut) && opts.bcast {
+		return protocol.MakeErrReply("ERR OPTIN and OPTOUT are not compatible with BCAST")
+	}
+	// a prefix must not be a prefix of another, otherwise a key would be notified twice
+	all := opts.prefixes
+	if old != nil {
+		all = append(append([]string(nil), old.prefixes...), opts.prefixes...)
+	}
+	for i, a := range all {
+		for j, b := range all {
+			if i != j && a != b && strings.HasPrefix(a, b) {
+				return protocol.MakeErrReply("ERR Prefix '" + a + "' overlaps with another provided prefix '" + b +
+					"'. Prefixes for a single client must not overlap.")
+			}
+		}
+	}
+	h.tracker.enable(client, opts)
+	return protocol.MakeOkReply()
+}
+
+// clientTrackingInfo handles CLIENT TRACKINGINFO
+func clientTrackingInfo(h *Handler, client *connection.Connection) redis.Reply {
+	opts := h.tracker.options(client)
+	flags := []string{"off"}
+	redirect := int64(-1)
+	var prefixes []string
+	if opts != nil {
+		flags = []string{"on"}
+		if opts.bcast {
+			flags = append(flags, "bcast")
+		}
+		if opts.optIn {
+			flags = append(flags, "optin")
+			if opts.caching == cachingYes {
+				flags = append(flags, "caching-yes")
+			}
+		}
+		if opts.optOut {
+			flags = append(flags, "optout")
+			if opts.caching == cachingNo {
+				flags = append(flags, "caching-no")
+			}
+		}
+		if opts.noLoop {
+			flags = append(flags, "noloop")
+		}
+		redirect = int64(opts.redirect)
+		if opts.redirect != 0 {
+			if _, ok := h.clientsByID.Load(opts.redirect); !ok {
+				flags = append(flags, "broken_redirect")
+			}
+		}
+		for _, prefix := range opts.prefixes {
+			if prefix != "" || len(opts.prefixes) > 1 {
+				prefixes = append(prefixes, prefix)
+			}
+		}
+	}
+	if prefixes == nil {
+		prefixes = []string{}
+	}
+	return makeMap(
+		"flags", bulkStrings(flags),
+		"redirect", protocol.MakeIntReply(redirect),
+		"prefixes", bulkStrings(prefixes),
+	)
+}
+
+// clientGetRedir handles CLIENT GETREDIR, it returns -1 if tracking is off
+func clientGetRedir(h *Handler, client *connection.Connection) redis.Reply {
+	opts := h.tracker.options(client)
+	if opts == nil {
+		return protocol.MakeIntReply(-1)
+	}
+	return protocol.MakeIntReply(int64(opts.redirect))
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func (c *testConn) expectLines(expected ...string) {
+	c.t.Helper()
+	for _, line := range expected {
+		c.expectLine(line)
+	}
+}
+
+func TestTracking(t *testing.T) {
+	addr := startServerWithDB(t)
+	c := dial(t, addr)
+	c.send("HELLO", "3")
+	for line, _ := c.readLine(); line != "*0"; line, _ = c.readLine() {
+		// skip fields of HELLO until modules
+	}
+	c.expect("+OK", "CLIENT", "TRACKING", "ON")
+	c.expect("$-1", "GET", "foo")
+
+	other := dial(t, addr)
+	other.expect("+OK", "SET", "foo", "1")
+	c.expectLines(">2", "$10", "invalidate", "*1", "$3", "foo")
+	// keys are forgotten after invalidated
+	other.expect("+OK", "SET", "foo", "2")
+	c.expect("+OK", "CLIENT", "TRACKING", "OFF")
+
+	c.expect("-ERR PREFIX option requires BCAST mode to be enabled", "CLIENT", "TRACKING", "ON", "PREFIX", "a")
+	c.expect("-ERR You can't use both OPTIN and OPTOUT.", "CLIENT", "TRACKING", "ON", "OPTIN", "OPTOUT")
+
+	// only keys read after CLIENT CACHING YES are tracked in OPTIN mode
+	c.expect("+OK", "CLIENT", "TRACKING", "ON", "OPTIN")
+	c.expect("$-1", "GET", "bar")
+	c.expect("+OK", "CLIENT", "CACHING", "YES")
+	c.expect("$1", "GET", "foo")
+	c.expectLine("2")
+	other.expect("+OK", "SET", "bar", "1")
+	other.expect("+OK", "SET", "foo", "3")
+	c.expectLines(">2", "$10", "invalidate", "*1", "$3", "foo")
+}
+
+func TestTrackingRedirect(t *testing.T) {
+	addr := startServerWithDB(t)
+	r := dial(t, addr)
+	r.send("CLIENT", "ID")
+	line, _ := r.readLine()
+	id := strings.TrimPrefix(line, ":")
+	if _, err := strconv.Atoi(id); err != nil {
+		t.Fatalf("unexpected reply of CLIENT ID %q", line)
+	}
+	r.expect("*3", "SUBSCRIBE", invalidateChannel)
+	r.expectLines("$9", "subscribe", "$20", invalidateChannel, ":1")
+	r.expect("-ERR Can't execute 'get': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context", "GET", "a")
+
+	c := dial(t, addr)
+	c.expect("-ERR The client ID you want redirect to does not exist", "CLIENT", "TRACKING", "ON", "REDIRECT", "999999")
+	c.expect("+OK", "CLIENT", "TRACKING", "ON", "REDIRECT", id, "BCAST", "PREFIX", "user:")
+	c.expect(":"+id, "CLIENT", "GETREDIR")
+	c.expect("+OK", "SET", "item:1", "x")
+	c.expect("+OK", "SET", "user:1", "x")
+	r.expectLines("*3", "$7", "message", "$20", invalidateChannel, "*1", "$6", "user:1")
+
+	c.send("CLIENT", "INFO")
+	if info := c.readBulk(); !strings.Contains(info, "flags=t ") || !strings.Contains(info, "redir="+id+" ") {
+		t.Errorf("unexpected CLIENT INFO %q", info)
+	}
+}
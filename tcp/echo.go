@@ -2,6 +2,7 @@ package tcp
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"github.com/atomwqh/MyGodis/lib/logger"
 	"github.com/atomwqh/MyGodis/lib/sync/atomic"
@@ -72,3 +73,33 @@ func (h *EchoHandler) Close() error {
 	})
 	return nil
 }
+
+// OnOpen implements tcp.EventHandler
+func (h *EchoHandler) OnOpen(conn net.Conn) interface{} {
+	client := &EchoClient{
+		Conn: conn,
+	}
+	if h.closing.Get() {
+		_ = conn.Close()
+	}
+	h.activeConn.Store(client, struct{}{})
+	return client
+}
+
+// OnData sends back complete lines
+func (h *EchoHandler) OnData(session interface{}, data []byte) (int, error) {
+	client := session.(*EchoClient)
+	end := bytes.LastIndexByte(data, '\n')
+	if end < 0 {
+		return 0, nil
+	}
+	client.Waiting.Add(1)
+	_, err := client.Conn.Write(data[:end+1])
+	client.Waiting.Done()
+	return end + 1, err
+}
+
+// OnClose implements tcp.EventHandler
+func (h *EchoHandler) OnClose(session interface{}) {
+	h.activeConn.Delete(session)
+}
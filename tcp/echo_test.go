@@ -2,8 +2,11 @@ package tcp
 
 import (
 	"bufio"
+	"io"
 	"math/rand"
 	"net"
+	"os"
+	"path/filepath"
 	"strconv"
 	"testing"
 	"time"
@@ -78,7 +81,121 @@ func TestClientCounter(t *testing.T) {
 		time.Sleep(5 * time.Microsecond)
 	}
 	time.Sleep(time.Second * 3)
-	if ClientCounter != 0 {
-		t.Errorf("Client Counter error :%d", ClientCounter)
+	if n := ClientCount(); n != 0 {
+		t.Errorf("Client Counter error :%d", n)
+	}
+}
+
+func TestMaxConnAndTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closeChan := make(chan struct{})
+	cfg := &Config{MaxConn: 1, Timeout: 200 * time.Millisecond}
+	go Serve(listener, cfg, NewEchoHandler(), closeChan)
+	defer func() {
+		closeChan <- struct{}{}
+	}()
+	addr := listener.Addr().String()
+
+	first, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	_, _ = first.Write([]byte("hello\n"))
+	if line, err := bufio.NewReader(first).ReadString('\n'); err != nil || line != "hello\n" {
+		t.Fatalf("echo failed: %q %v", line, err)
+	}
+
+	second, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	line, _ := bufio.NewReader(second).ReadString('\n')
+	if line != "-ERR max number of clients reached\r\n" {
+		t.Errorf("expect max clients error, actual %q", line)
+	}
+
+	// first connection is idle, server should close it after timeout
+	_ = first.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err = first.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("idle connection should be closed, actual %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := ClientCount(); n != 0 {
+		t.Errorf("expect no client, actual %d", n)
+	}
+
+	cfg.SetLimits(2, 0)
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		_, _ = conn.Write([]byte("hi\n"))
+		if line, _ := bufio.NewReader(conn).ReadString('\n'); line != "hi\n" {
+			t.Errorf("conn %d should be accepted, actual %q", i, line)
+		}
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "godis.sock")
+	cfg := &Config{
+		Address:        "127.0.0.1:0",
+		UnixSocket:     path,
+		UnixSocketPerm: 0700,
+	}
+	listeners, err := listen(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closeChan := make(chan struct{})
+	go ServeListeners(listeners, cfg, NewEchoHandler(), closeChan)
+	defer func() {
+		closeChan <- struct{}{}
+	}()
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0700 {
+		t.Errorf("wrong permission of socket: %v %v", info, err)
+	}
+	// both listeners are served by the same handler
+	for _, addr := range []net.Addr{listeners[0].Addr(), listeners[1].Addr()} {
+		conn, err := net.Dial(addr.Network(), addr.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = conn.Write([]byte("hello\n"))
+		if line, err := bufio.NewReader(conn).ReadString('\n'); err != nil || line != "hello\n" {
+			t.Errorf("echo through %s failed: %q %v", addr.Network(), line, err)
+		}
+		_ = conn.Close()
+	}
+}
+
+func TestExtraHosts(t *testing.T) {
+	// find a free port, extra hosts listen on the same port as Address
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	_ = l.Close()
+	cfg := &Config{
+		Address:    "127.0.0.1:" + port,
+		ExtraHosts: []string{"127.0.0.2"},
+	}
+	listeners, err := listen(cfg)
+	if err != nil {
+		t.Skip("127.0.0.2 is not available: " + err.Error())
+	}
+	for _, listener := range listeners {
+		_ = listener.Close()
+	}
+	if len(listeners) != 2 || listeners[1].Addr().String() != "127.0.0.2:"+port {
+		t.Errorf("extra hosts are not listened: %v", listeners)
 	}
 }
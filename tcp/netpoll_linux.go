@@ -0,0 +1,560 @@
+//go:build linux
+
+package tcp
+
+import (
+	"errors"
+	"net"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/atomwqh/MyGodis/interface/tcp"
+	"github.com/atomwqh/MyGodis/lib/logger"
+)
+
+/*
+ * netpoll 用 epoll 管理所有连接: 一个 goroutine 执行 epoll_wait, 可读的连接交给 worker 读取并调用 EventHandler,
+ * fd 以 EPOLLONESHOT 注册, 同一时刻只有一个 worker 处理一个连接, 处理完成后再重新注册.
+ * Write 可能在事件已触发但尚未分发时重新注册 fd, 因此事件循环在 mu 保护下检查 busy, 重复的事件直接丢弃,
+ * worker 处理完成后重新注册时仍未处理的事件会再次触发.
+ * 空闲连接不占用 goroutine, 没有未处理的数据时也不占用读缓冲.
+ */
+
+const (
+	netpollReadSize = 16 * 1024
+	// maxReadPerRound keeps a busy connection from occupying a worker, the rest is read in next round
+	maxReadPerRound = 1024 * 1024
+	maxEvents       = 1024
+	// pollTimeout is the max time for event loop to notice closing and idle connections
+	pollTimeout = 100
+)
+
+var readBufPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, netpollReadSize)
+		return &b
+	},
+}
+
+var errNotSupported = errors.New("netpoll: operation not supported, data is pushed by event loop")
+
+// pollConn is a net.Conn driven by poller, Read is not supported
+type pollConn struct {
+	fd     int
+	poller *poller
+	local  net.Addr
+	remote net.Addr
+
+	session    interface{}
+	in         []byte // data not consumed by handler, owned by worker
+	lastActive int64  // unix nano, accessed atomically
+	idleExempt int32  // 1 means not closed by closeIdle, accessed atomically
+
+	mu      sync.Mutex
+	out     []byte // data not written since socket buffer is full
+	busy    bool   // dispatched to a worker, the worker will rearm it
+	resumed bool   // Resume is called while busy, the worker processes it again
+	closed  bool
+}
+
+// SetIdleExempt implements tcp.IdleExemptConn
+func (c *pollConn) SetIdleExempt(exempt bool) {
+	var v int32
+	if exempt {
+		v = 1
+	}
+	atomic.StoreInt32(&c.idleExempt, v)
+}
+
+// Resume implements tcp.ResumableConn, handler gets data not consumed again without waiting for new data
+func (c *pollConn) Resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	if c.busy {
+		c.resumed = true
+		return
+	}
+	c.busy = true
+	c.poller.tasks.push(c)
+}
+
+func (c *pollConn) Read(b []byte) (int, error) {
+	return 0, errNotSupported
+}
+
+// Write sends b without blocking, data which can't be sent immediately is buffered and sent when fd is writable
+func (c *pollConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return 0, net.ErrClosed
+	}
+	total := len(b)
+	if len(c.out) == 0 {
+		n, err := writeFd(c.fd, b)
+		if err != nil {
+			return n, err
+		}
+		if n == total {
+			return n, nil
+		}
+		b = b[n:]
+	}
+	c.out = append(c.out, b...)
+	if !c.busy {
+		// wait for EPOLLOUT, a busy connection is rearmed by its worker
+		c.rearm()
+	}
+	return total, nil
+}
+
+// Buffered returns the size of data waiting for fd to be writable
+func (c *pollConn) Buffered() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.out)
+}
+
+// flush writes buffered data, it must be called with mu held
+func (c *pollConn) flush() error {
+	if len(c.out) == 0 {
+		return nil
+	}
+	n, err := writeFd(c.fd, c.out)
+	if err != nil {
+		return err
+	}
+	if n == len(c.out) {
+		c.out = nil
+	} else {
+		c.out = c.out[n:]
+	}
+	return nil
+}
+
+// rearm registers fd again, it must be called with mu held
+func (c *pollConn) rearm() {
+	events := uint32(syscall.EPOLLIN | syscall.EPOLLRDHUP | syscall.EPOLLONESHOT)
+	if len(c.out) > 0 {
+		events |= syscall.EPOLLOUT
+	}
+	_ = syscall.EpollCtl(c.poller.epfd, syscall.EPOLL_CTL_MOD, c.fd, &syscall.EpollEvent{Events: events, Fd: int32(c.fd)})
+}
+
+// Close shuts down the connection, the worker releases fd and calls OnClose later
+func (c *pollConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	// wakes up epoll with EPOLLHUP, fd is closed by worker so it won't be reused while events are pending
+	return syscall.Shutdown(c.fd, syscall.SHUT_RDWR)
+}
+
+func (c *pollConn) LocalAddr() net.Addr                { return c.local }
+func (c *pollConn) RemoteAddr() net.Addr               { return c.remote }
+func (c *pollConn) SetDeadline(t time.Time) error      { return nil }
+func (c *pollConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *pollConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// writeFd writes until b is finished or socket buffer is full
+func writeFd(fd int, b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		n, err := syscall.Write(fd, b[written:])
+		if err == syscall.EINTR {
+			continue
+		} else if err == syscall.EAGAIN {
+			break
+		} else if err != nil {
+			return written, err
+		}
+		written += n
+	}
+	return written, nil
+}
+
+// taskQueue passes connections to workers, push never blocks the event loop.
+// A connection is queued at most once until its worker finishes, so the length is limited by the number of connections
+type taskQueue struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	conns  []*pollConn
+	closed bool
+}
+
+func newTaskQueue() *taskQueue {
+	q := &taskQueue{}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *taskQueue) push(c *pollConn) {
+	q.mu.Lock()
+	q.conns = append(q.conns, c)
+	q.mu.Unlock()
+	q.cond.Signal()
+}
+
+// pop waits for a connection, it returns nil after queue is closed and drained
+func (q *taskQueue) pop() *pollConn {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.conns) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if len(q.conns) == 0 {
+		return nil
+	}
+	c := q.conns[0]
+	q.conns[0] = nil
+	q.conns = q.conns[1:]
+	return c
+}
+
+func (q *taskQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
+
+type poller struct {
+	epfd     int
+	listenFd int
+	cfg      *Config
+	handler  tcp.EventHandler
+	conns    sync.Map // fd -> *pollConn
+	tasks    *taskQueue
+	nWorkers int
+	workers  sync.WaitGroup
+	closing  int32
+}
+
+func sockaddrToAddr(sa syscall.Sockaddr) net.Addr {
+	switch sa := sa.(type) {
+	case *syscall.SockaddrInet4:
+		return &net.TCPAddr{IP: append(net.IP{}, sa.Addr[:]...), Port: sa.Port}
+	case *syscall.SockaddrInet6:
+		return &net.TCPAddr{IP: append(net.IP{}, sa.Addr[:]...), Port: sa.Port}
+	}
+	return nil
+}
+
+// listenFd creates a non-blocking listening socket
+func listenFd(address string) (int, net.Addr, error) {
+	addr, err := net.ResolveTCPAddr("tcp", address)
+	if err != nil {
+		return -1, nil, err
+	}
+	var sa syscall.Sockaddr
+	family := syscall.AF_INET
+	if ip4 := addr.IP.To4(); ip4 != nil || addr.IP == nil {
+		sa4 := &syscall.SockaddrInet4{Port: addr.Port}
+		copy(sa4.Addr[:], ip4)
+		sa = sa4
+	} else {
+		family = syscall.AF_INET6
+		sa6 := &syscall.SockaddrInet6{Port: addr.Port}
+		copy(sa6.Addr[:], addr.IP.To16())
+		sa = sa6
+	}
+	fd, err := syscall.Socket(family, syscall.SOCK_STREAM|syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return -1, nil, err
+	}
+	if err = syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1); err == nil {
+		if err = syscall.Bind(fd, sa); err == nil {
+			err = syscall.Listen(fd, syscall.SOMAXCONN)
+		}
+	}
+	if err != nil {
+		_ = syscall.Close(fd)
+		return -1, nil, err
+	}
+	bound, _ := syscall.Getsockname(fd)
+	return fd, sockaddrToAddr(bound), nil
+}
+
+// newPoller listens on cfg.Address, workers are started by serve
+func newPoller(cfg *Config, handler tcp.EventHandler) (*poller, net.Addr, error) {
+	fd, addr, err := listenFd(cfg.Address)
+	if err != nil {
+		return nil, nil, err
+	}
+	epfd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		_ = syscall.Close(fd)
+		return nil, nil, err
+	}
+	// listener is level triggered, event loop accepts until EAGAIN
+	err = syscall.EpollCtl(epfd, syscall.EPOLL_CTL_ADD, fd, &syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(fd)})
+	if err != nil {
+		_ = syscall.Close(fd)
+		_ = syscall.Close(epfd)
+		return nil, nil, err
+	}
+	workers := cfg.NetpollWorkers
+	if workers <= 0 {
+		workers = runtime.NumCPU() * 4
+	}
+	return &poller{
+		epfd:     epfd,
+		listenFd: fd,
+		cfg:      cfg,
+		handler:  handler,
+		tasks:    newTaskQueue(),
+		nWorkers: workers,
+	}, addr, nil
+}
+
+// serve runs event loop until closeChan is closed or receives a value
+func (p *poller) serve(closeChan <-chan struct{}) {
+	for i := 0; i < p.nWorkers; i++ {
+		p.workers.Add(1)
+		go func() {
+			defer p.workers.Done()
+			for c := p.tasks.pop(); c != nil; c = p.tasks.pop() {
+				p.process(c)
+			}
+		}()
+	}
+	go func() {
+		<-closeChan
+		logger.Info("get close signal")
+		atomic.StoreInt32(&p.closing, 1)
+	}()
+
+	events := make([]syscall.EpollEvent, maxEvents)
+	lastCheck := time.Now()
+	for atomic.LoadInt32(&p.closing) == 0 {
+		n, err := syscall.EpollWait(p.epfd, events, pollTimeout)
+		if err != nil && err != syscall.EINTR {
+			logger.Error("epoll wait error: " + err.Error())
+			break
+		}
+		for i := 0; i < n; i++ {
+			fd := int(events[i].Fd)
+			if fd == p.listenFd {
+				p.accept()
+				continue
+			}
+			if v, ok := p.conns.Load(fd); ok {
+				c := v.(*pollConn)
+				c.mu.Lock()
+				if c.busy {
+					// fd was rearmed by Write before this event is dispatched, the worker will rearm it again
+					c.mu.Unlock()
+					continue
+				}
+				c.busy = true
+				c.mu.Unlock()
+				p.tasks.push(c)
+			}
+		}
+		if time.Since(lastCheck) > time.Second {
+			lastCheck = time.Now()
+			p.closeIdle()
+		}
+	}
+
+	logger.Info("accept close, shutting down...")
+	_ = syscall.Close(p.listenFd)
+	_ = p.handler.Close()
+	p.tasks.close()
+	p.workers.Wait()
+	p.conns.Range(func(key, value interface{}) bool {
+		p.release(value.(*pollConn))
+		return true
+	})
+	_ = syscall.Close(p.epfd)
+}
+
+func (p *poller) accept() {
+	for {
+		fd, sa, err := syscall.Accept4(p.listenFd, syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC)
+		if err == syscall.EINTR || err == syscall.ECONNABORTED {
+			continue
+		} else if err == syscall.EAGAIN {
+			return
+		} else if err != nil {
+			// e.g. EMFILE, retry in next round of epoll
+			logger.Infof("accept occours temporary error: %v, retry in 5ms", err)
+			time.Sleep(5 * time.Millisecond)
+			return
+		}
+		atomic.AddInt64(&TotalConnections, 1)
+		maxConn, _ := p.cfg.limits()
+		if n := atomic.AddInt32(&ClientCounter, 1); maxConn > 0 && int(n) > maxConn {
+			atomic.AddInt32(&ClientCounter, -1)
+			atomic.AddInt64(&RejectedConnections, 1)
+			logger.Warn("max number of clients reached, reject " + sockaddrToAddr(sa).String())
+			_, _ = writeFd(fd, maxClientsErrBytes)
+			_ = syscall.Close(fd)
+			continue
+		}
+		_ = syscall.SetsockoptInt(fd, syscall.IPPROTO_TCP, syscall.TCP_NODELAY, 1)
+		local, _ := syscall.Getsockname(fd)
+		c := &pollConn{
+			fd:         fd,
+			poller:     p,
+			local:      sockaddrToAddr(local),
+			remote:     sockaddrToAddr(sa),
+			lastActive: time.Now().UnixNano(),
+		}
+		logger.Info("accept link")
+		c.session = p.handler.OnOpen(c)
+		p.conns.Store(fd, c)
+		events := uint32(syscall.EPOLLIN | syscall.EPOLLRDHUP | syscall.EPOLLONESHOT)
+		if err = syscall.EpollCtl(p.epfd, syscall.EPOLL_CTL_ADD, fd, &syscall.EpollEvent{Events: events, Fd: int32(fd)}); err != nil {
+			logger.Error("epoll ctl error: " + err.Error())
+			p.release(c)
+		}
+	}
+}
+
+// closeIdle closes connections which have not sent anything for cfg.Timeout
+func (p *poller) closeIdle() {
+	_, timeout := p.cfg.limits()
+	if timeout <= 0 {
+		return
+	}
+	deadline := time.Now().Add(-timeout).UnixNano()
+	p.conns.Range(func(key, value interface{}) bool {
+		c := value.(*pollConn)
+		if atomic.LoadInt64(&c.lastActive) < deadline && atomic.LoadInt32(&c.idleExempt) == 0 {
+			logger.Info("closing idle client " + c.remote.String())
+			_ = c.Close()
+		}
+		return true
+	})
+}
+
+// process reads available data and passes it to handler, it is called by worker
+func (p *poller) process(c *pollConn) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		p.release(c)
+		return
+	}
+	broken := c.flush() != nil
+	c.mu.Unlock()
+
+	// read available data up to maxReadPerRound, then pass it to handler at once,
+	// so a large request arriving in many packets doesn't make handler parse it again and again
+	bufPtr := readBufPool.Get().(*[]byte)
+	buf := *bufPtr
+	var data []byte
+	for total := 0; !broken && total < maxReadPerRound; {
+		n, err := syscall.Read(c.fd, buf)
+		if err == syscall.EINTR {
+			continue
+		} else if err == syscall.EAGAIN {
+			break
+		} else if err != nil || n == 0 {
+			// peer closed or connection reset
+			broken = true
+			break
+		}
+		total += n
+		if len(c.in) == 0 && n < len(buf) {
+			// the common case, handler reads buf directly
+			data = buf[:n]
+			break
+		}
+		c.in = append(c.in, buf[:n]...)
+		data = c.in
+		if n < len(buf) {
+			// socket is drained
+			break
+		}
+	}
+	if data == nil && len(c.in) > 0 {
+		// resumed by handler, or data not consumed last time
+		data = c.in
+	}
+	if !broken && len(data) > 0 {
+		atomic.StoreInt64(&c.lastActive, time.Now().UnixNano())
+		consumed, err := p.handler.OnData(c.session, data)
+		if err != nil {
+			broken = true
+		} else if len(c.in) > 0 {
+			// data is c.in, keep unconsumed part. Nothing is copied if an incomplete request is still arriving
+			if consumed > 0 {
+				c.in = append(c.in[:0], data[consumed:]...)
+			}
+		} else {
+			// buf is reused by next read
+			c.in = append([]byte(nil), data[consumed:]...)
+		}
+		if len(c.in) == 0 {
+			// idle connection doesn't hold memory
+			c.in = nil
+		}
+	}
+	readBufPool.Put(bufPtr)
+
+	c.mu.Lock()
+	if broken || c.closed {
+		c.busy = false
+		c.closed = true
+		c.mu.Unlock()
+		p.release(c)
+		return
+	}
+	if c.resumed {
+		// stay busy, fd is rearmed after processing again
+		c.resumed = false
+		p.tasks.push(c)
+		c.mu.Unlock()
+		return
+	}
+	c.busy = false
+	c.rearm()
+	c.mu.Unlock()
+}
+
+// release closes fd and notifies handler, it is called once for each connection
+func (p *poller) release(c *pollConn) {
+	if _, loaded := p.conns.LoadAndDelete(c.fd); !loaded {
+		return
+	}
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	_ = syscall.EpollCtl(p.epfd, syscall.EPOLL_CTL_DEL, c.fd, nil)
+	_ = syscall.Close(c.fd)
+	atomic.AddInt32(&ClientCounter, -1)
+	p.handler.OnClose(c.session)
+	logger.Info("connection closed: " + c.remote.String())
+}
+
+// serveNetpoll serves cfg.Address by epoll event loop
+func serveNetpoll(cfg *Config, handler tcp.Handler, closeChan <-chan struct{}) error {
+	eventHandler, ok := handler.(tcp.EventHandler)
+	if !ok {
+		return errors.New("netpoll: handler doesn't implement tcp.EventHandler")
+	}
+	if cfg.TLS != nil || cfg.UnixSocket != "" {
+		return errors.New("netpoll: tls and unix socket are not supported")
+	}
+	if len(cfg.ExtraHosts) > 0 {
+		return errors.New("netpoll: only one bind address is supported")
+	}
+	p, addr, err := newPoller(cfg, eventHandler)
+	if err != nil {
+		return err
+	}
+	logger.Infof("bind: %s, start listening with netpoll ...", addr)
+	p.serve(closeChan)
+	return nil
+}
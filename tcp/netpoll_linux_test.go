@@ -0,0 +1,153 @@
+package tcp
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/atomwqh/MyGodis/interface/tcp"
+)
+
+func startNetpoll(t *testing.T, cfg *Config) string {
+	return startNetpollWith(t, cfg, NewEchoHandler())
+}
+
+func startNetpollWith(t *testing.T, cfg *Config, handler tcp.EventHandler) string {
+	cfg.Address = "127.0.0.1:0"
+	p, addr, err := newPoller(cfg, handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closeChan := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		p.serve(closeChan)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		close(closeChan)
+		<-done
+	})
+	return addr.String()
+}
+
+func TestNetpoll(t *testing.T) {
+	addr := startNetpoll(t, &Config{NetpollWorkers: 4})
+	conns := make([]net.Conn, 100)
+	for i := range conns {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conns[i] = conn
+	}
+	for i, conn := range conns {
+		// a line is split into several writes
+		_, _ = conn.Write([]byte("hel"))
+		time.Sleep(time.Millisecond)
+		_, _ = conn.Write([]byte("lo\nwor"))
+		_, _ = conn.Write([]byte("ld\n"))
+		reader := bufio.NewReader(conn)
+		for _, expected := range []string{"hello\n", "world\n"} {
+			if line, err := reader.ReadString('\n'); err != nil || line != expected {
+				t.Fatalf("conn %d: expect %q, actual %q %v", i, expected, line, err)
+			}
+		}
+	}
+
+	// large data exceeds socket buffer, it is sent back by EPOLLOUT
+	conn := conns[0]
+	big := strings.Repeat("x", 8*1024*1024) + "\n"
+	go func() {
+		_, _ = conn.Write([]byte(big))
+	}()
+	line, err := bufio.NewReaderSize(conn, 64*1024).ReadString('\n')
+	if err != nil || len(line) != len(big) {
+		t.Errorf("expect %d bytes, actual %d %v", len(big), len(line), err)
+	}
+	for _, conn := range conns {
+		_ = conn.Close()
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := ClientCount(); n != 0 {
+		t.Errorf("expect no client, actual %d", n)
+	}
+}
+
+func TestNetpollLimits(t *testing.T) {
+	addr := startNetpoll(t, &Config{MaxConn: 1, Timeout: 500 * time.Millisecond})
+	first, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	_, _ = first.Write([]byte("hi\n"))
+	if line, _ := bufio.NewReader(first).ReadString('\n'); line != "hi\n" {
+		t.Fatalf("echo failed: %q", line)
+	}
+	second, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	if line, _ := bufio.NewReader(second).ReadString('\n'); line != "-ERR max number of clients reached\r\n" {
+		t.Errorf("expect max clients error, actual %q", line)
+	}
+	_ = first.SetReadDeadline(time.Now().Add(3 * time.Second))
+	if _, err = first.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("idle connection should be closed, actual %v", err)
+	}
+}
+
+// holdHandler doesn't consume "hold" until released, like commands paused by CLIENT PAUSE
+type holdHandler struct {
+	*EchoHandler
+	released int32
+	held     chan tcp.ResumableConn
+}
+
+func (h *holdHandler) OnData(session interface{}, data []byte) (int, error) {
+	client := session.(*EchoClient)
+	if strings.HasPrefix(string(data), "hold") && atomic.LoadInt32(&h.released) == 0 {
+		h.held <- client.Conn.(tcp.ResumableConn)
+		return 0, nil
+	}
+	return h.EchoHandler.OnData(session, data)
+}
+
+func TestNetpollResume(t *testing.T) {
+	h := &holdHandler{EchoHandler: NewEchoHandler(), held: make(chan tcp.ResumableConn, 1)}
+	addr := startNetpollWith(t, &Config{NetpollWorkers: 1}, h)
+	first, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	_, _ = first.Write([]byte("hold\n"))
+	held := <-h.held
+
+	// the only worker is not occupied by the held connection
+	second, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	_, _ = second.Write([]byte("hi\n"))
+	_ = second.SetReadDeadline(time.Now().Add(time.Second))
+	if line, err := bufio.NewReader(second).ReadString('\n'); err != nil || line != "hi\n" {
+		t.Fatalf("expect echo, actual %q %v", line, err)
+	}
+
+	// data not consumed is passed again without new data
+	atomic.StoreInt32(&h.released, 1)
+	held.Resume()
+	_ = first.SetReadDeadline(time.Now().Add(time.Second))
+	if line, err := bufio.NewReader(first).ReadString('\n'); err != nil || line != "hold\n" {
+		t.Errorf("expect held line after resume, actual %q %v", line, err)
+	}
+}
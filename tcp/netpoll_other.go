@@ -0,0 +1,14 @@
+//go:build !linux
+
+package tcp
+
+import (
+	"errors"
+
+	"github.com/atomwqh/MyGodis/interface/tcp"
+)
+
+// serveNetpoll is only implemented on linux
+func serveNetpoll(cfg *Config, handler tcp.Handler, closeChan <-chan struct{}) error {
+	return errors.New("netpoll is only supported on linux")
+}
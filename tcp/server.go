@@ -2,6 +2,8 @@ package tcp
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"github.com/atomwqh/MyGodis/interface/tcp"
 	"github.com/atomwqh/MyGodis/lib/logger"
@@ -19,41 +21,258 @@ a tcp server
 */
 
 type Config struct {
-	Address string        `yaml:"address"`
-	MaxConn int           `yaml:"max_conn"`
+	Address string `yaml:"address"`
+	// MaxConn limits the number of clients, 0 means no limit
+	MaxConn int `yaml:"max_conn"`
+	// Timeout closes connections which have not sent anything for the duration, 0 means never
 	Timeout time.Duration `yaml:"timeout"`
+	// UnixSocket is the path of unix socket listener, empty means disabled
+	UnixSocket string `yaml:"unix_socket"`
+	// UnixSocketPerm changes permission of unix socket file if it is not 0
+	UnixSocketPerm os.FileMode `yaml:"unix_socket_perm"`
+	// TLS enables TLS listener if it is not nil, Address may be empty if only TLS is needed
+	TLS *TLSConfig `yaml:"tls"`
+	// ExtraHosts are listened on the ports of Address and TLS.Address too, like the rest of bind addresses of redis
+	ExtraHosts []string `yaml:"extra_hosts"`
+	// Netpoll serves Address by epoll event loop instead of a goroutine per connection,
+	// handler must implement tcp.EventHandler. It is only supported on linux without TLS and unix socket.
+	Netpoll bool `yaml:"netpoll"`
+	// NetpollWorkers is the number of goroutines handling data of connections, 0 means 4 * NumCPU
+	NetpollWorkers int `yaml:"netpoll_workers"`
+	// OnHangup is called on SIGHUP, server keeps running
+	OnHangup func() `yaml:"-"`
+
+	mu        sync.RWMutex // protects MaxConn, Timeout and TLS after serving started
+	tlsLoader *tlsLoader
 }
 
-// ClientCounter record current number of clients
-var ClientCounter int32
+// SetLimits changes MaxConn and Timeout of a running server, timeout applies to the next read
+func (cfg *Config) SetLimits(maxConn int, timeout time.Duration) {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	cfg.MaxConn = maxConn
+	cfg.Timeout = timeout
+}
 
-// ListenAndServeWithSignal binds port and handle requests, blocking until receive stop signal
-func ListenAndServeWithSignal(cfg *Config, handler tcp.Handler) error {
-	closeChan := make(chan struct{})
-	sigChan := make(chan os.Signal)
+func (cfg *Config) limits() (int, time.Duration) {
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	return cfg.MaxConn, cfg.Timeout
+}
+
+// 以下计数器只能通过 sync/atomic 访问
+var (
+	// ClientCounter record current number of clients
+	ClientCounter int32
+	// TotalConnections is the number of connections accepted since started
+	TotalConnections int64
+	// RejectedConnections is the number of connections rejected because of MaxConn
+	RejectedConnections int64
+)
+
+// ClientCount returns current number of clients
+func ClientCount() int {
+	return int(atomic.LoadInt32(&ClientCounter))
+}
+
+var maxClientsErrBytes = []byte("-ERR max number of clients reached\r\n")
+
+// listen binds all addresses in cfg
+func listen(cfg *Config) ([]net.Listener, error) {
+	var listeners []net.Listener
+	closeAll := func() {
+		for _, l := range listeners {
+			_ = l.Close()
+		}
+	}
+	if cfg.Address != "" {
+		addresses, err := withHosts(cfg.Address, cfg.ExtraHosts)
+		if err != nil {
+			return nil, err
+		}
+		for _, address := range addresses {
+			listener, err := net.Listen("tcp", address)
+			if err != nil {
+				closeAll()
+				return nil, err
+			}
+			logger.Info(fmt.Sprintf("bind: %s, start listening ...", address))
+			listeners = append(listeners, listener)
+		}
+	}
+	if cfg.TLS != nil {
+		loader, err := newTLSLoader(cfg.TLS)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		addresses, err := withHosts(cfg.TLS.Address, cfg.ExtraHosts)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		cfg.mu.Lock()
+		cfg.tlsLoader = loader
+		cfg.mu.Unlock()
+		for _, address := range addresses {
+			listener, err := net.Listen("tcp", address)
+			if err != nil {
+				closeAll()
+				return nil, err
+			}
+			logger.Info(fmt.Sprintf("bind tls: %s, start listening ...", address))
+			listeners = append(listeners, tls.NewListener(listener, loader.config()))
+		}
+	}
+	if cfg.UnixSocket != "" {
+		listener, err := listenUnix(cfg.UnixSocket, cfg.UnixSocketPerm)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		logger.Info(fmt.Sprintf("bind unix socket: %s, start listening ...", cfg.UnixSocket))
+		listeners = append(listeners, listener)
+	}
+	if len(listeners) == 0 {
+		return nil, errors.New("no address to listen on")
+	}
+	return listeners, nil
+}
+
+// withHosts returns address and addresses of the same port on hosts
+func withHosts(address string, hosts []string) ([]string, error) {
+	if len(hosts) == 0 {
+		return []string{address}, nil
+	}
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	addresses := []string{address}
+	for _, host := range hosts {
+		addresses = append(addresses, net.JoinHostPort(host, port))
+	}
+	return addresses, nil
+}
+
+// listenUnix listens on unix socket at path, socket file is removed after listener closed
+func listenUnix(path string, perm os.FileMode) (net.Listener, error) {
+	// remove socket file left by last run, like redis does
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		_ = os.Remove(path)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if perm != 0 {
+		if err = os.Chmod(path, perm); err != nil {
+			_ = listener.Close()
+			return nil, err
+		}
+	}
+	return listener, nil
+}
+
+// handleSignals returns a channel which receives a value on SIGTERM, SIGINT or SIGQUIT.
+// SIGHUP reloads TLS certificates and calls cfg.OnHangup. stop unregisters signals.
+func handleSignals(cfg *Config) (closeChan chan struct{}, stop func()) {
+	closeChan = make(chan struct{})
+	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT)
 	go func() {
-		sig := <-sigChan
-		switch sig {
-		case syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT:
+		for sig := range sigChan {
+			if sig == syscall.SIGHUP {
+				logger.Info("get SIGHUP")
+				if settings := cfg.TLSSettings(); settings != nil {
+					if err := cfg.ReloadTLS(settings); err != nil {
+						logger.Error("reload tls certificates failed: " + err.Error())
+					} else {
+						logger.Info("tls certificates reloaded")
+					}
+				}
+				if cfg.OnHangup != nil {
+					cfg.OnHangup()
+				}
+				continue
+			}
 			closeChan <- struct{}{}
+			return
 		}
 	}()
+	return closeChan, func() {
+		signal.Stop(sigChan)
+	}
+}
 
-	listener, err := net.Listen("tcp", cfg.Address)
+// ListenAndServeWithSignal binds port and handle requests, blocking until receive stop signal and handler is closed.
+// handler is not closed if it returns error
+func ListenAndServeWithSignal(cfg *Config, handler tcp.Handler) error {
+	if cfg.Netpoll {
+		closeChan, stop := handleSignals(cfg)
+		defer stop()
+		return serveNetpoll(cfg, handler, closeChan)
+	}
+	listeners, err := listen(cfg)
 	if err != nil {
 		return err
 	}
-	logger.Info(fmt.Sprintf("bind: %s, start listening ...", cfg.Address))
-	ListenAndServe(listener, handler, closeChan)
+	closeChan, stop := handleSignals(cfg)
+	defer stop()
+	ServeListeners(listeners, cfg, handler, closeChan)
 	return nil
 }
 
-// ListenAndServe binds port and handle requests, blocking until close
+// ListenAndServe binds port and handle requests without limits, blocking until close
 func ListenAndServe(listener net.Listener, handler tcp.Handler, closeChan chan struct{}) {
-	errCh := make(chan error, 1)
-	defer close(errCh)
+	Serve(listener, &Config{}, handler, closeChan)
+}
+
+// idleConn closes connection if client sends nothing within timeout
+type idleConn struct {
+	net.Conn
+	cfg    *Config
+	exempt int32 // 1 means no timeout, accessed atomically
+}
+
+// SetIdleExempt implements tcp.IdleExemptConn, it applies to the next read
+func (c *idleConn) SetIdleExempt(exempt bool) {
+	var v int32
+	if exempt {
+		v = 1
+	}
+	atomic.StoreInt32(&c.exempt, v)
+}
+
+func (c *idleConn) Read(b []byte) (int, error) {
+	if _, timeout := c.cfg.limits(); timeout > 0 && atomic.LoadInt32(&c.exempt) == 0 {
+		_ = c.Conn.SetReadDeadline(time.Now().Add(timeout))
+	} else {
+		_ = c.Conn.SetReadDeadline(time.Time{})
+	}
+	return c.Conn.Read(b)
+}
+
+// reject tells client the reason then closes connection
+func reject(conn net.Conn) {
+	_ = conn.SetWriteDeadline(time.Now().Add(time.Second))
+	_, _ = conn.Write(maxClientsErrBytes)
+	_ = conn.Close()
+}
+
+// Serve handles connections from listener with limits in cfg, blocking until close
+func Serve(listener net.Listener, cfg *Config, handler tcp.Handler, closeChan chan struct{}) {
+	ServeListeners([]net.Listener{listener}, cfg, handler, closeChan)
+}
+
+// ServeListeners handles connections from all listeners by the same handler, blocking until close and handler.Close returns.
+// All listeners are closed if any of them fails.
+func ServeListeners(listeners []net.Listener, cfg *Config, handler tcp.Handler, closeChan chan struct{}) {
+	errCh := make(chan error, len(listeners))
+	// closed after handler is closed, so that the caller may exit after db has been flushed
+	closed := make(chan struct{})
 	go func() {
+		defer close(closed)
 		select {
 		case <-closeChan:
 			logger.Info("get close signal")
@@ -61,11 +280,30 @@ func ListenAndServe(listener net.Listener, handler tcp.Handler, closeChan chan s
 			logger.Error(fmt.Sprintf("accept error: %s", err.Error()))
 		}
 		logger.Info("accept close, shutting down...")
-		_ = listener.Close()
+		for _, listener := range listeners {
+			_ = listener.Close()
+		}
 		_ = handler.Close()
 	}()
-	ctx := context.Background()
 	var waitDone sync.WaitGroup
+	var acceptors sync.WaitGroup
+	for _, listener := range listeners {
+		acceptors.Add(1)
+		go func(listener net.Listener) {
+			defer acceptors.Done()
+			if err := accept(listener, cfg, handler, &waitDone); err != nil {
+				errCh <- err
+			}
+		}(listener)
+	}
+	acceptors.Wait()
+	waitDone.Wait()
+	<-closed
+}
+
+// accept serves connections from listener until it is closed
+func accept(listener net.Listener, cfg *Config, handler tcp.Handler, waitDone *sync.WaitGroup) error {
+	ctx := context.Background()
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
@@ -74,20 +312,28 @@ func ListenAndServe(listener net.Listener, handler tcp.Handler, closeChan chan s
 				time.Sleep(time.Millisecond * 5)
 				continue
 			}
-			errCh <- err
-			break
+			return err
+		}
+		atomic.AddInt64(&TotalConnections, 1)
+		maxConn, _ := cfg.limits()
+		if n := atomic.AddInt32(&ClientCounter, 1); maxConn > 0 && int(n) > maxConn {
+			atomic.AddInt32(&ClientCounter, -1)
+			atomic.AddInt64(&RejectedConnections, 1)
+			logger.Warn("max number of clients reached, reject " + conn.RemoteAddr().String())
+			go reject(conn)
+			continue
 		}
 		// handle
 		logger.Info("accept link")
-		ClientCounter++
 		waitDone.Add(1)
 		go func() {
 			defer func() {
+				// make sure fd is released even if handler forgot to close it
+				_ = conn.Close()
 				waitDone.Done()
 				atomic.AddInt32(&ClientCounter, -1)
 			}()
-			handler.Handle(ctx, conn)
+			handler.Handle(ctx, &idleConn{Conn: conn, cfg: cfg})
 		}()
 	}
-	waitDone.Wait()
 }
@@ -0,0 +1,117 @@
+package tcp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// 证书保存在 tlsLoader 中, 每次握手时通过 GetConfigForClient 取得最新的配置, 因此 reload 不影响已建立的连接
+
+// TLSConfig is the settings of TLS listener
+type TLSConfig struct {
+	Address  string `yaml:"address"`
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// CAFile is used to verify client certificates
+	CAFile string `yaml:"ca_file"`
+	// AuthClients is "yes", "optional" or "no" like tls-auth-clients of redis
+	AuthClients string `yaml:"auth_clients"`
+}
+
+// build loads certificates and makes tls.Config
+func (settings *TLSConfig) build() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(settings.CertFile, settings.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load certificate failed: %v", err)
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	switch settings.AuthClients {
+	case "no":
+		config.ClientAuth = tls.NoClientCert
+	case "optional":
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	case "yes", "":
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, errors.New("auth clients must be yes, optional or no")
+	}
+	if config.ClientAuth != tls.NoClientCert {
+		if settings.CAFile == "" {
+			return nil, errors.New("CA certificate is required to authenticate clients")
+		}
+		pem, err := os.ReadFile(settings.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("load CA certificate failed: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no valid CA certificate in " + settings.CAFile)
+		}
+		config.ClientCAs = pool
+	}
+	return config, nil
+}
+
+// tlsLoader holds current tls.Config which can be replaced at runtime
+type tlsLoader struct {
+	current atomic.Value // *tls.Config
+}
+
+func newTLSLoader(settings *TLSConfig) (*tlsLoader, error) {
+	loader := &tlsLoader{}
+	if err := loader.reload(settings); err != nil {
+		return nil, err
+	}
+	return loader, nil
+}
+
+// reload replaces certificates, old ones are kept if new ones are invalid
+func (l *tlsLoader) reload(settings *TLSConfig) error {
+	config, err := settings.build()
+	if err != nil {
+		return err
+	}
+	l.current.Store(config)
+	return nil
+}
+
+// config returns tls.Config for listener, it uses the latest certificates for every handshake
+func (l *tlsLoader) config() *tls.Config {
+	return &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return l.current.Load().(*tls.Config), nil
+		},
+	}
+}
+
+// TLSSettings returns settings of current TLS certificates
+func (cfg *Config) TLSSettings() *TLSConfig {
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	return cfg.TLS
+}
+
+// ReloadTLS loads certificates again from files in settings, it is called on SIGHUP with cfg.TLS.
+// New connections use new certificates, established connections are not affected.
+func (cfg *Config) ReloadTLS(settings *TLSConfig) error {
+	cfg.mu.Lock()
+	loader := cfg.tlsLoader
+	cfg.mu.Unlock()
+	if loader == nil {
+		return errors.New("tls is not enabled")
+	}
+	if err := loader.reload(settings); err != nil {
+		return err
+	}
+	cfg.mu.Lock()
+	cfg.TLS = settings
+	cfg.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,136 @@
+package tcp
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// makeCert creates a certificate signed by parent, it is self-signed if parent is nil
+func makeCert(t *testing.T, cn string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, []byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:         isCA,
+
+		BasicConstraintsValid: true,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	return cert, key, certPem, keyPem
+}
+
+func TestTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey, caPem, _ := makeCert(t, "test ca", true, nil, nil)
+	_, _, serverPem, serverKeyPem := makeCert(t, "server1", false, ca, caKey)
+	_, _, clientPem, clientKeyPem := makeCert(t, "client", false, ca, caKey)
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	settings := &TLSConfig{
+		Address:     "127.0.0.1:0",
+		CertFile:    write("server.crt", serverPem),
+		KeyFile:     write("server.key", serverKeyPem),
+		CAFile:      write("ca.crt", caPem),
+		AuthClients: "yes",
+	}
+	cfg := &Config{TLS: settings}
+	listeners, err := listen(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closeChan := make(chan struct{})
+	go ServeListeners(listeners, cfg, NewEchoHandler(), closeChan)
+	defer func() {
+		closeChan <- struct{}{}
+	}()
+	addr := listeners[0].Addr().String()
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caPem)
+	clientCert, err := tls.X509KeyPair(clientPem, clientKeyPem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// echo returns the common name of server certificate
+	echo := func(certs []tls.Certificate) (string, error) {
+		conn, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: roots, Certificates: certs})
+		if err != nil {
+			return "", err
+		}
+		defer conn.Close()
+		_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+		if _, err = conn.Write([]byte("hello\n")); err != nil {
+			return "", err
+		}
+		if _, err = bufio.NewReader(conn).ReadString('\n'); err != nil {
+			return "", err
+		}
+		return conn.ConnectionState().PeerCertificates[0].Subject.CommonName, nil
+	}
+
+	if cn, err := echo([]tls.Certificate{clientCert}); err != nil || cn != "server1" {
+		t.Fatalf("tls echo failed: %s %v", cn, err)
+	}
+	if _, err = echo(nil); err == nil {
+		t.Error("client without certificate should be rejected")
+	}
+
+	// reload with new certificate
+	_, _, serverPem, serverKeyPem = makeCert(t, "server2", false, ca, caKey)
+	newSettings := *settings
+	newSettings.CertFile = write("server2.crt", serverPem)
+	newSettings.KeyFile = write("server2.key", serverKeyPem)
+	newSettings.AuthClients = "optional"
+	if err = cfg.ReloadTLS(&newSettings); err != nil {
+		t.Fatal(err)
+	}
+	if cn, err := echo(nil); err != nil || cn != "server2" {
+		t.Errorf("expect new certificate, actual %s %v", cn, err)
+	}
+
+	// invalid certificate doesn't replace the current one
+	badSettings := newSettings
+	badSettings.CertFile = filepath.Join(dir, "no-such-file")
+	if err = cfg.ReloadTLS(&badSettings); err == nil {
+		t.Error("expect error for invalid certificate")
+	}
+	if cn, err := echo(nil); err != nil || cn != "server2" {
+		t.Errorf("certificate should not be changed, actual %s %v", cn, err)
+	}
+}